@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"time"
+)
+
+// WithAccessTracking applies the access tracking option to the Cache, which
+// records when each element was last written or read, e.g. to build custom
+// eviction or idle detection on top of the Cache; it is off by default to
+// spare the cost of a write on every read.
+func WithAccessTracking[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.accessTracking = true
+		c.accessed = map[K]time.Time{}
+	}
+}
+
+// LastAccess returns when the element under the given key was last written
+// or read and whether the time is known, i.e. the element is in the Cache
+// and access tracking is enabled.
+func (c *Cache[K, V]) LastAccess(k K) (time.Time, bool) {
+	if !c.accessTracking {
+		return time.Time{}, false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	c.accessLock.Lock()
+	defer c.accessLock.Unlock()
+	t, ok := c.accessed[k]
+	return t, ok
+}
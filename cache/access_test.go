@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLastAccess(t *testing.T) {
+
+	now := time.Now()
+	cache := New(WithAccessTracking[string, string]())
+	cache.clock = func() time.Time { return now }
+
+	_, ok := cache.LastAccess("a")
+	assert.Equal(t, ok, false, "Absent keys have no access time.")
+
+	cache.Put("a", "aaa")
+	at, ok := cache.LastAccess("a")
+	assert.Equal(t, ok, true, "The access time should be known.")
+	assert.Equal(t, at, now, "Writing should record the access time.")
+
+	now = now.Add(time.Minute)
+	cache.Get("a")
+	at, _ = cache.LastAccess("a")
+	assert.Equal(t, at, now, "Get should update the access time.")
+
+	// operations that do not read the element leave the time untouched
+	last := now
+	now = now.Add(time.Minute)
+	cache.Keys()
+	cache.Size()
+	cache.Get("<not present>")
+	at, _ = cache.LastAccess("a")
+	assert.Equal(t, at, last, "Only reading the element should update the access time.")
+
+	cache.Delete("a")
+	_, ok = cache.LastAccess("a")
+	assert.Equal(t, ok, false, "Deleted keys have no access time.")
+
+	// disabled by default
+	plain := New[string, string]()
+	plain.Put("a", "aaa")
+	plain.Get("a")
+	_, ok = plain.LastAccess("a")
+	assert.Equal(t, ok, false, "Access tracking should be disabled by default.")
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCircuitOpen is returned when the Cache skips writing to persistent
+// storage because the circuit breaker is open.
+var ErrCircuitOpen = errors.New("persistence circuit breaker open")
+
+// BreakerState is the state of the persistence circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed means that writes go to persistent storage as usual.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means that persistent storage is deemed unavailable, so
+	// writes are skipped until a probe succeeds.
+	BreakerOpen
+)
+
+// String returns a textual representation of the breaker state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// WithCircuitBreaker applies the circuit breaker option to the Cache: after
+// the given number of consecutive failed writes, the Cache stops writing to
+// persistent storage and keeps serving from memory, probing the persistence
+// at the given interval; as soon as a probe succeeds, the accumulated state
+// has been flushed and writes resume as usual.
+func WithCircuitBreaker[K comparable, V any](threshold int, probe time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if threshold > 0 && probe > 0 {
+			c.breakerThreshold = threshold
+			c.breakerProbe = probe
+		}
+	}
+}
+
+// Breaker returns the current state of the persistence circuit breaker.
+func (c *Cache[K, V]) Breaker() BreakerState {
+	c.breakerLock.Lock()
+	defer c.breakerLock.Unlock()
+	if c.breakerTimer != nil {
+		return BreakerOpen
+	}
+	return BreakerClosed
+}
+
+// breakerFailed records a failed write, opening the breaker and scheduling
+// the first probe once the threshold is reached.
+func (c *Cache[K, V]) breakerFailed() {
+	if c.breakerThreshold == 0 {
+		return
+	}
+	c.breakerLock.Lock()
+	defer c.breakerLock.Unlock()
+	c.breakerFailures++
+	if c.breakerFailures >= c.breakerThreshold && c.breakerTimer == nil {
+		if c.logger != nil {
+			c.logger.Warn("opening persistence circuit breaker", "failures", c.breakerFailures)
+		}
+		c.breakerTimer = time.AfterFunc(c.breakerProbe, c.probe)
+	}
+}
+
+// breakerSucceeded records a successful write.
+func (c *Cache[K, V]) breakerSucceeded() {
+	if c.breakerThreshold == 0 {
+		return
+	}
+	c.breakerLock.Lock()
+	defer c.breakerLock.Unlock()
+	c.breakerFailures = 0
+}
+
+// probe tries to flush the accumulated state to persistent storage, closing
+// the breaker on success and scheduling another probe otherwise.
+func (c *Cache[K, V]) probe() {
+	if c.logger != nil {
+		c.logger.Debug("probing persistence")
+	}
+	unlock := c.storeLock()
+	err := c.autoWriteNoLock()
+	unlock()
+
+	c.breakerLock.Lock()
+	defer c.breakerLock.Unlock()
+	if c.breakerTimer == nil {
+		// stopped by Close while probing
+		return
+	}
+	if err != nil {
+		if c.logger != nil {
+			c.logger.Warn("persistence still unavailable", "error", err)
+		}
+		c.breakerTimer.Reset(c.breakerProbe)
+		return
+	}
+	if c.logger != nil {
+		c.logger.Info("closing persistence circuit breaker")
+	}
+	c.breakerFailures = 0
+	c.breakerTimer = nil
+	c.flushed()
+}
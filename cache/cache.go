@@ -1,19 +1,127 @@
 package cache
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slog"
 )
 
 type Cache[K comparable, V any] struct {
-	store       map[K]V
-	lock        sync.RWMutex
-	persistence Persistence
-	policy      Policy
-	encoding    Encoding[K, V]
-	logger      *slog.Logger
+	*state[K, V]
+	// putDepth is the number of nested on-put hooks the Cache was handed to
+	putDepth int
+	// ctx is the context the Cache view binds persistence operations to (see
+	// WithContext)
+	ctx context.Context
+}
+
+// state holds the contents and the configuration of a Cache, shared by the
+// Cache values handed to on-put hooks.
+type state[K comparable, V any] struct {
+	store            Store[K, V]
+	lock             sync.RWMutex
+	persistence      Persistence
+	policy           Policy
+	encoding         Encoding[K, V]
+	logger           *slog.Logger
+	shrink           float64
+	peak             int
+	timing           func(op string, d time.Duration)
+	loader           Loader[K, V]
+	loaderTTL        time.Duration
+	freshWriteBack   bool
+	clock            func() time.Time
+	softDelete       time.Duration
+	tombstones       map[K]time.Time
+	modified         map[K]time.Time
+	dirty            atomic.Bool
+	maxDefer         time.Duration
+	deferLock        sync.Mutex
+	deferTimer       *time.Timer
+	migrations       map[int]Migration
+	interned         map[any]*canonical[V]
+	internDynamic    bool
+	accessTracking   bool
+	accessLock       sync.Mutex
+	accessed         map[K]time.Time
+	breakerThreshold int
+	breakerProbe     time.Duration
+	breakerLock      sync.Mutex
+	breakerFailures  int
+	breakerTimer     *time.Timer
+	deleteGrace      time.Duration
+	graveyard        map[K]grave[V]
+	graceTimer       *time.Timer
+	pstats           persistenceStats
+	onLoad           func(loaded int)
+	lazy             bool
+	persisted        atomic.Bool
+	factories        map[K]*factory[V]
+	loaderMode       LoaderMode
+	loadingLock      sync.Mutex
+	loading          map[K]struct{}
+	strictLoad       bool
+	loadFailed       atomic.Bool
+	dirtyTracking    bool
+	dirtyLock        sync.Mutex
+	dirtyKeys        map[K]bool
+	copyOnLoad       bool
+	maxDecoded       int
+	loadTransform    func(k K, v V) (V, bool)
+	storeTransform   func(k K, v V) (V, bool)
+	flushLock        sync.Mutex
+	lastFlush        time.Time
+	lastFlushErr     error
+	flushFailures    int
+	stopOnDiskFull   bool
+	diskFull         atomic.Bool
+	errorTTL         time.Duration
+	shouldCache      func(error) bool
+	failuresLock     sync.Mutex
+	failures         map[K]failure
+	hits             hitTracker
+	closeOnce        sync.Once
+	closeErr         error
+	background       sync.WaitGroup
+	stoppersLock     sync.Mutex
+	stoppers         []func()
+	conflicts        ConflictStrategy
+	version          string
+	ioLock           sync.Mutex
+	onPut            func(c *Cache[K, V], k K, v V)
+	dedup            func(v V) []byte
+	expiries         map[K]time.Time
+	sweepInterval    time.Duration
+	ttlFunc          func(k K, v V) time.Duration
+	ttlResolution    time.Duration
+	meta             map[K]map[string]string
+	metaTTL          bool
+	maxEntries       int
+	watermarks       bool
+	lowWatermark     int
+	evictor          evictor[K]
+	evictionLock     sync.Mutex
+	pinned           map[K]bool
+	memoryInterval   time.Duration
+	heapThreshold    uint64
+	shedPerCycle     int
+	softLimit        bool
+	memoryLimit      int64
+	limitMargin      int64
+	onEvict          func(k K, v V)
+	computingLock    sync.Mutex
+	computing        map[K]*factory[V]
+	stats            accessStats
 }
 
 // Option is the type for functional options.
@@ -21,18 +129,46 @@ type Option[K comparable, V any] func(*Cache[K, V])
 
 // New creates a new Cache object, applying all the provided functional options.
 func New[K comparable, V any](options ...Option[K, V]) *Cache[K, V] {
-	c := &Cache[K, V]{
-		store:       map[K]V{},
+	c := &Cache[K, V]{state: &state[K, V]{
+		store:       newMapStore[K, V](nil),
 		persistence: &Discard{},
 		policy:      &Never{},
 		encoding:    &GOB[K, V]{},
-	}
+		clock:       time.Now,
+	}}
 	for _, option := range options {
 		option(c)
 	}
+	c.startSweeper()
+	c.startMemoryJanitor()
 	return c
 }
 
+// NewDefaultFileCache creates a new Cache persisted to a file in the
+// OS-specific user cache directory (see os.UserCacheDir), under a directory
+// named after the application, which is created if missing; the format
+// ("json", "yaml", "toml" or "gob") selects both the encoding and the file
+// extension. Further options are applied after the defaults.
+func NewDefaultFileCache[K comparable, V any](appName string, format string, options ...Option[K, V]) (*Cache[K, V], error) {
+	encoding, err := NewEncoding[K, V](format)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate user cache directory: %w", err)
+	}
+	dir := filepath.Join(root, appName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create cache directory: %w", err)
+	}
+	options = append([]Option[K, V]{
+		WithPersistence[K, V](&File{Path: filepath.Join(dir, "cache."+format)}),
+		WithEncoding(encoding),
+	}, options...)
+	return New(options...), nil
+}
+
 // WithPersistence applies the persistence option to the Cache, which governs
 // how the cache writes its contents to persistent storage.
 func WithPersistence[K comparable, V any](p Persistence) Option[K, V] {
@@ -63,6 +199,18 @@ func WithEncoding[K comparable, V any](e Encoding[K, V]) Option[K, V] {
 	}
 }
 
+// WithShrinkThreshold applies the shrink threshold option to the Cache: whenever
+// a Delete brings the number of elements below the given fraction of the peak
+// size reached since the last shrink, the underlying map is rebuilt so that
+// unused bucket memory can be released; a value of 0 disables auto-shrinking.
+func WithShrinkThreshold[K comparable, V any](ratio float64) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if ratio >= 0 && ratio < 1 {
+			c.shrink = ratio
+		}
+	}
+}
+
 // WithLogger applies the logger option to the Cache.
 func WithLogger[K comparable, V any](l *slog.Logger) Option[K, V] {
 	return func(c *Cache[K, V]) {
@@ -72,12 +220,47 @@ func WithLogger[K comparable, V any](l *slog.Logger) Option[K, V] {
 	}
 }
 
+// WithTimingHook applies the timing hook option to the Cache; the hook is
+// invoked with the duration of each operation ("get", "put", "replace",
+// "delete", "clear", "store" and "load") and of the persistence sub-steps
+// ("encode", "write", "read" and "decode", or "stream" when encoding and
+// writing happen in one go), e.g. to feed latency histograms.
+func WithTimingHook[K comparable, V any](fn func(op string, d time.Duration)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.timing = fn
+		}
+	}
+}
+
+// WithOnLoad applies the on-load hook option to the Cache; the hook is
+// invoked after each successful Load with the number of entries loaded, e.g.
+// to rebuild derived indexes. It runs outside the lock, so it can safely
+// access the Cache.
+func WithOnLoad[K comparable, V any](fn func(loaded int)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.onLoad = fn
+		}
+	}
+}
+
+// WithCopyOnLoad applies the copy-on-load option to the Cache, which then
+// copies the data read from persistence before decoding it, so that the
+// decoded values cannot share memory with a buffer the persistence reuses
+// (e.g. a pooled or memory-mapped one).
+func WithCopyOnLoad[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.copyOnLoad = true
+	}
+}
+
 // Pull pulls the elements from the given Cache into this; if the two Caches
 // have some elements in common, the incoming elements replace the existing ones.
 func (c *Cache[K, V]) Pull(other *Cache[K, V]) error {
 	if other == nil {
 		if c.logger != nil {
-			c.logger.Error("merging with nil cache")
+			c.logger.Error("pulling from nil cache")
 		}
 		return errors.New("invalid cache")
 	}
@@ -88,11 +271,15 @@ func (c *Cache[K, V]) Pull(other *Cache[K, V]) error {
 
 	keys := other.Keys()
 	for _, k := range keys {
+		if c.tombstoned(k, other) {
+			continue
+		}
 		v, _ := other.Get(k)
-		c.Put(k, v)
+		c.Replace(k, v)
 	}
+	c.reconcile(other)
 	if c.logger != nil {
-		c.logger.Debug("dne pulling other caches elements into this")
+		c.logger.Debug("done pulling other caches elements into this")
 	}
 	return nil
 }
@@ -108,26 +295,30 @@ func (c *Cache[K, V]) Merge(other *Cache[K, V]) error {
 	}
 
 	if c.logger != nil {
-		c.logger.Debug("pulling other caches elements into this")
+		c.logger.Debug("merging other caches elements into this")
 	}
 
 	keys := other.Keys()
 	for _, k := range keys {
+		if c.tombstoned(k, other) {
+			continue
+		}
 		v, _ := other.Get(k)
 		c.Put(k, v)
 	}
+	c.reconcile(other)
 	if c.logger != nil {
-		c.logger.Debug("dne pulling other caches elements into this")
+		c.logger.Debug("done merging other caches elements into this")
 	}
 	return nil
 }
 
 func (c *Cache[K, V]) Store() error {
+	defer c.timed("store")()
 	if c.logger != nil {
 		c.logger.Debug("persisting cache")
 	}
-	c.lock.RLock()
-	defer c.lock.RUnlock()
+	defer c.storeLock()()
 	if err := c.storeNoLock(true); err != nil {
 		if c.logger != nil {
 			c.logger.Error("error persisting cache", "error", err)
@@ -140,26 +331,92 @@ func (c *Cache[K, V]) Store() error {
 	return nil
 }
 
+// Ping checks whether the persistent storage is reachable, if the
+// persistence supports it.
+func (c *Cache[K, V]) Ping() error {
+	if p, ok := c.boundPersistence().(Pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// CopyTo writes a snapshot of the cache contents to the given persistence
+// using the given encoding, e.g. to export a backup in a different format or
+// location, without affecting the cache's own persistence. Expiry times are
+// copied along, like Store does.
+func (c *Cache[K, V]) CopyTo(p Persistence, e Encoding[K, V]) error {
+	if p == nil || e == nil {
+		return errors.New("invalid encoding or persistence")
+	}
+	if c.logger != nil {
+		c.logger.Debug("copying cache")
+	}
+	c.lock.RLock()
+	snapshot, expiries := c.expiringWithNoLock(e, c.snapshotNoLock())
+	data, err := encodeExpiring(e, snapshot, expiries)
+	c.lock.RUnlock()
+	if err != nil {
+		if c.logger != nil {
+			c.logger.Error("error encoding cache copy", "error", err)
+		}
+		return err
+	}
+	if err = p.Write(data); err != nil {
+		if c.logger != nil {
+			c.logger.Error("error writing cache copy", "error", err)
+		}
+		return err
+	}
+	return nil
+}
+
 func (c *Cache[K, V]) Load() error {
+	defer c.timed("load")()
 	if c.logger != nil {
 		c.logger.Debug("loading cache")
 	}
 
+	// the data is read and decoded before taking the lock, so that readers
+	// are only stalled while the contents are swapped
+	m, expiries, err := c.read()
 	c.lock.Lock()
-	defer c.lock.Unlock()
-	return c.loadNoLock()
+	if err == nil {
+		c.swapNoLock(m, expiries)
+	}
+	loaded := c.store.Len()
+	// with no data there is nothing that could be overwritten
+	c.loadFailed.Store(err != nil && !errors.Is(err, ErrNoData))
+	c.lock.Unlock()
+	if err == nil && c.onLoad != nil {
+		c.onLoad(loaded)
+	}
+	return err
 }
 
 // Put stores an element in the cache; if ana element already exists, it
-// does not replace it and keeps the previous value.
+// does not replace it and keeps the previous value. A read-only Cache (see
+// ReadOnly) stores nothing and returns false.
 func (c *Cache[K, V]) Put(k K, v V) bool {
+	defer c.timed("put")()
 	if c.logger != nil {
 		c.logger.Debug("putting value into cache", "key", k, "value", v)
 	}
+	stored := false
+	defer c.putted(k, v, &stored)
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	if _, ok := c.store[k]; !ok {
-		c.store[k] = v
+	if c.rejected() {
+		return false
+	}
+	stored = c.putNoLock(k, v)
+	return stored
+}
+
+// putNoLock stores an element in the cache unless one already exists under
+// the same key; it must be called with the write lock held.
+func (c *Cache[K, V]) putNoLock(k K, v V) bool {
+	if _, ok := c.liveNoLock(k); !ok {
+		c.setNoLock(k, v)
 		if c.logger != nil {
 			c.logger.Debug("value stored into cache", "key", k, "value", v)
 		}
@@ -169,17 +426,47 @@ func (c *Cache[K, V]) Put(k K, v V) bool {
 	return false
 }
 
+// TryPut is like Put, but it returns immediately if the write lock cannot be
+// acquired without blocking, e.g. while the Cache is being flushed; the last
+// return value reports whether the lock was acquired. Like Put, a read-only
+// Cache stores nothing and reports it as not added.
+func (c *Cache[K, V]) TryPut(k K, v V) (bool, bool) {
+	stored := false
+	defer c.putted(k, v, &stored)
+	if !c.lock.TryLock() {
+		if c.logger != nil {
+			c.logger.Debug("lock not acquired, value not put into cache", "key", k)
+		}
+		return false, false
+	}
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return false, true
+	}
+	stored = c.putNoLock(k, v)
+	return stored, true
+}
+
 // Replace stores an element in the cache, possibly replacing an existing
 // one under the same key; it returns whether an elements was already
-// present in the Cache under the same key and, if so, its value.
+// present in the Cache under the same key and, if so, its value. A read-only
+// Cache (see ReadOnly) stores nothing and reports no previous element.
 func (c *Cache[K, V]) Replace(k K, v V) (V, bool) {
+	defer c.timed("replace")()
 	if c.logger != nil {
 		c.logger.Debug("putting value into cache", "key", k, "value", v)
 	}
+	stored := false
+	defer c.putted(k, v, &stored)
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	old, ok := c.store[k]
-	c.store[k] = v
+	if c.rejected() {
+		var zero V
+		return zero, false
+	}
+	old, ok := c.liveNoLock(k)
+	c.setNoLock(k, v)
+	stored = true
 	c.storeNoLock(false)
 	if c.logger != nil {
 		c.logger.Debug("returning previous value from cache", "present", ok, "key", k, "value", old)
@@ -187,77 +474,654 @@ func (c *Cache[K, V]) Replace(k K, v V) (V, bool) {
 	return old, ok
 }
 
+// BulkLoad calls fn with a function that stores elements in the cache,
+// replacing any existing ones, without persisting the cache; once fn
+// returns, the cache is persisted exactly once, regardless of the policy,
+// and the error is returned. The write lock is held while fn runs, so fn
+// must not call any other method of the Cache. A read-only Cache (see
+// ReadOnly) fails with ErrReadOnly, without calling fn.
+func (c *Cache[K, V]) BulkLoad(fn func(put func(k K, v V))) error {
+	defer c.timed("put")()
+	if c.logger != nil {
+		c.logger.Debug("bulk loading values into cache")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return ErrReadOnly
+	}
+	count := 0
+	fn(func(k K, v V) {
+		c.setNoLock(k, v)
+		count++
+	})
+	err := c.storeNoLock(true)
+	if c.logger != nil {
+		c.logger.Debug("values bulk loaded into cache", "count", count, "error", err)
+	}
+	return err
+}
+
+// ReplaceIfPresent replaces the element in the cache under the given key
+// only if the key already exists, doing nothing otherwise; it returns
+// whether the element was replaced and, if so, its previous value. A
+// read-only Cache (see ReadOnly) stores nothing and reports it as not
+// replaced.
+func (c *Cache[K, V]) ReplaceIfPresent(k K, v V) (V, bool) {
+	defer c.timed("replace")()
+	if c.logger != nil {
+		c.logger.Debug("replacing value in cache if present", "key", k, "value", v)
+	}
+	ok := false
+	defer c.putted(k, v, &ok)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		var zero V
+		return zero, false
+	}
+	old, ok := c.liveNoLock(k)
+	if ok {
+		c.setNoLock(k, v)
+		c.storeNoLock(false)
+	}
+	if c.logger != nil {
+		c.logger.Debug("returning previous value from cache", "present", ok, "key", k, "value", old)
+	}
+	return old, ok
+}
+
 // Get retrieves an element from the cache, returning whether it is
-// presents and its value.
+// presents and its value; if the element is missing and a loader is
+// configured, the loader is invoked to retrieve it.
 func (c *Cache[K, V]) Get(k K) (V, bool) {
+	v, ok, _ := c.get(k)
+	return v, ok
+}
+
+// get retrieves an element from the cache like Get, also returning the
+// error of the loader, if any.
+func (c *Cache[K, V]) get(k K) (V, bool, error) {
+	defer c.timed("get")()
 	if c.logger != nil {
 		c.logger.Debug("getting value from cache", "key", k)
 	}
 	c.lock.RLock()
-	defer c.lock.RUnlock()
-	v, ok := c.store[k]
+	v, ok := c.store.Get(k)
+	expired := ok && c.expiredNoLock(k, c.clock())
+	if expired {
+		var zero V
+		v, ok = zero, false
+	}
+	c.hits.record(c.clock(), ok)
+	var f *factory[V]
+	if ok {
+		c.touchNoLock(k)
+	} else {
+		f = c.factories[k]
+	}
+	c.lock.RUnlock()
+	if expired {
+		c.purge(k)
+	}
+	if f != nil {
+		v, ok = c.resolve(k, f)
+	}
+	var err error
+	if !ok && c.loader != nil {
+		if c.loaderMode == AsyncLoad {
+			c.loadAsync(k)
+		} else {
+			v, ok, err = c.loadThrough(k)
+		}
+	}
 	if c.logger != nil {
 		c.logger.Debug("returning value from cache", "present", ok, "key", k, "value", v)
 	}
-	return v, ok
+	return v, ok, err
+}
+
+// ReplaceIf stores an element in the cache only if cond, which is called
+// under the write lock with the existing value and whether there is one,
+// returns true; it returns the previous value, if any, and whether the
+// element was stored. A read-only Cache (see ReadOnly) does not call cond,
+// stores nothing and reports it as not stored.
+func (c *Cache[K, V]) ReplaceIf(k K, v V, cond func(old V, exists bool) bool) (V, bool) {
+	defer c.timed("replace")()
+	if c.logger != nil {
+		c.logger.Debug("replacing value in cache conditionally", "key", k, "value", v)
+	}
+	ok := false
+	defer c.putted(k, v, &ok)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		var zero V
+		return zero, false
+	}
+	old, exists := c.liveNoLock(k)
+	ok = cond(old, exists)
+	if ok {
+		c.setNoLock(k, v)
+		c.storeNoLock(false)
+	}
+	if c.logger != nil {
+		c.logger.Debug("returning previous value from cache", "replaced", ok, "key", k, "value", old)
+	}
+	return old, ok
+}
+
+// ErrKeyNotFound is returned by GetE when the key is not in the Cache.
+var ErrKeyNotFound = errors.New("key not found")
+
+// GetE is like Get, but it reports a missing key as an error wrapping
+// ErrKeyNotFound, and naming the key if it is a fmt.Stringer, or as the
+// error returned by the loader, if any.
+func (c *Cache[K, V]) GetE(k K) (V, error) {
+	v, ok, err := c.get(k)
+	if ok {
+		return v, nil
+	}
+	if err != nil {
+		return v, err
+	}
+	if s, ok := any(k).(fmt.Stringer); ok {
+		return v, fmt.Errorf("%w: %s", ErrKeyNotFound, s.String())
+	}
+	return v, ErrKeyNotFound
+}
+
+// TryGet is like Get, but it returns immediately if the read lock cannot be
+// acquired without blocking and it never invokes the loader; the last return
+// value reports whether the lock was acquired.
+func (c *Cache[K, V]) TryGet(k K) (V, bool, bool) {
+	if !c.lock.TryRLock() {
+		if c.logger != nil {
+			c.logger.Debug("lock not acquired, value not got from cache", "key", k)
+		}
+		var zero V
+		return zero, false, false
+	}
+	defer c.lock.RUnlock()
+	v, ok := c.store.Get(k)
+	if ok && c.expiredNoLock(k, c.clock()) {
+		var zero V
+		return zero, false, true
+	}
+	if ok {
+		c.touchNoLock(k)
+	}
+	return v, ok, true
 }
 
 // Delete removes an element from the Cache given its key; it returns
-// whether the element was present in the Cache and, if so, its value.
+// whether the element was present in the Cache and, if so, its value. A
+// read-only Cache (see ReadOnly) removes nothing and reports the element as
+// absent.
 func (c *Cache[K, V]) Delete(k K) (V, bool) {
+	defer c.timed("delete")()
 	if c.logger != nil {
 		c.logger.Debug("removing value from cache", "key", k)
 	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	v, ok := c.store[k]
-	delete(c.store, k)
-	err := c.storeNoLock(false)
+	if c.rejected() {
+		var zero V
+		return zero, false
+	}
+	v, ok, _ := c.removeNoLock(k, false)
+	return v, ok
+}
+
+// DeleteDurable removes an element from the cache like Delete, but it
+// always persists the cache right away and returns the error, if any, so
+// that callers can tell whether the deletion was durably recorded; the
+// element is removed from memory regardless. A read-only Cache (see
+// ReadOnly) removes nothing and fails with ErrReadOnly.
+func (c *Cache[K, V]) DeleteDurable(k K) (V, bool, error) {
+	defer c.timed("delete")()
+	if c.logger != nil {
+		c.logger.Debug("removing value from cache durably", "key", k)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		var zero V
+		return zero, false, ErrReadOnly
+	}
+	return c.removeNoLock(k, true)
+}
+
+// removeNoLock removes an element from the cache and persists the cache,
+// forcing the write if so requested; it must be called with the write lock
+// held.
+func (c *Cache[K, V]) removeNoLock(k K, force bool) (V, bool, error) {
+	v, ok := c.liveNoLock(k)
+	if ok {
+		c.buryNoLock(k, v)
+		c.deleteNoLock(k)
+	}
+	delete(c.factories, k)
+	c.collectTombstonesNoLock()
+	if c.shrink > 0 && c.peak >= minShrinkSize && float64(c.store.Len()) < c.shrink*float64(c.peak) {
+		c.shrinkNoLock()
+	}
+	err := c.storeNoLock(force)
 	if c.logger != nil {
 		c.logger.Debug("removed value from cache", "present", ok, "key", k, "value", v, "error", err)
 	}
-	return v, ok
+	return v, ok, err
 }
 
 // Size returns the size of the cache.
 func (c *Cache[K, V]) Size() int {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
-	size := len(c.store)
+	size := c.store.Len()
 	if c.logger != nil {
 		c.logger.Debug("returning cache size", "size", size)
 	}
 	return size
 }
 
-// Clear removes all elements from the cache.
+// Clear removes all elements from the cache; a read-only Cache (see
+// ReadOnly) is left untouched.
 func (c *Cache[K, V]) Clear() {
+	defer c.timed("clear")()
 	if c.logger != nil {
 		c.logger.Debug("clearing value cache")
 	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.store = map[K]V{}
+	if c.rejected() {
+		return
+	}
+	c.emptyNoLock()
 	err := c.storeNoLock(false)
 	if c.logger != nil {
 		c.logger.Debug("cache clear", "error", err)
 	}
 }
 
-// Keys returns the current set of keys in the Cache.
+// ClearNoFlush removes all elements from the cache like Clear, but without
+// persisting the now empty cache; the change is written out with the next
+// store, e.g. after repopulating the cache with PutMany. Like Clear, it
+// leaves a read-only Cache untouched.
+func (c *Cache[K, V]) ClearNoFlush() {
+	defer c.timed("clear")()
+	if c.logger != nil {
+		c.logger.Debug("clearing value cache without flushing")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return
+	}
+	c.emptyNoLock()
+	c.dirty.Store(true)
+}
+
+// PutMany stores the given elements in the cache, keeping the existing
+// values like Put, and persists the cache once for the whole batch; it
+// returns the number of elements added, which is zero for a read-only Cache
+// (see ReadOnly).
+func (c *Cache[K, V]) PutMany(elements map[K]V) int {
+	defer c.timed("put")()
+	if c.logger != nil {
+		c.logger.Debug("putting values into cache", "count", len(elements))
+	}
+	stored := []K{}
+	defer func() {
+		for _, k := range stored {
+			ok := true
+			c.putted(k, elements[k], &ok)
+		}
+	}()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return 0
+	}
+	for k, v := range elements {
+		if _, ok := c.liveNoLock(k); !ok {
+			c.setNoLock(k, v)
+			stored = append(stored, k)
+		}
+	}
+	if len(stored) > 0 {
+		c.storeNoLock(false)
+	}
+	return len(stored)
+}
+
+// PutMulti stores the given elements in the cache like PutMany, keeping the
+// existing values and persisting the cache once for the whole batch; it
+// returns the number of elements added.
+func (c *Cache[K, V]) PutMulti(elements map[K]V) int {
+	return c.PutMany(elements)
+}
+
+// Contains returns whether the Cache holds an unexpired element under the
+// given key, without calling the loader nor building lazy values, and
+// without counting as an access.
+func (c *Cache[K, V]) Contains(k K) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.store.Get(k)
+	return ok && !c.expiredNoLock(k, c.clock())
+}
+
+// GetMulti retrieves the elements under the given keys in one go, acquiring
+// the read lock only once; the result only holds the keys that are present
+// and unexpired. Unlike Get, it does not call the loader for missing keys,
+// nor does it build lazy values still pending.
+func (c *Cache[K, V]) GetMulti(keys []K) map[K]V {
+	defer c.timed("get")()
+	if c.logger != nil {
+		c.logger.Debug("getting values from cache", "count", len(keys))
+	}
+	elements := make(map[K]V, len(keys))
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	now := c.clock()
+	for _, k := range keys {
+		v, ok := c.store.Get(k)
+		ok = ok && !c.expiredNoLock(k, now)
+		c.hits.record(now, ok)
+		if ok {
+			c.touchNoLock(k)
+			elements[k] = v
+		}
+	}
+	if c.logger != nil {
+		c.logger.Debug("returning values from cache", "count", len(elements))
+	}
+	return elements
+}
+
+// Shrink rebuilds the underlying map at its current size; Go maps never
+// release their buckets, so a Cache that grew large and then had most of
+// its elements deleted keeps retaining the memory of its peak size. Custom
+// stores are only shrunk if they implement Shrink() themselves.
+func (c *Cache[K, V]) Shrink() {
+	if c.logger != nil {
+		c.logger.Debug("shrinking cache")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shrinkNoLock()
+	if c.logger != nil {
+		c.logger.Debug("cache shrunk", "size", c.store.Len())
+	}
+}
+
+// Keys returns the current set of keys in the Cache, leaving out those of
+// expired elements.
 func (c *Cache[K, V]) Keys() []K {
 	keys := []K{}
 	c.lock.RLock()
 	defer c.lock.RUnlock()
-	for k := range c.store {
-		keys = append(keys, k)
-	}
+	now := c.clock()
+	c.store.Range(func(k K, _ V) bool {
+		if !c.expiredNoLock(k, now) {
+			keys = append(keys, k)
+		}
+		return true
+	})
 	if c.logger != nil {
 		c.logger.Debug("returning cache keys", "keys", keys, "size", len(keys))
 	}
 	return keys
 }
 
+// Values returns the current values in the Cache; the slice is a snapshot,
+// which does not reflect later changes to the Cache.
+func (c *Cache[K, V]) Values() []V {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	snapshot := c.snapshotNoLock()
+	values := make([]V, 0, len(snapshot))
+	for _, v := range snapshot {
+		values = append(values, v)
+	}
+	if c.logger != nil {
+		c.logger.Debug("returning cache values", "size", len(values))
+	}
+	return values
+}
+
+// Entries returns a shallow copy of the current contents of the Cache, which
+// can be iterated without holding any lock; it is a snapshot, which does not
+// reflect later changes to the Cache.
+func (c *Cache[K, V]) Entries() map[K]V {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	entries := maps.Clone(c.snapshotNoLock())
+	if c.logger != nil {
+		c.logger.Debug("returning cache entries", "size", len(entries))
+	}
+	return entries
+}
+
+// Range calls fn for each unexpired element in the Cache, in no particular
+// order, until fn returns false; the elements are not copied, but the read
+// lock is held throughout, so fn must not call back into the Cache: a method
+// that takes the write lock would deadlock, and so may one that takes the
+// read lock if a writer is waiting. See Entries for a snapshot that can be
+// iterated freely.
+func (c *Cache[K, V]) Range(fn func(k K, v V) bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.logger != nil {
+		c.logger.Debug("ranging over cache", "size", c.store.Len())
+	}
+	now := c.clock()
+	c.store.Range(func(k K, v V) bool {
+		return c.expiredNoLock(k, now) || fn(k, v)
+	})
+}
+
+// timed starts measuring an operation and returns the function that reports
+// its duration to the timing hook; when no hook is set it does nothing.
+func (c *Cache[K, V]) timed(op string) func() {
+	if c.timing == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		c.timing(op, time.Since(start))
+	}
+}
+
+// Query returns the projections of all the elements of the Cache matching
+// the given predicate, in no particular order; a nil predicate matches all
+// elements. Both functions run on a snapshot of the Cache taken under the
+// read lock, so they can safely access the Cache.
+func Query[K comparable, V any, R any](c *Cache[K, V], where func(k K, v V) bool, project func(k K, v V) R) []R {
+	results := []R{}
+	for k, v := range c.clone() {
+		if where == nil || where(k, v) {
+			results = append(results, project(k, v))
+		}
+	}
+	return results
+}
+
+// Equal returns whether the two Caches hold the same set of keys, with equal
+// values as reported by eq; if eq is nil, values are compared using
+// reflect.DeepEqual, while Eq can be used for comparable values. Each Cache
+// is snapshotted under its own read lock, so comparing a Cache with itself
+// or comparing the same Caches concurrently cannot deadlock.
+func Equal[K comparable, V any](a, b *Cache[K, V], eq func(V, V) bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if eq == nil {
+		eq = func(x, y V) bool {
+			return reflect.DeepEqual(x, y)
+		}
+	}
+	x, y := a.clone(), b.clone()
+	if len(x) != len(y) {
+		return false
+	}
+	for k, v := range x {
+		w, ok := y[k]
+		if !ok || !eq(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Eq reports whether two comparable values are equal; it can be passed to
+// Equal as the value comparison function.
+func Eq[V comparable](a, b V) bool {
+	return a == b
+}
+
+// clone returns a copy of the Cache contents, taken under the read lock.
+func (c *Cache[K, V]) clone() map[K]V {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return maps.Clone(c.snapshotNoLock())
+}
+
+// minShrinkSize is the peak size below which auto-shrinking is not worth
+// the cost of rebuilding the map.
+const minShrinkSize = 1024
+
+// setNoLock stores the element under the given key, replacing any existing
+// one, and updates the bookkeeping; it must be called with the write lock
+// held.
+func (c *Cache[K, V]) setNoLock(k K, v V) {
+	if c.interned != nil {
+		if old, ok := c.store.Get(k); ok {
+			c.releaseNoLock(old)
+		}
+		v = c.internNoLock(v)
+	}
+	c.store.Set(k, v)
+	observe(c.policy, v)
+	delete(c.factories, k)
+	c.writtenNoLock(k)
+	if c.ttlFunc != nil {
+		c.expireNoLock(k, c.ttlFunc(k, v))
+	}
+}
+
+// deleteNoLock removes the element under the given key, which must exist,
+// and updates the bookkeeping; it must be called with the write lock held.
+func (c *Cache[K, V]) deleteNoLock(k K) {
+	if c.interned != nil {
+		if old, ok := c.store.Get(k); ok {
+			c.releaseNoLock(old)
+		}
+	}
+	c.store.Delete(k)
+	c.removedNoLock(k)
+}
+
+// dropNoLock removes the element under the given key, which must exist, from
+// memory only, e.g. when evicting it: unlike deleteNoLock, it leaves no
+// tombstone behind, is not tracked as a dirty key, so that it is not
+// propagated as a delete, and is not counted as one either (see Stats); it
+// must be called with the write lock held.
+func (c *Cache[K, V]) dropNoLock(k K) {
+	if c.interned != nil {
+		if old, ok := c.store.Get(k); ok {
+			c.releaseNoLock(old)
+		}
+	}
+	c.store.Delete(k)
+	if c.softDelete > 0 {
+		delete(c.modified, k)
+	}
+	if c.accessTracking {
+		delete(c.accessed, k)
+	}
+	delete(c.expiries, k)
+	delete(c.meta, k)
+	c.forgetEvictionNoLock(k)
+}
+
+// writtenNoLock updates the bookkeeping after an element has been written,
+// e.g. the peak size of the Cache since the last shrink; it must be called
+// with the write lock held.
+func (c *Cache[K, V]) writtenNoLock(k K) {
+	if c.store.Len() > c.peak {
+		c.peak = c.store.Len()
+	}
+	if c.softDelete > 0 {
+		c.modified[k] = c.clock()
+		delete(c.tombstones, k)
+	}
+	if c.accessTracking {
+		// no readers can be holding the access lock
+		c.accessed[k] = c.clock()
+	}
+	if c.deleteGrace > 0 {
+		delete(c.graveyard, k)
+	}
+	delete(c.expiries, k)
+	delete(c.meta, k)
+	c.stats.puts.Add(1)
+	c.markDirtyNoLock(k, true)
+	c.writtenEvictionNoLock(k)
+}
+
+// touchNoLock updates the bookkeeping after an element has been read; it
+// must be called with at least the read lock held.
+func (c *Cache[K, V]) touchNoLock(k K) {
+	if c.accessTracking {
+		c.accessLock.Lock()
+		c.accessed[k] = c.clock()
+		c.accessLock.Unlock()
+	}
+	c.readEvictionNoLock(k)
+}
+
+// removedNoLock updates the bookkeeping after an element has been removed,
+// e.g. leaving a tombstone behind; it must be called with the write lock
+// held.
+func (c *Cache[K, V]) removedNoLock(k K) {
+	if c.softDelete > 0 {
+		delete(c.modified, k)
+		c.tombstones[k] = c.clock()
+	}
+	if c.accessTracking {
+		delete(c.accessed, k)
+	}
+	delete(c.expiries, k)
+	delete(c.meta, k)
+	delete(c.pinned, k)
+	c.stats.deletes.Add(1)
+	c.markDirtyNoLock(k, false)
+	c.forgetEvictionNoLock(k)
+}
+
+// emptyNoLock removes all the elements from the store; it must be called
+// with the write lock held.
+func (c *Cache[K, V]) emptyNoLock() {
+	c.store.Range(func(k K, _ V) bool {
+		c.removedNoLock(k)
+		return true
+	})
+	c.clearNoLock()
+	c.resetInterningNoLock()
+	c.factories = nil
+	c.peak = 0
+}
+
+// shrinkNoLock asks the store to release its unused memory, if it knows how
+// to; it must be called with the write lock held.
+func (c *Cache[K, V]) shrinkNoLock() {
+	if s, ok := c.store.(interface{ Shrink() }); ok {
+		s.Shrink()
+	}
+	c.peak = c.store.Len()
+}
+
 // storeNoLock persists the cache without acquiring the read lock,
 // which should be held by the caller; not acquiring the lock before
 // calling this method can result in unexpected behaviour.
@@ -266,15 +1130,109 @@ func (c *Cache[K, V]) storeNoLock(force bool) error {
 		c.logger.Debug("storing the cache without acquiring the lock")
 	}
 
+	if !force && c.blockedNoLock() {
+		if c.logger != nil {
+			c.logger.Debug("strict load, not storing after a failed load")
+		}
+		c.dirty.Store(true)
+		return ErrLoadFailed
+	}
+
+	if !force && c.pristineNoLock() {
+		if c.logger != nil {
+			c.logger.Debug("lazy persistence, nothing to store yet")
+		}
+		return nil
+	}
+
 	if !force && !c.policy.Trigger() {
 		if c.logger != nil {
 			c.logger.Debug("neither policy not user requie the cache to be stored")
 
 		}
+		c.dirty.Store(true)
+		return nil
+	}
+
+	if !force && c.maxDefer > 0 {
+		if c.logger != nil {
+			c.logger.Debug("deferring cache store until idle")
+		}
+		c.deferNoLock()
 		return nil
 	}
 
-	data, err := c.encoding.Encode(c.store)
+	return c.commitNoLock(c.writeNoLock)
+}
+
+// flushNoLock stores the cache on its own initiative, e.g. on schedule or
+// once a deferred write is due: it bypasses the policy and the deferral, but
+// not the strict load block. It must be called with the lock held.
+func (c *Cache[K, V]) flushNoLock() error {
+	return c.commitNoLock(c.autoWriteNoLock)
+}
+
+// commitNoLock writes the cache through the given function unless the
+// circuit breaker is open, and updates the bookkeeping; it must be called
+// with the lock held.
+func (c *Cache[K, V]) commitNoLock(write func() error) error {
+	if c.Breaker() == BreakerOpen {
+		if c.logger != nil {
+			c.logger.Debug("circuit breaker open, skipping cache store")
+		}
+		c.dirty.Store(true)
+		return ErrCircuitOpen
+	}
+
+	err := write()
+	if errors.Is(err, ErrLoadFailed) {
+		// nothing was attempted
+		return err
+	}
+	c.flushAttempted(err)
+	c.checkDiskFull(err)
+	if err != nil {
+		c.breakerFailed()
+		return err
+	}
+
+	c.breakerSucceeded()
+	c.flushed()
+
+	if c.logger != nil {
+		c.logger.Debug("cache stored with no lock acquired")
+	}
+	return nil
+}
+
+// writeNoLock encodes the cache and writes it to the persistence; when both
+// support streaming, and there are no expiry times to write along with the
+// elements, the encoder writes directly to the persistence with no
+// intermediate buffer. It must be called with the lock held.
+func (c *Cache[K, V]) writeNoLock() error {
+	c.ioLock.Lock()
+	defer c.ioLock.Unlock()
+	if err := c.guardNoLock(); err != nil {
+		return err
+	}
+	if persistence, ok := c.items(); ok {
+		return c.writeItemsNoLock(persistence)
+	}
+	data, expiries := c.expiringNoLock()
+	if encoding, ok := c.encoding.(StreamingEncoding[K, V]); ok && len(expiries) == 0 {
+		if persistence, ok := c.boundPersistence().(StreamingPersistence); ok {
+			if err := c.streamNoLock(encoding, persistence, data); err != nil {
+				return err
+			}
+			return c.recordVersionNoLock()
+		}
+	}
+
+	done := c.timed("encode")
+	start := time.Now()
+	encoded, err := encodeExpiring(c.encoding, data, expiries)
+	c.pstats.encoded(time.Since(start), err)
+	done()
 	if err != nil {
 		if c.logger != nil {
 			c.logger.Error("error encoding cache", "error", err)
@@ -282,16 +1240,46 @@ func (c *Cache[K, V]) storeNoLock(force bool) error {
 		return err
 	}
 
-	err = c.persistence.Write(data)
+	done = c.timed("write")
+	start = time.Now()
+	err = c.boundPersistence().Write(encoded)
+	c.pstats.written(time.Since(start), err)
+	done()
 	if err != nil {
 		if c.logger != nil {
 			c.logger.Error("error persisting cache", "error", err)
 		}
 		return err
 	}
+	return c.recordVersionNoLock()
+}
 
-	if c.logger != nil {
-		c.logger.Debug("cache stored with no lock acquired")
+// streamNoLock encodes the given data directly into the persistence writer;
+// it must be called with the lock held.
+func (c *Cache[K, V]) streamNoLock(encoding StreamingEncoding[K, V], persistence StreamingPersistence, data map[K]V) (err error) {
+	defer c.timed("stream")()
+	defer func(start time.Time) {
+		c.pstats.streamed(time.Since(start), err)
+	}(time.Now())
+	w, err := persistence.Writer()
+	if err != nil {
+		if c.logger != nil {
+			c.logger.Error("error opening persistence writer", "error", err)
+		}
+		return err
+	}
+	if err = encoding.EncodeTo(w, data); err != nil {
+		abort(w)
+		if c.logger != nil {
+			c.logger.Error("error streaming cache", "error", err)
+		}
+		return err
+	}
+	if err = w.Close(); err != nil {
+		if c.logger != nil {
+			c.logger.Error("error persisting cache", "error", err)
+		}
+		return err
 	}
 	return nil
 }
@@ -304,30 +1292,144 @@ func (c *Cache[K, V]) loadNoLock() error {
 		c.logger.Debug("loading the cache without acquiring the lock")
 	}
 
-	data, err := c.persistence.Read()
+	m, expiries, err := c.read()
+	if err != nil {
+		return err
+	}
+	c.swapNoLock(m, expiries)
+	return nil
+}
+
+// read reads back and decodes the data from persistence, applying the load
+// transform; it does not need the lock, since it only serialises with other
+// accesses to the persistence.
+func (c *Cache[K, V]) read() (map[K]V, map[K]time.Time, error) {
+	c.ioLock.Lock()
+	defer c.ioLock.Unlock()
+	m, expiries, err := c.readNoLock()
 	if err != nil {
+		return nil, nil, err
+	}
+	return transform(m, c.loadTransform), expiries, nil
+}
+
+// swapNoLock replaces the contents of the Cache with the loaded data and
+// the expiry times of its elements, leaving out those already expired; it
+// must be called with the write lock held.
+func (c *Cache[K, V]) swapNoLock(m map[K]V, expiries map[K]time.Time) {
+	c.expiries = map[K]time.Time{}
+	now := c.clock()
+	for k, t := range expiries {
+		if _, ok := m[k]; !ok {
+			continue
+		}
+		if !now.Before(t) {
+			delete(m, k)
+			continue
+		}
+		c.expiries[k] = t
+	}
+	c.resetNoLock(m)
+	c.meta = nil
+	c.resetEvictionNoLock()
+	c.reinternNoLock()
+	if c.accessTracking {
+		c.accessed = map[K]time.Time{}
+	}
+	c.peak = len(m)
+	c.persisted.Store(true)
+	c.resetDirtyKeys()
+
+	if c.logger != nil {
+		c.logger.Debug("cache loaded with no lock acquired")
+	}
+}
+
+// readNoLock reads back the data from persistence, migrating and decoding
+// it into a new map, so that the store is only replaced once the data has
+// been decoded in full, along with the expiry times of its elements; it
+// must be called with the I/O lock held.
+func (c *Cache[K, V]) readNoLock() (map[K]V, map[K]time.Time, error) {
+	if persistence, ok := c.items(); ok {
+		m, expiries, err := c.readItemsNoLock(persistence)
+		if err != nil && c.logger != nil {
+			c.logger.Error("error reading cache elements from persistence", "error", err)
+		}
+		return m, expiries, err
+	}
+
+	if err := c.recordVersionNoLock(); err != nil {
+		return nil, nil, err
+	}
+	var (
+		data     []byte
+		err      error
+		m        map[K]V
+		expiries map[K]time.Time
+		decoded  bool
+	)
+	done := c.timed("read")
+	if p, ok := c.boundPersistence().(ValidatingPersistence); ok {
+		// decode each copy, so that those failing are passed over
+		data, err = p.ReadValid(func(data []byte) error {
+			var err error
+			m, expiries, err = c.decodeNoLock(data)
+			return err
+		})
+		decoded = err == nil
+	} else {
+		data, err = c.boundPersistence().Read()
+	}
+	done()
+	if errors.Is(err, ErrNoData) {
+		if c.logger != nil {
+			c.logger.Debug("no cache data in persistence", "error", err)
+		}
+		return nil, nil, err
+	} else if err != nil {
 		if c.logger != nil {
 			c.logger.Error("error reading cache data from persistence", "error", err)
 		}
-		return err
+		return nil, nil, err
+	}
+	if decoded {
+		return m, expiries, nil
+	}
+	return c.decodeNoLock(data)
+}
+
+// decodeNoLock migrates and decodes the data read back from persistence into
+// a new map, along with the expiry times of its elements; it must be called
+// with the write lock held.
+func (c *Cache[K, V]) decodeNoLock(data []byte) (map[K]V, map[K]time.Time, error) {
+	var err error
+	if len(data) == 0 {
+		// e.g. a key that does not exist yet in a remote store
+		if c.logger != nil {
+			c.logger.Debug("empty cache data in persistence")
+		}
+		return map[K]V{}, nil, nil
+	}
+
+	if c.copyOnLoad {
+		data = bytes.Clone(data)
 	}
 
 	if c.logger != nil {
 		c.logger.Debug("data read, decoding...")
 	}
 
-	m, err := c.encoding.Decode((data))
+	done := c.timed("decode")
+	m, expiries, err := c.decodeMigrating(c.encoding, data)
+	done()
 	if err != nil {
 		if c.logger != nil {
 			c.logger.Error("error decoding the cache from data", "error", err)
 		}
-		return err
+		return nil, nil, err
 	}
-
-	c.store = m
-
-	if c.logger != nil {
-		c.logger.Debug("cache loaded with no lock acquired")
+	if err = c.checkDecoded(len(m)); err != nil {
+		return nil, nil, err
 	}
-	return nil
+	return m, expiries, nil
 }
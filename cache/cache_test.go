@@ -1,9 +1,17 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/exp/slog"
@@ -420,3 +428,716 @@ func TestCacheTOML(t *testing.T) {
 	assert.Equal(t, len(keys), 0, "The number of keys is invalid.")
 	assert.ElementsMatch(t, keys, []string{}, "The key set is invalid.")
 }
+
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestCacheShrink(t *testing.T) {
+
+	const size = 1 << 18
+
+	cache := New[int, int]()
+	for i := 0; i < size; i++ {
+		cache.Put(i, i)
+	}
+	for i := 0; i < size*9/10; i++ {
+		cache.Delete(i)
+	}
+	assert.Equal(t, cache.Size(), size-size*9/10, "The cache size is invalid.")
+
+	before := heapAlloc()
+	cache.Shrink()
+	after := heapAlloc()
+	assert.Less(t, after, before/2, "Shrink should have released most of the map memory.")
+
+	// the elements must survive the rebuild
+	assert.Equal(t, cache.Size(), size-size*9/10, "The cache size is invalid.")
+	v, ok := cache.Get(size - 1)
+	assert.Equal(t, ok, true, "The value should be present in the cache.")
+	assert.Equal(t, v, size-1, "The value should be as expected.")
+
+	// now check that auto-shrinking kicks in when deleting
+	cache = New(WithShrinkThreshold[int, int](0.25))
+	for i := 0; i < size; i++ {
+		cache.Put(i, i)
+	}
+	for i := 0; i < size*9/10; i++ {
+		cache.Delete(i)
+	}
+	assert.Less(t, cache.peak, size/2, "The cache should have been shrunk automatically.")
+	assert.Equal(t, cache.Size(), size-size*9/10, "The cache size is invalid.")
+}
+
+func TestCacheTimingHook(t *testing.T) {
+
+	durations := map[string][]time.Duration{}
+
+	cache := New(
+		WithPersistence[string, string](&File{Path: filepath.Join(t.TempDir(), "test.yaml")}),
+		WithEncoding[string, string](&YAML[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithTimingHook[string, string](func(op string, d time.Duration) {
+			durations[op] = append(durations[op], d)
+		}),
+	)
+
+	cache.Put("a", "aaa")
+	cache.Replace("b", "bbb")
+	cache.Get("a")
+	cache.Delete("b")
+	cache.Store()
+	cache.Load()
+	cache.Clear()
+
+	for _, op := range []string{"put", "replace", "get", "delete", "store", "load", "clear", "read", "decode"} {
+		assert.Len(t, durations[op], 1, "The hook should have fired once for %q.", op)
+	}
+	// put, replace, delete, store and clear all write to persistence
+	assert.Len(t, durations["encode"], 5, "The hook should have fired for each encoding.")
+	assert.Len(t, durations["write"], 5, "The hook should have fired for each write.")
+	for op, ds := range durations {
+		for _, d := range ds {
+			assert.GreaterOrEqual(t, d, time.Duration(0), "The duration of %q should not be negative.", op)
+			assert.Less(t, d, time.Second, "The duration of %q should be plausible.", op)
+		}
+	}
+}
+
+func TestCacheOnLoad(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	writer := New(
+		WithPersistence[string, int](&File{Path: path}),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithPolicy[string, int](&Never{}),
+	)
+	for i, k := range []string{"a", "b", "c"} {
+		writer.Put(k, i)
+	}
+	assert.NoError(t, writer.Store(), "Storing the cache should not fail.")
+
+	calls := []int{}
+	var cache *Cache[string, int]
+	cache = New(
+		WithPersistence[string, int](&File{Path: path}),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithOnLoad[string, int](func(loaded int) {
+			// the hook must be able to access the cache
+			assert.Equal(t, cache.Size(), loaded, "The hook should see the loaded cache.")
+			calls = append(calls, loaded)
+		}),
+	)
+	assert.NoError(t, cache.Load(), "Loading the cache should not fail.")
+	assert.Equal(t, calls, []int{3}, "The hook should have fired once with the number of entries.")
+
+	failing := New(
+		WithPersistence[string, int](&File{Path: filepath.Join(t.TempDir(), "missing.json")}),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithOnLoad[string, int](func(loaded int) {
+			t.Error("The hook should not fire on a failed load.")
+		}),
+	)
+	assert.Error(t, failing.Load(), "Loading a missing file should fail.")
+}
+
+func TestCacheClearNoFlush(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithPolicy[string, int](&Always{}),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	writes := persistence.Writes()
+
+	cache.ClearNoFlush()
+	assert.Equal(t, cache.Size(), 0, "The cache should be empty.")
+	assert.Equal(t, persistence.Writes(), writes, "Clearing should not have persisted the cache.")
+
+	added := cache.PutMany(map[string]int{"b": 3, "c": 4, "d": 5})
+	assert.Equal(t, added, 3, "All the elements should have been added.")
+	assert.Equal(t, persistence.Writes(), writes+1, "The batch should have been persisted once.")
+
+	restored := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+	)
+	restored.Load()
+	assert.True(t, Equal(cache, restored, Eq[int]), "The final state should have been persisted.")
+	_, ok := restored.Get("a")
+	assert.False(t, ok, "The cleared element should not have been persisted.")
+}
+
+func TestCacheCopyTo(t *testing.T) {
+
+	dir := t.TempDir()
+	source := &File{Path: filepath.Join(dir, "test.gob")}
+	cache := New(
+		WithPersistence[string, int](source),
+		WithEncoding[string, int](&GOB[string, int]{}),
+		WithPolicy[string, int](&Always{}),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	before, _ := source.Read()
+
+	target := &File{Path: filepath.Join(dir, "copy.json")}
+	assert.NoError(t, cache.CopyTo(target, &JSON[string, int]{}), "Copying the cache should not fail.")
+	after, _ := source.Read()
+	assert.Equal(t, after, before, "The source persistence should not be affected.")
+
+	restored := New(
+		WithPersistence[string, int](target),
+		WithEncoding[string, int](&JSON[string, int]{}),
+	)
+	assert.NoError(t, restored.Load(), "The copy should be loadable on its own.")
+	assert.True(t, Equal(cache, restored, Eq[int]), "The copy should hold the cache contents.")
+}
+
+func TestCacheReplaceIfPresent(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+	)
+
+	v, ok := cache.ReplaceIfPresent("a", "aaa")
+	assert.False(t, ok, "Absent keys should not be replaced.")
+	assert.Equal(t, v, "", "No previous value should be returned.")
+	assert.Equal(t, cache.Size(), 0, "Absent keys should not be added.")
+	assert.Equal(t, persistence.Writes(), 0, "Nothing should have been persisted.")
+
+	cache.Put("a", "aaa")
+	v, ok = cache.ReplaceIfPresent("a", "AAA")
+	assert.True(t, ok, "Present keys should be replaced.")
+	assert.Equal(t, v, "aaa", "The previous value should be returned.")
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "AAA", "The value should have been updated.")
+	assert.Equal(t, persistence.Writes(), 2, "The update should have been persisted.")
+}
+
+func TestCacheReplaceIf(t *testing.T) {
+
+	type versioned struct {
+		Version int
+		Value   string
+	}
+	newer := func(v versioned) func(versioned, bool) bool {
+		return func(old versioned, exists bool) bool {
+			return !exists || v.Version > old.Version
+		}
+	}
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, versioned](persistence),
+		WithPolicy[string, versioned](&Always{}),
+	)
+
+	v := versioned{Version: 2, Value: "two"}
+	_, ok := cache.ReplaceIf("a", v, newer(v))
+	assert.True(t, ok, "The first version should be stored.")
+	assert.Equal(t, persistence.Writes(), 1, "The write should have been persisted.")
+
+	stale := versioned{Version: 1, Value: "one"}
+	old, ok := cache.ReplaceIf("a", stale, newer(stale))
+	assert.False(t, ok, "A stale version should be rejected.")
+	assert.Equal(t, old, v, "The previous value should be returned.")
+	current, _ := cache.Get("a")
+	assert.Equal(t, current, v, "The old value should be left intact.")
+	assert.Equal(t, persistence.Writes(), 1, "A rejected write should not be persisted.")
+
+	fresh := versioned{Version: 3, Value: "three"}
+	old, ok = cache.ReplaceIf("a", fresh, newer(fresh))
+	assert.True(t, ok, "A newer version should be stored.")
+	assert.Equal(t, old, v, "The previous value should be returned.")
+	current, _ = cache.Get("a")
+	assert.Equal(t, current, fresh, "The value should have been replaced.")
+}
+
+func TestCacheDeleteDurable(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Never{}),
+	)
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+
+	v, ok, err := cache.DeleteDurable("a")
+	assert.NoError(t, err, "The deletion should have been persisted.")
+	assert.True(t, ok, "The value should have been present.")
+	assert.Equal(t, v, "aaa", "The deleted value should be returned.")
+	assert.Equal(t, persistence.Writes(), 1, "The deletion should have been flushed despite the policy.")
+
+	persistence.err = errors.New("backend down")
+	_, ok, err = cache.DeleteDurable("b")
+	assert.EqualError(t, err, "backend down", "The persistence error should be returned.")
+	assert.True(t, ok, "The value should have been present.")
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "The value should have been removed from memory anyway.")
+}
+
+func TestCacheBulkLoad(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[int, int](persistence),
+		WithEncoding[int, int](&JSON[int, int]{}),
+		WithPolicy[int, int](&Always{}),
+	)
+	cache.Put(0, -1)
+	writes := persistence.Writes()
+
+	err := cache.BulkLoad(func(put func(k, v int)) {
+		for i := 0; i < 1000; i++ {
+			put(i, i)
+		}
+	})
+	assert.NoError(t, err, "Bulk loading should not fail.")
+	assert.Equal(t, persistence.Writes(), writes+1, "Exactly one write should have occurred.")
+	assert.Equal(t, cache.Size(), 1000, "All the elements should have been loaded.")
+	v, _ := cache.Get(0)
+	assert.Equal(t, v, 0, "Existing elements should have been replaced.")
+
+	restored := New(
+		WithPersistence[int, int](persistence),
+		WithEncoding[int, int](&JSON[int, int]{}),
+	)
+	restored.Load()
+	assert.True(t, Equal(cache, restored, Eq[int]), "The final state should have been persisted.")
+}
+
+func benchmarkLoad(b *testing.B, load func(c *Cache[int, int], n int)) {
+	const entries = 100_000
+	for i := 0; i < b.N; i++ {
+		cache := New(
+			WithPersistence[int, int](&Discard{}),
+			WithPolicy[int, int](&Batched{Size: 10_000}),
+		)
+		load(cache, entries)
+	}
+}
+
+func BenchmarkPuts(b *testing.B) {
+	benchmarkLoad(b, func(c *Cache[int, int], n int) {
+		for i := 0; i < n; i++ {
+			c.Put(i, i)
+		}
+	})
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	benchmarkLoad(b, func(c *Cache[int, int], n int) {
+		c.BulkLoad(func(put func(k, v int)) {
+			for i := 0; i < n; i++ {
+				put(i, i)
+			}
+		})
+	})
+}
+
+type name string
+
+func (n name) String() string {
+	return "name " + string(n)
+}
+
+func TestCacheGetE(t *testing.T) {
+
+	cache := New[string, int]()
+	cache.Put("a", 1)
+	v, err := cache.GetE("a")
+	assert.NoError(t, err, "Present keys should not be reported as errors.")
+	assert.Equal(t, v, 1, "The value should be returned.")
+	_, err = cache.GetE("b")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Absent keys should be reported as not found.")
+
+	named := New[name, int]()
+	_, err = named.GetE("b")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "Absent keys should be reported as not found.")
+	assert.EqualError(t, err, "key not found: name b", "The key should be named in the error.")
+}
+
+// pooled is a persistence that returns its own buffer from Read.
+type pooled struct {
+	buffer []byte
+}
+
+func (p *pooled) Write(data []byte) error {
+	p.buffer = append(p.buffer[:0], data...)
+	return nil
+}
+
+func (p *pooled) Read() ([]byte, error) {
+	return p.buffer, nil
+}
+
+// raw is an encoding whose decoded values refer to the data they are
+// decoded from.
+type raw struct{}
+
+func (raw) Encode(data map[string][]byte) ([]byte, error) {
+	lines := []string{}
+	for k, v := range data {
+		lines = append(lines, k+"="+string(v))
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+func (raw) Decode(data []byte) (map[string][]byte, error) {
+	m := map[string][]byte{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if k, v, ok := bytes.Cut(line, []byte("=")); ok {
+			m[string(k)] = v
+		}
+	}
+	return m, nil
+}
+
+func TestCacheCopyOnLoad(t *testing.T) {
+
+	for _, copied := range []bool{false, true} {
+		persistence := &pooled{}
+		options := []Option[string, []byte]{
+			WithPersistence[string, []byte](persistence),
+			WithEncoding[string, []byte](raw{}),
+		}
+		if copied {
+			options = append(options, WithCopyOnLoad[string, []byte]())
+		}
+		cache := New(options...)
+		persistence.Write([]byte("a=aaa"))
+		assert.NoError(t, cache.Load(), "Loading the cache should not fail.")
+
+		// the persistence reuses its buffer
+		persistence.Write([]byte("b=bbb"))
+		v, _ := cache.Get("a")
+		if copied {
+			assert.Equal(t, string(v), "aaa", "The cache data should not be affected.")
+		} else {
+			assert.Equal(t, string(v), "bbb", "The cache data should share the buffer.")
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+
+	type user struct {
+		ID     int
+		Active bool
+	}
+
+	cache := New[string, user]()
+	cache.Put("alice", user{ID: 1, Active: true})
+	cache.Put("bob", user{ID: 2})
+	cache.Put("carol", user{ID: 3, Active: true})
+
+	ids := Query(cache, func(_ string, v user) bool { return v.Active }, func(_ string, v user) int { return v.ID })
+	assert.ElementsMatch(t, ids, []int{1, 3}, "Only the active users should be returned.")
+
+	names := Query(cache, nil, func(k string, _ user) string { return k })
+	assert.ElementsMatch(t, names, []string{"alice", "bob", "carol"}, "All the users should be returned.")
+
+	none := Query(cache, func(string, user) bool { return false }, func(k string, _ user) string { return k })
+	assert.Empty(t, none, "No users should be returned.")
+}
+
+func TestCacheEqual(t *testing.T) {
+
+	a := New[string, int]()
+	b := New[string, int]()
+	assert.True(t, Equal(a, b, Eq[int]), "Empty caches should be equal.")
+
+	for i, k := range []string{"a", "b", "c"} {
+		a.Put(k, i)
+		b.Put(k, i)
+	}
+	assert.True(t, Equal(a, b, Eq[int]), "The caches should be equal.")
+	assert.True(t, Equal(a, b, nil), "The caches should be equal.")
+	assert.True(t, Equal(a, a, Eq[int]), "A cache should be equal to itself.")
+
+	// a single differing value
+	b.Replace("b", 42)
+	assert.False(t, Equal(a, b, Eq[int]), "The caches should differ by value.")
+	assert.True(t, Equal(a, b, func(int, int) bool { return true }), "The comparison function should be honoured.")
+
+	// a differing key set with the same size
+	b.Delete("b")
+	b.Put("d", 1)
+	assert.False(t, Equal(a, b, Eq[int]), "The caches should differ by key.")
+	assert.False(t, Equal(a, nil, Eq[int]), "A cache should not be equal to nil.")
+}
+
+func TestCacheTryGetTryPut(t *testing.T) {
+
+	cache := New[string, string]()
+	cache.Put("a", "aaa")
+
+	v, ok, acquired := cache.TryGet("a")
+	assert.Equal(t, acquired, true, "The lock should have been acquired.")
+	assert.Equal(t, ok, true, "The value should be present in the cache.")
+	assert.Equal(t, v, "aaa", "The value should be as expected.")
+
+	ok, acquired = cache.TryPut("b", "bbb")
+	assert.Equal(t, acquired, true, "The lock should have been acquired.")
+	assert.Equal(t, ok, true, "The value should have been put.")
+
+	// simulate a writer holding the lock, e.g. during a flush
+	cache.lock.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, acquired := cache.TryGet("a")
+		assert.Equal(t, acquired, false, "The lock should not have been acquired.")
+		_, acquired = cache.TryPut("c", "ccc")
+		assert.Equal(t, acquired, false, "The lock should not have been acquired.")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TryGet and TryPut should not block")
+	}
+	cache.lock.Unlock()
+
+	_, ok = cache.Get("c")
+	assert.Equal(t, ok, false, "The value should not have been put.")
+}
+
+func TestNewDefaultFileCache(t *testing.T) {
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	root, err := os.UserCacheDir()
+	assert.NoError(t, err, "The user cache directory should be available.")
+
+	cache, err := NewDefaultFileCache[string, string]("yagc-test", "json", WithPolicy[string, string](&Always{}))
+	assert.NoError(t, err, "Creating the cache should succeed.")
+	info, err := os.Stat(filepath.Join(root, "yagc-test"))
+	assert.NoError(t, err, "The cache directory should have been created.")
+	assert.True(t, info.IsDir(), "The cache directory should be a directory.")
+
+	cache.Put("a", "aaa")
+	path := cache.persistence.(*File).Path
+	assert.Equal(t, path, filepath.Join(root, "yagc-test", "cache.json"), "The cache file should be under the user cache directory.")
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "The cache file should have been written.")
+
+	_, err = NewDefaultFileCache[string, string]("yagc-test", "xml")
+	assert.Error(t, err, "Unsupported formats should be rejected.")
+}
+
+// slow is a JSON encoding whose decoding blocks until released.
+type slow struct {
+	JSON[string, string]
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slow) Decode(data []byte) (map[string]string, error) {
+	close(s.started)
+	<-s.release
+	return s.JSON.Decode(data)
+}
+
+func TestCacheLoadOutsideLock(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"a": "new"}`), 0644), "Writing the file should succeed.")
+	encoding := &slow{started: make(chan struct{}), release: make(chan struct{})}
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](encoding),
+	)
+	cache.Put("a", "old")
+
+	loaded := make(chan error)
+	go func() { loaded <- cache.Load() }()
+	<-encoding.started
+	done := make(chan string)
+	go func() {
+		v, _ := cache.Get("a")
+		done <- v
+	}()
+	select {
+	case v := <-done:
+		assert.Equal(t, v, "old", "Reads during the decode should see the old data.")
+	case <-time.After(time.Second):
+		t.Fatal("Reads should not be stalled by a slow decode.")
+	}
+
+	close(encoding.release)
+	assert.NoError(t, <-loaded, "Loading should succeed.")
+	v, _ := cache.Get("a")
+	assert.Equal(t, v, "new", "Reads after the swap should see the new data.")
+}
+
+func TestCachePullAndMerge(t *testing.T) {
+
+	overlapping := func() (*Cache[string, string], *Cache[string, string]) {
+		c, other := New[string, string](), New[string, string]()
+		c.Put("shared", "existing")
+		c.Put("mine", "mmm")
+		other.Put("shared", "incoming")
+		other.Put("theirs", "ttt")
+		return c, other
+	}
+
+	pulled, other := overlapping()
+	assert.NoError(t, pulled.Pull(other), "Pulling should succeed.")
+	assert.ElementsMatch(t, pulled.Keys(), []string{"shared", "mine", "theirs"}, "Pulling should add the missing elements.")
+	v, _ := pulled.Get("shared")
+	assert.Equal(t, v, "incoming", "Pulling should replace the existing elements.")
+
+	merged, other := overlapping()
+	assert.NoError(t, merged.Merge(other), "Merging should succeed.")
+	assert.ElementsMatch(t, merged.Keys(), []string{"shared", "mine", "theirs"}, "Merging should add the missing elements.")
+	v, _ = merged.Get("shared")
+	assert.Equal(t, v, "existing", "Merging should preserve the existing elements.")
+
+	assert.Error(t, merged.Pull(nil), "Pulling from a nil cache should fail.")
+	assert.Error(t, merged.Merge(nil), "Merging with a nil cache should fail.")
+}
+
+func TestCacheValuesAndEntries(t *testing.T) {
+
+	cache := New[string, int]()
+	assert.Empty(t, cache.Values(), "An empty cache should have no values.")
+	assert.Empty(t, cache.Entries(), "An empty cache should have no entries.")
+
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("c", 3)
+
+	keys, values, entries := cache.Keys(), cache.Values(), cache.Entries()
+	assert.Len(t, values, len(keys), "There should be a value for each key.")
+	assert.Len(t, entries, len(keys), "There should be an entry for each key.")
+	assert.ElementsMatch(t, values, []int{1, 2, 3}, "The values are invalid.")
+	for _, k := range keys {
+		v, _ := cache.Get(k)
+		assert.Equal(t, entries[k], v, "The entry for %s is invalid.", k)
+	}
+
+	// snapshots do not see later changes, nor do changes to them affect the cache
+	cache.Put("d", 4)
+	cache.Delete("a")
+	entries["e"] = 5
+	assert.Len(t, values, 3, "The values should be a snapshot.")
+	assert.Equal(t, entries["a"], 1, "The entries should be a snapshot.")
+	assert.ElementsMatch(t, cache.Keys(), []string{"b", "c", "d"}, "Changing the entries should not affect the cache.")
+}
+
+func TestCacheValuesAndEntriesExpiry(t *testing.T) {
+
+	now := time.Now()
+	cache := New[string, int]()
+	cache.clock = func() time.Time { return now }
+	cache.Put("a", 1)
+	cache.PutWithTTL("b", 2, time.Minute)
+	cache.PutWithTTL("c", 3, time.Hour)
+	now = now.Add(2 * time.Minute)
+
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "c"}, "Expired elements should not be listed.")
+	assert.ElementsMatch(t, cache.Values(), []int{1, 3}, "Expired elements should not be listed.")
+	assert.Equal(t, cache.Entries(), map[string]int{"a": 1, "c": 3}, "Expired elements should not be listed.")
+	assert.ElementsMatch(t, Query(cache, nil, func(k string, _ int) string { return k }), []string{"a", "c"}, "Expired elements should not be queried.")
+	other := New[string, int]()
+	other.Put("a", 1)
+	other.Put("c", 3)
+	assert.True(t, Equal(cache, other, Eq[int]), "Expired elements should not be compared.")
+	streamed := map[string]int{}
+	for e := range cache.StreamEntries(context.Background()) {
+		streamed[e.Key] = e.Value
+	}
+	assert.Equal(t, streamed, map[string]int{"a": 1, "c": 3}, "Expired elements should not be streamed.")
+}
+
+func TestCacheRange(t *testing.T) {
+
+	cache := New[string, int]()
+	for i := 0; i < 10; i++ {
+		cache.Put(fmt.Sprintf("key-%d", i), i)
+	}
+
+	visited := map[string]int{}
+	cache.Range(func(k string, v int) bool {
+		visited[k] = v
+		return true
+	})
+	assert.Equal(t, visited, cache.Entries(), "All the entries should be visited.")
+
+	count := 0
+	cache.Range(func(string, int) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, count, 1, "Ranging should stop after the first entry.")
+
+	count = 0
+	New[string, int]().Range(func(string, int) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, count, 0, "An empty cache should have nothing to visit.")
+
+	now := time.Now()
+	cache.clock = func() time.Time { return now }
+	cache.PutWithTTL("expiring", 10, time.Minute)
+	now = now.Add(2 * time.Minute)
+	visited = map[string]int{}
+	cache.Range(func(k string, v int) bool {
+		visited[k] = v
+		return true
+	})
+	assert.NotContains(t, visited, "expiring", "Expired entries should not be visited.")
+	assert.Len(t, visited, 10, "All the unexpired entries should be visited.")
+}
+
+func TestCacheBulkReads(t *testing.T) {
+
+	now := time.Now()
+	loads := 0
+	cache := New(WithLoader(func(string) (int, bool, error) {
+		loads++
+		return 0, false, nil
+	}))
+	cache.clock = func() time.Time { return now }
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.PutWithTTL("c", 3, time.Minute)
+
+	assert.True(t, cache.Contains("a"), "A present key should be contained.")
+	assert.False(t, cache.Contains("missing"), "A missing key should not be contained.")
+	assert.Equal(t, cache.GetMulti([]string{"a", "c", "missing"}), map[string]int{"a": 1, "c": 3}, "Only the present keys should be returned.")
+	assert.Empty(t, cache.GetMulti(nil), "No keys should return no elements.")
+
+	now = now.Add(time.Hour)
+	assert.False(t, cache.Contains("c"), "An expired key should not be contained.")
+	assert.Equal(t, cache.GetMulti([]string{"a", "b", "c"}), map[string]int{"a": 1, "b": 2}, "Expired keys should not be returned.")
+	assert.Equal(t, loads, 0, "Bulk reads should not call the loader.")
+	assert.Equal(t, cache.Stats().Hits, int64(4), "Each returned key should count as a hit.")
+	assert.Equal(t, cache.Stats().Misses, int64(2), "Each missing key should count as a miss.")
+
+	assert.Equal(t, cache.PutMulti(map[string]int{"a": 10, "c": 30, "d": 40}), 2, "Only the missing or expired keys should be stored.")
+	assert.Equal(t, cache.GetMulti([]string{"a", "c", "d"}), map[string]int{"a": 1, "c": 30, "d": 40}, "Bulk puts should not overwrite present keys.")
+
+	persistence := &memory{}
+	persisted := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithPolicy[string, int](&Always{}),
+	)
+	persisted.Put("a", 1)
+	assert.Equal(t, persisted.PutMulti(map[string]int{"a": 10, "b": 2, "c": 3}), 2, "Only the missing keys should be stored.")
+	assert.Equal(t, persistence.Writes(), 2, "Bulk puts should persist the cache once.")
+	assert.Equal(t, persisted.PutMulti(map[string]int{"a": 10, "b": 20}), 0, "Present keys should not be stored.")
+	assert.Equal(t, persistence.Writes(), 2, "Bulk puts storing nothing should not persist the cache.")
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"errors"
+)
+
+// Close shuts the Cache down: it stops all the background goroutines and
+// timers (periodic saves, expiration sweeps, deferred flushes, circuit
+// breaker probes, grace period reaping), waits for any background load to
+// complete, and then synchronously flushes the contents to persistent
+// storage, bypassing the policy and the circuit breaker; after a failed
+// strict load the flush is skipped and ErrLoadFailed is returned instead.
+// It returns the error of the final flush, if any, so that callers can tell
+// whether the shutdown was clean; calling Close more than once returns the
+// same result.
+func (c *Cache[K, V]) Close() error {
+	c.closeOnce.Do(func() {
+		if c.logger != nil {
+			c.logger.Debug("closing cache")
+		}
+		c.stopBackground()
+
+		defer c.storeLock()()
+		if c.pristineNoLock() {
+			if c.logger != nil {
+				c.logger.Debug("lazy persistence, nothing to flush on close")
+			}
+			return
+		}
+		err := c.autoWriteNoLock()
+		if errors.Is(err, ErrLoadFailed) {
+			if c.logger != nil {
+				c.logger.Warn("strict load, not flushing cache on close after a failed load")
+			}
+			c.closeErr = err
+			return
+		}
+		c.flushAttempted(err)
+		c.checkDiskFull(err)
+		if err != nil {
+			if c.logger != nil {
+				c.logger.Error("error flushing cache on close", "error", err)
+			}
+			c.closeErr = err
+			return
+		}
+		c.flushed()
+		if c.logger != nil {
+			c.logger.Debug("cache flushed on close")
+		}
+	})
+	return c.closeErr
+}
+
+// stopBackground stops all the goroutines and timers working on the Cache
+// in the background, and waits for pending background loads.
+func (c *Cache[K, V]) stopBackground() {
+	c.stoppersLock.Lock()
+	stoppers := c.stoppers
+	c.stoppers = nil
+	c.stoppersLock.Unlock()
+	for _, stop := range stoppers {
+		stop()
+	}
+
+	c.deferLock.Lock()
+	if c.deferTimer != nil {
+		c.deferTimer.Stop()
+		c.deferTimer = nil
+	}
+	c.deferLock.Unlock()
+
+	c.breakerLock.Lock()
+	if c.breakerTimer != nil {
+		c.breakerTimer.Stop()
+		c.breakerTimer = nil
+	}
+	c.breakerLock.Unlock()
+
+	c.lock.Lock()
+	if c.graceTimer != nil {
+		c.graceTimer.Stop()
+		c.graceTimer = nil
+	}
+	c.lock.Unlock()
+
+	c.background.Wait()
+}
+
+// onClose registers a function stopping a background goroutine on Close.
+func (c *Cache[K, V]) onClose(stop func()) {
+	c.stoppersLock.Lock()
+	defer c.stoppersLock.Unlock()
+	c.stoppers = append(c.stoppers, stop)
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheClose(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+	)
+	cache.Put("a", "aaa")
+	assert.NoError(t, cache.Close(), "Closing with a working persistence should succeed.")
+	data, _ := persistence.Read()
+	assert.Contains(t, string(data), "aaa", "The final flush should have persisted the contents.")
+}
+
+func TestCacheCloseError(t *testing.T) {
+
+	baseline := runtime.NumGoroutine()
+	release := make(chan struct{})
+	persistence := &memory{err: errors.New("backend down")}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithCircuitBreaker[string, string](1, 5*time.Millisecond),
+		WithDeleteGrace[string, string](time.Hour),
+		WithLoaderMode[string, string](AsyncLoad),
+		WithLoader(func(k string) (string, bool, error) {
+			<-release
+			return "loaded", true, nil
+		}),
+	)
+	cache.SaveEvery(time.Millisecond)
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+	cache.Delete("b")
+	cache.Get("c")
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+
+	err := cache.Close()
+	assert.ErrorContains(t, err, "backend down", "A failed final flush should be reported by Close.")
+	assert.Equal(t, cache.Close(), err, "Closing again should return the same error.")
+	value, _ := cache.Get("c")
+	assert.Equal(t, value, "loaded", "Close should wait for background loads.")
+
+	persistence.lock.Lock()
+	persistence.err = nil
+	persistence.lock.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 0, "Nothing should be written in the background after Close.")
+	assert.LessOrEqual(t, runtime.NumGoroutine(), baseline, "All background goroutines should have stopped.")
+}
+
+func TestCacheCloseStrictLoad(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	corrupt := []byte(`{"c": "ccc", "d": `)
+	os.WriteFile(path, corrupt, 0644)
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithStrictLoad[string, string](),
+	)
+	assert.Error(t, cache.Load(), "Loading a corrupt file should fail.")
+	cache.Put("a", "aaa")
+
+	assert.ErrorIs(t, cache.Close(), ErrLoadFailed, "Close should report the failed load.")
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, data, corrupt, "The corrupt file should not have been overwritten on close.")
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Compressed wraps an Encoding, gzip-compressing the encoded data and
+// decompressing it before it is decoded; use NewCompressed to create one.
+type Compressed[K comparable, V any] struct {
+	encoding Encoding[K, V]
+	level    int
+}
+
+// NewCompressed returns a Compressed encoding wrapping the given one, with
+// the given gzip compression level (e.g. gzip.BestCompression, or
+// gzip.DefaultCompression).
+func NewCompressed[K comparable, V any](encoding Encoding[K, V], level int) (*Compressed[K, V], error) {
+	if encoding == nil {
+		return nil, fmt.Errorf("no encoding to compress")
+	}
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid gzip compression level %d", level)
+	}
+	return &Compressed[K, V]{encoding: encoding, level: level}, nil
+}
+
+// Encode encodes cache data with the wrapped encoding, and compresses the
+// result.
+func (c *Compressed[K, V]) Encode(data map[K]V) ([]byte, error) {
+	payload, err := c.encoding.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.compress(payload)
+}
+
+// encodeExpiring encodes cache data along with its expiry times with the
+// wrapped encoding, if it can carry them, and compresses the result.
+func (c *Compressed[K, V]) encodeExpiring(data map[K]V, expiries map[K]time.Time) ([]byte, error) {
+	payload, err := encodeExpiring(c.encoding, data, expiries)
+	if err != nil {
+		return nil, err
+	}
+	return c.compress(payload)
+}
+
+// Decode decompresses cache data and decodes it with the wrapped encoding.
+func (c *Compressed[K, V]) Decode(data []byte) (map[K]V, error) {
+	payload, err := decompressPayload(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.encoding.Decode(payload)
+}
+
+// decodeExpiring decompresses cache data and decodes it, along with its
+// expiry times, with the wrapped encoding.
+func (c *Compressed[K, V]) decodeExpiring(data []byte) (map[K]V, map[K]time.Time, error) {
+	payload, err := decompressPayload(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodeExpiring(c.encoding, payload)
+}
+
+// unwrap returns the wrapped encoding.
+func (c *Compressed[K, V]) unwrap() Encoding[K, V] {
+	return c.encoding
+}
+
+// unwrapData decompresses cache data for the wrapped encoding.
+func (c *Compressed[K, V]) unwrapData(data []byte) ([]byte, error) {
+	return decompressPayload(data)
+}
+
+// compress compresses the encoded data.
+func (c *Compressed[K, V]) compress(payload []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buffer, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decompressPayload decompresses the encoded data.
+func decompressPayload(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing data: %w", err)
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing data: %w", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"compress/gzip"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressed(t *testing.T) {
+
+	data := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		data[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("a moderately long value for key %d", i)
+	}
+
+	for _, format := range []string{"json", "yaml", "toml", "gob"} {
+		encoding, err := NewEncoding[string, string](format)
+		assert.NoError(t, err, "Creating the encoding should succeed.")
+		compressed, err := NewCompressed(encoding, gzip.BestCompression)
+		assert.NoError(t, err, "Creating the compressed encoding should succeed.")
+
+		plain, err := encoding.Encode(data)
+		assert.NoError(t, err, "Encoding should succeed.")
+		packed, err := compressed.Encode(data)
+		assert.NoError(t, err, "Compressed encoding should succeed.")
+		assert.Less(t, len(packed), len(plain), "Compressed data should be smaller in %s format.", format)
+
+		decoded, err := compressed.Decode(packed)
+		assert.NoError(t, err, "Compressed decoding should succeed.")
+		assert.Equal(t, decoded, data, "Decoded data should match the original in %s format.", format)
+	}
+
+	_, err := NewCompressed[string, string](&JSON[string, string]{}, 42)
+	assert.Error(t, err, "An invalid compression level should be rejected.")
+	_, err = NewCompressed[string, string](nil, gzip.DefaultCompression)
+	assert.Error(t, err, "A missing encoding should be rejected.")
+
+	compressed, _ := NewCompressed[string, string](&JSON[string, string]{}, gzip.DefaultCompression)
+	_, err = compressed.Decode([]byte(`{"a":"aaa"}`))
+	assert.Error(t, err, "Uncompressed data should not be decoded.")
+}
+
+func TestCacheCompressed(t *testing.T) {
+
+	encoding, _ := NewCompressed[string, int](&JSON[string, int]{}, gzip.DefaultCompression)
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](encoding),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	cache2 := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](encoding),
+	)
+	assert.NoError(t, cache2.Load(), "Loading should succeed.")
+	value, ok := cache2.Get("b")
+	assert.True(t, ok, "The value should be found.")
+	assert.Equal(t, value, 2, "The value is invalid.")
+}
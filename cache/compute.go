@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrComputePanic is returned (wrapped) by GetOrCompute to the callers
+// waiting for a compute function that panicked.
+var ErrComputePanic = errors.New("compute function panicked")
+
+// GetOrCompute returns the element under the given key if it is in the
+// Cache; otherwise it invokes fn to compute its value and stores it, unless
+// some other value was stored in the meantime, returning the value in the
+// Cache. Concurrent calls for the same missing key wait for a single
+// invocation of fn and share its result; if fn fails, nothing is stored, all
+// waiters get its error and the next call tries again; if fn panics, the
+// panic is propagated to the caller that invoked it, while the others get
+// ErrComputePanic. A read-only Cache
+// (see ReadOnly) returns the computed value without storing it.
+func (c *Cache[K, V]) GetOrCompute(k K, fn func(k K) (V, error)) (V, error) {
+	return c.getOrCompute(k, fn, 0, false)
+}
+
+// GetOrComputeWithTTL is like GetOrCompute, but the computed element expires
+// after the given TTL (see PutWithTTL); a TTL that is not positive means no
+// expiry. Concurrent calls for the same missing key, including those to
+// GetOrCompute, share a single computation, and the TTL of the call that
+// started it.
+func (c *Cache[K, V]) GetOrComputeWithTTL(k K, ttl time.Duration, fn func() (V, error)) (V, error) {
+	if fn == nil {
+		var zero V
+		return zero, errors.New("invalid compute function")
+	}
+	return c.getOrCompute(k, func(K) (V, error) { return fn() }, ttl, true)
+}
+
+// getOrCompute implements GetOrCompute and GetOrComputeWithTTL, setting the
+// given TTL on the computed element if expiring.
+func (c *Cache[K, V]) getOrCompute(k K, fn func(k K) (V, error), ttl time.Duration, expiring bool) (V, error) {
+	defer c.timed("get")()
+	if c.logger != nil {
+		c.logger.Debug("getting or computing value", "key", k)
+	}
+	if fn == nil {
+		var zero V
+		return zero, errors.New("invalid compute function")
+	}
+	c.lock.RLock()
+	v, ok := c.store.Get(k)
+	ok = ok && !c.expiredNoLock(k, c.clock())
+	c.hits.record(c.clock(), ok)
+	if ok {
+		c.touchNoLock(k)
+	}
+	c.lock.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	c.computingLock.Lock()
+	f, ok := c.computing[k]
+	if !ok {
+		if c.computing == nil {
+			c.computing = map[K]*factory[V]{}
+		}
+		f = &factory[V]{}
+		c.computing[k] = f
+	}
+	c.computingLock.Unlock()
+
+	f.once.Do(func() {
+		defer func() {
+			c.computingLock.Lock()
+			delete(c.computing, k)
+			c.computingLock.Unlock()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				if c.logger != nil {
+					c.logger.Error("compute function panicked", "key", k, "panic", r)
+				}
+				var zero V
+				f.value, f.err = zero, fmt.Errorf("%w: %v", ErrComputePanic, r)
+				panic(r)
+			}
+		}()
+		// a previous computation may have stored the value, and finished,
+		// since the lookup above
+		c.lock.RLock()
+		existing, ok := c.store.Get(k)
+		ok = ok && !c.expiredNoLock(k, c.clock())
+		c.lock.RUnlock()
+		if ok {
+			f.value = existing
+			return
+		}
+		if c.logger != nil {
+			c.logger.Debug("computing value", "key", k)
+		}
+		f.value, f.err = fn(k)
+		if f.err != nil {
+			if c.logger != nil {
+				c.logger.Error("error computing value", "key", k, "error", f.err)
+			}
+			return
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if c.rejected() {
+			return
+		}
+		if existing, ok := c.liveNoLock(k); ok {
+			f.value = existing
+			return
+		}
+		c.setNoLock(k, f.value)
+		if expiring {
+			c.expireNoLock(k, ttl)
+		}
+		c.storeNoLock(false)
+		if c.logger != nil {
+			c.logger.Debug("computed value stored into cache", "key", k, "value", f.value)
+		}
+	})
+	return f.value, f.err
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheGetOrCompute(t *testing.T) {
+
+	cache := New[string, int]()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	compute := func(k string) (int, error) {
+		calls.Add(1)
+		<-release
+		return len(k), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 100)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cache.GetOrCompute("key", compute)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, calls.Load(), int32(1), "The compute function should run once.")
+	for i, v := range results {
+		assert.Equal(t, v, 3, "Caller %d should get the computed value.", i)
+	}
+	v, ok := cache.Get("key")
+	assert.True(t, ok, "The computed value should be stored.")
+	assert.Equal(t, v, 3, "The stored value is invalid.")
+
+	v, err := cache.GetOrCompute("key", compute)
+	assert.NoError(t, err, "Getting an existing value should not fail.")
+	assert.Equal(t, v, 3, "The existing value should be returned.")
+	assert.Equal(t, calls.Load(), int32(1), "The compute function should not run for existing values.")
+}
+
+func TestCacheGetOrComputeLateCallers(t *testing.T) {
+
+	cache := New[string, int]()
+	var calls atomic.Int32
+	compute := func(k string) (int, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return len(k), nil
+	}
+
+	// late callers miss the value, then wait while it is stored
+	cache.computingLock.Lock()
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cache.GetOrCompute("key", compute)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cache.Put("key", 42)
+	cache.computingLock.Unlock()
+	wg.Wait()
+	assert.Equal(t, calls.Load(), int32(0), "The compute function should not run for late callers.")
+	for i, v := range results {
+		assert.Equal(t, v, 42, "Caller %d should get the stored value.", i)
+	}
+}
+
+func TestCacheGetOrComputeError(t *testing.T) {
+
+	cache := New[string, int]()
+	failure := errors.New("origin down")
+	var calls atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = cache.GetOrCompute("key", func(string) (int, error) {
+				calls.Add(1)
+				<-release
+				return 0, failure
+			})
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, calls.Load(), int32(1), "The compute function should run once.")
+	for i, err := range errs {
+		assert.ErrorIs(t, err, failure, "Caller %d should get the compute error.", i)
+	}
+	_, ok := cache.Get("key")
+	assert.False(t, ok, "Nothing should be stored on error.")
+
+	v, err := cache.GetOrCompute("key", func(string) (int, error) { return 42, nil })
+	assert.NoError(t, err, "Computing again after a failure should succeed.")
+	assert.Equal(t, v, 42, "The value should be computed again after a failure.")
+}
+
+func TestCacheGetOrComputeWithTTL(t *testing.T) {
+
+	now := time.Now()
+	cache := New[string, int]()
+	cache.clock = func() time.Time { return now }
+	var calls atomic.Int32
+	release := make(chan struct{})
+	compute := func() (int, error) {
+		<-release
+		return int(calls.Add(1)), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cache.GetOrComputeWithTTL("key", time.Minute, compute)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, calls.Load(), int32(1), "The compute function should run once.")
+	for i, v := range results {
+		assert.Equal(t, v, 1, "Caller %d should get the computed value.", i)
+	}
+	expiry, ok := cache.Expiry("key")
+	assert.True(t, ok, "The computed element should expire.")
+	assert.Equal(t, expiry, now.Add(time.Minute), "The expiry is invalid.")
+
+	v, _ := cache.GetOrComputeWithTTL("key", time.Minute, compute)
+	assert.Equal(t, v, 1, "Unexpired elements should not be computed again.")
+	now = now.Add(2 * time.Minute)
+	v, _ = cache.GetOrComputeWithTTL("key", 0, compute)
+	assert.Equal(t, v, 2, "Expired elements should be computed again.")
+	_, ok = cache.Expiry("key")
+	assert.False(t, ok, "A TTL that is not positive should mean no expiry.")
+
+	failure := errors.New("origin down")
+	_, err := cache.GetOrComputeWithTTL("other", time.Minute, func() (int, error) { return 0, failure })
+	assert.ErrorIs(t, err, failure, "The compute error should be returned.")
+	assert.False(t, cache.Contains("other"), "Nothing should be stored on error.")
+	_, ok = cache.Expiry("other")
+	assert.False(t, ok, "No expiry should be set on error.")
+}
+
+func TestCacheGetOrComputePanic(t *testing.T) {
+
+	cache := New[string, int]()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		cache.GetOrCompute("key", func(string) (int, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = cache.GetOrCompute("key", func(string) (int, error) { return 42, nil })
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, <-panicked, "boom", "The panic should be propagated to the computing caller.")
+	for i, err := range errs {
+		assert.ErrorIs(t, err, ErrComputePanic, "Caller %d should get an error.", i)
+	}
+	assert.False(t, cache.Contains("key"), "Nothing should be stored on panic.")
+
+	v, err := cache.GetOrCompute("key", func(string) (int, error) { return 42, nil })
+	assert.NoError(t, err, "Computing again after a panic should succeed.")
+	assert.Equal(t, v, 42, "The value should be computed again after a panic.")
+}
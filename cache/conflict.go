@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrStoreConflict is returned when storing a Cache whose persisted data was
+// changed by someone else since it was last loaded or stored.
+var ErrStoreConflict = errors.New("persisted data changed since last loaded or stored")
+
+// ConflictStrategy is how a Cache deals with persisted data that was changed
+// by someone else since it was last loaded or stored.
+type ConflictStrategy int
+
+const (
+	// MergeOnConflict reloads the changed data and merges it into the Cache
+	// before storing it; the elements written or deleted in the Cache since
+	// it was last loaded or stored take precedence.
+	MergeOnConflict ConflictStrategy = iota + 1
+	// FailOnConflict makes storing fail with ErrStoreConflict, until the
+	// Cache is loaded again.
+	FailOnConflict
+)
+
+// WithReloadOnStoreConflict applies the optimistic store guard option to the
+// Cache, which allows several processes to share the same persistent storage
+// without losing each other's writes: the version of the persisted data is
+// recorded whenever the Cache is loaded or stored, and checked again before
+// storing it, applying the given strategy if it changed. It requires a
+// VersionedPersistence, such as File, and enables dirty key tracking to
+// know which elements changed in the Cache in the meantime.
+func WithReloadOnStoreConflict[K comparable, V any](strategy ConflictStrategy) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if strategy == MergeOnConflict || strategy == FailOnConflict {
+			c.conflicts = strategy
+			c.dirtyTracking = true
+			c.dirtyKeys = map[K]bool{}
+		}
+	}
+}
+
+// storeLock acquires the lock needed to store the Cache, which is the write
+// lock when guarding against conflicts, since merging modifies its contents,
+// and the read lock otherwise; it returns the function releasing it.
+func (c *Cache[K, V]) storeLock() (unlock func()) {
+	if c.conflicts != 0 {
+		c.lock.Lock()
+		return c.lock.Unlock
+	}
+	c.lock.RLock()
+	return c.lock.RUnlock
+}
+
+// versioned returns the Cache persistence as a Versioned, if it is one and
+// the optimistic store guard is enabled.
+func (c *Cache[K, V]) versioned() (VersionedPersistence, bool) {
+	if c.conflicts == 0 {
+		return nil, false
+	}
+	p, ok := c.boundPersistence().(VersionedPersistence)
+	return p, ok
+}
+
+// recordVersionNoLock records the current version of the persisted data; it
+// must be called with the I/O lock held.
+func (c *Cache[K, V]) recordVersionNoLock() error {
+	p, ok := c.versioned()
+	if !ok {
+		return nil
+	}
+	version, err := p.Version()
+	if err != nil {
+		return err
+	}
+	c.version = version
+	return nil
+}
+
+// guardNoLock checks whether the persisted data changed since the Cache was
+// last loaded or stored and, if so, applies the conflict strategy; it must
+// be called with both the write lock and the I/O lock held.
+func (c *Cache[K, V]) guardNoLock() error {
+	p, ok := c.versioned()
+	if !ok {
+		return nil
+	}
+	version, err := p.Version()
+	if err != nil {
+		return err
+	}
+	if version == c.version {
+		return nil
+	}
+	if c.conflicts == FailOnConflict {
+		if c.logger != nil {
+			c.logger.Warn("persisted data changed, not storing", "version", version)
+		}
+		return ErrStoreConflict
+	}
+	if c.logger != nil {
+		c.logger.Info("persisted data changed, merging before storing", "version", version)
+	}
+	m, expiries, err := c.readNoLock()
+	if err != nil && !errors.Is(err, ErrNoData) {
+		return err
+	}
+	c.mergeNoLock(transform(m, c.loadTransform), expiries)
+	return nil
+}
+
+// mergeNoLock merges the persisted data and the expiry times of its elements
+// into the Cache, leaving alone the elements written or deleted since it was
+// last loaded or stored; it must be called with the write lock held.
+func (c *Cache[K, V]) mergeNoLock(m map[K]V, expiries map[K]time.Time) {
+	c.dirtyLock.Lock()
+	touched := make(map[K]bool, len(c.dirtyKeys))
+	for k, present := range c.dirtyKeys {
+		touched[k] = present
+	}
+	c.dirtyLock.Unlock()
+
+	removed := []K{}
+	c.store.Range(func(k K, _ V) bool {
+		if _, ok := m[k]; !ok {
+			if _, ok := touched[k]; !ok {
+				removed = append(removed, k)
+			}
+		}
+		return true
+	})
+	for _, k := range removed {
+		c.deleteNoLock(k)
+	}
+	for k, v := range m {
+		if _, ok := touched[k]; !ok {
+			c.setNoLock(k, v)
+			// the persisted expiry replaces any computed one
+			delete(c.expiries, k)
+			if t, ok := expiries[k]; ok {
+				c.expireAtNoLock(k, t)
+			}
+		}
+	}
+	if c.logger != nil {
+		c.logger.Debug("persisted data merged", "read", len(m), "removed", len(removed))
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheReloadOnStoreConflict(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	open := func() *Cache[string, string] {
+		return New(
+			WithPersistence[string, string](&File{Path: path}),
+			WithEncoding[string, string](&JSON[string, string]{}),
+			WithReloadOnStoreConflict[string, string](MergeOnConflict),
+		)
+	}
+	a, b := open(), open()
+	a.Put("shared", "sss")
+	assert.NoError(t, a.Store(), "Storing should succeed.")
+	assert.NoError(t, b.Load(), "Loading should succeed.")
+
+	// both processes change the data concurrently
+	a.Put("a", "aaa")
+	a.Delete("shared")
+	assert.NoError(t, a.Store(), "Storing should succeed.")
+	b.Put("b", "bbb")
+	b.Put("a", "bba")
+	assert.NoError(t, b.Store(), "Storing on conflict should merge and succeed.")
+	assert.ElementsMatch(t, b.Keys(), []string{"a", "b"}, "The changes of both processes should be merged.")
+	value, _ := b.Get("a")
+	assert.Equal(t, value, "bba", "The elements written locally should take precedence.")
+
+	assert.NoError(t, a.Store(), "Storing on conflict should merge and succeed.")
+	assert.ElementsMatch(t, a.Keys(), []string{"a", "b"}, "The changes of the other process should be merged.")
+	value, _ = a.Get("a")
+	assert.Equal(t, value, "bba", "The untouched elements should be reloaded.")
+
+	c := open()
+	assert.NoError(t, c.Load(), "Loading should succeed.")
+	assert.ElementsMatch(t, c.Keys(), []string{"a", "b"}, "The merged data should have been stored.")
+}
+
+func TestCacheFailOnStoreConflict(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithReloadOnStoreConflict[string, string](FailOnConflict),
+	)
+	cache.Put("a", "aaa")
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+	assert.NoError(t, cache.Store(), "Storing again with no external changes should succeed.")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"a": "aaa", "external": "eee"}`), 0644), "Modifying the file should succeed.")
+	assert.ErrorIs(t, cache.Store(), ErrStoreConflict, "Storing after an external modification should fail.")
+	data, _ := os.ReadFile(path)
+	assert.Contains(t, string(data), "external", "The external modification should not be overwritten.")
+
+	assert.NoError(t, cache.Load(), "Loading should succeed.")
+	assert.NoError(t, cache.Store(), "Storing after reloading should succeed.")
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "external"}, "The external modification should have been loaded.")
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+)
+
+// ContextPersistence is implemented by persistences that can bind their
+// reads and writes to a context, e.g. to trace them as part of the operation
+// that triggered them; WithContext returns a Persistence doing so, which
+// implements the same optional interfaces as the original one.
+type ContextPersistence interface {
+	WithContext(ctx context.Context) Persistence
+}
+
+// WithContext returns a view of the Cache whose operations bind the reads
+// and writes of persistent storage they trigger to the given context, if the
+// Cache persistence implements ContextPersistence; the view shares the
+// contents and configuration of the Cache, and background writes (e.g. the
+// deferred ones) are never bound.
+func (c *Cache[K, V]) WithContext(ctx context.Context) *Cache[K, V] {
+	return &Cache[K, V]{state: c.state, putDepth: c.putDepth, ctx: ctx}
+}
+
+// boundPersistence returns the Cache persistence, bound to the context of
+// the Cache view if there is one and the persistence supports it.
+func (c *Cache[K, V]) boundPersistence() Persistence {
+	if c.ctx == nil {
+		return c.persistence
+	}
+	if p, ok := c.persistence.(ContextPersistence); ok {
+		return p.WithContext(c.ctx)
+	}
+	return c.persistence
+}
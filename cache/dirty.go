@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ItemPersistence is implemented by persistences that store each element
+// on its own, encoded as a single-element map; when dirty key tracking is
+// enabled, the Cache writes and deletes individual elements through it
+// rather than rewriting all of its contents, and reads them back one by one.
+// Without dirty key tracking, it is used as a plain Persistence.
+type ItemPersistence[K comparable] interface {
+	// WriteItem writes the encoded element under the given key.
+	WriteItem(k K, data []byte) error
+	// DeleteItem removes the element under the given key.
+	DeleteItem(k K) error
+	// ReadItems reads back all the encoded elements.
+	ReadItems() (map[K][]byte, error)
+}
+
+// WithDirtyKeyTracking applies the dirty key tracking option to the Cache,
+// which then keeps track of the keys written or deleted since the last time
+// it was stored or loaded, so that an ItemPersistence only needs to write
+// (or delete) those elements.
+func WithDirtyKeyTracking[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.dirtyTracking = true
+		c.dirtyKeys = map[K]bool{}
+	}
+}
+
+// DirtyKeys returns the keys written or deleted since the Cache was last
+// stored or loaded, if dirty key tracking is enabled.
+func (c *Cache[K, V]) DirtyKeys() []K {
+	c.dirtyLock.Lock()
+	defer c.dirtyLock.Unlock()
+	keys := make([]K, 0, len(c.dirtyKeys))
+	for k := range c.dirtyKeys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// items returns the Cache persistence as an ItemPersistence, if it is one
+// and dirty key tracking is enabled.
+func (c *Cache[K, V]) items() (ItemPersistence[K], bool) {
+	if !c.dirtyTracking {
+		return nil, false
+	}
+	p, ok := c.boundPersistence().(ItemPersistence[K])
+	return p, ok
+}
+
+// markDirtyNoLock records that the element under the given key was written
+// (or deleted, if not present); it must be called with the write lock held.
+func (c *Cache[K, V]) markDirtyNoLock(k K, present bool) {
+	if !c.dirtyTracking {
+		return
+	}
+	c.dirtyLock.Lock()
+	defer c.dirtyLock.Unlock()
+	c.dirtyKeys[k] = present
+}
+
+// resetDirtyKeys records that the Cache contents match the persisted data.
+func (c *Cache[K, V]) resetDirtyKeys() {
+	if !c.dirtyTracking {
+		return
+	}
+	c.dirtyLock.Lock()
+	defer c.dirtyLock.Unlock()
+	c.dirtyKeys = map[K]bool{}
+}
+
+// writeItemsNoLock writes the dirty elements to the given ItemPersistence,
+// stopping at the first failure; the elements successfully written are no
+// longer dirty.
+func (c *Cache[K, V]) writeItemsNoLock(p ItemPersistence[K]) error {
+	done := c.timed("write")
+	defer done()
+
+	c.dirtyLock.Lock()
+	defer c.dirtyLock.Unlock()
+	if c.logger != nil {
+		c.logger.Debug("writing dirty elements", "count", len(c.dirtyKeys))
+	}
+	now := c.clock()
+	for k, present := range c.dirtyKeys {
+		v, ok := c.store.Get(k)
+		if ok && c.storeTransform != nil {
+			v, ok = c.storeTransform(k, v)
+		}
+		var expiries map[K]time.Time
+		if t, expiring := c.expiries[k]; expiring && ok {
+			// elements whose expiry cannot be written are left out
+			ok = now.Before(t) && canExpire(c.encoding)
+			expiries = map[K]time.Time{k: t}
+		}
+		var err error
+		if present && ok {
+			var data []byte
+			start := time.Now()
+			data, err = encodeExpiring(c.encoding, map[K]V{k: v}, expiries)
+			c.pstats.encoded(time.Since(start), err)
+			if err == nil {
+				start = time.Now()
+				err = p.WriteItem(k, data)
+				c.pstats.written(time.Since(start), err)
+			}
+		} else {
+			err = p.DeleteItem(k)
+		}
+		if err != nil {
+			if c.logger != nil {
+				c.logger.Error("error writing dirty element", "key", k, "error", err)
+			}
+			return fmt.Errorf("key %v: %w", k, err)
+		}
+		delete(c.dirtyKeys, k)
+	}
+	return nil
+}
+
+// readItemsNoLock reads back the elements from the given ItemPersistence,
+// migrating and decoding each of them, along with their expiry times.
+func (c *Cache[K, V]) readItemsNoLock(p ItemPersistence[K]) (map[K]V, map[K]time.Time, error) {
+	done := c.timed("read")
+	items, err := p.ReadItems()
+	done()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.checkDecoded(len(items)); err != nil {
+		return nil, nil, err
+	}
+	done = c.timed("decode")
+	defer done()
+	m := make(map[K]V, len(items))
+	expiries := map[K]time.Time{}
+	errs := []error{}
+	for k, data := range items {
+		if c.copyOnLoad {
+			data = bytes.Clone(data)
+		}
+		item, expiry, err := c.decodeMigrating(c.encoding, data)
+		if err == nil {
+			for k, v := range item {
+				m[k] = v
+			}
+			for k, t := range expiry {
+				expiries[k] = t
+			}
+			continue
+		}
+		errs = append(errs, fmt.Errorf("key %v: %w", k, err))
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	return m, expiries, nil
+}
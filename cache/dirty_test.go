@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// items is an ItemPersistence keeping the encoded elements in memory.
+type items struct {
+	lock    sync.Mutex
+	data    map[string][]byte
+	writes  int
+	deletes int
+}
+
+func (i *items) WriteItem(k string, data []byte) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.data == nil {
+		i.data = map[string][]byte{}
+	}
+	i.data[k] = data
+	i.writes++
+	return nil
+}
+
+func (i *items) DeleteItem(k string) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	delete(i.data, k)
+	i.deletes++
+	return nil
+}
+
+func (i *items) ReadItems() (map[string][]byte, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	m := make(map[string][]byte, len(i.data))
+	for k, data := range i.data {
+		m[k] = data
+	}
+	return m, nil
+}
+
+func (*items) Write(_ []byte) error {
+	return errors.New("not implemented")
+}
+
+func (*items) Read() ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestCacheDirtyKeyTracking(t *testing.T) {
+
+	persistence := &items{}
+	cache := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithDirtyKeyTracking[string, int](),
+	)
+	for i := 0; i < 1000; i++ {
+		cache.Put(fmt.Sprintf("key-%03d", i), i)
+	}
+	assert.Len(t, cache.DirtyKeys(), 1000, "All the new keys should be dirty.")
+	assert.NoError(t, cache.Store(), "Storing the cache should not fail.")
+	assert.Equal(t, persistence.writes, 1000, "All the elements should have been written.")
+	assert.Empty(t, cache.DirtyKeys(), "No keys should be dirty after storing.")
+
+	persistence.writes = 0
+	cache.Replace("key-001", -1)
+	cache.Replace("key-002", -2)
+	cache.Put("key-new", 1000)
+	cache.Delete("key-003")
+	keys := cache.DirtyKeys()
+	sort.Strings(keys)
+	assert.Equal(t, keys, []string{"key-001", "key-002", "key-003", "key-new"}, "The modified keys should be dirty.")
+	assert.NoError(t, cache.Store(), "Storing the cache should not fail.")
+	assert.Equal(t, persistence.writes, 3, "Only the modified elements should have been written.")
+	assert.Equal(t, persistence.deletes, 1, "Only the deleted element should have been removed.")
+
+	restored := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithDirtyKeyTracking[string, int](),
+	)
+	assert.NoError(t, restored.Load(), "Loading the cache should not fail.")
+	assert.True(t, Equal(cache, restored, Eq[int]), "The elements should be read back one by one.")
+	assert.Empty(t, restored.DirtyKeys(), "No keys should be dirty after loading.")
+}
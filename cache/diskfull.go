@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ErrDiskFull is returned (wrapped) by File when the disk is full.
+var ErrDiskFull = errors.New("disk full")
+
+// ErrReadOnly is returned when a Cache stopped accepting mutations because
+// the disk filled up.
+var ErrReadOnly = errors.New("cache is read-only after the disk filled up")
+
+// WithStopOnDiskFull applies the stop-on-disk-full option to the Cache: as
+// soon as writing to persistent storage fails because the disk is full, the
+// Cache becomes read-only, rejecting all further mutations instead of
+// accumulating data that cannot be persisted: methods returning an error
+// fail with ErrReadOnly, while the others report no change, as documented
+// on each of them, and ReadOnly tells such rejections apart. A
+// successful explicit Store(), e.g. once space has been freed, makes the
+// Cache writable again.
+func WithStopOnDiskFull[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.stopOnDiskFull = true
+	}
+}
+
+// ReadOnly returns ErrReadOnly if the Cache stopped accepting mutations
+// because the disk filled up, nil otherwise.
+func (c *Cache[K, V]) ReadOnly() error {
+	if c.diskFull.Load() {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// isDiskFull returns whether the error reports that the disk is full.
+func isDiskFull(err error) bool {
+	return errors.Is(err, ErrDiskFull) || errors.Is(err, syscall.ENOSPC)
+}
+
+// checkDiskFull makes the Cache read-only if the given persistence error
+// reports that the disk is full, or writable again if there was no error.
+func (c *Cache[K, V]) checkDiskFull(err error) {
+	if !c.stopOnDiskFull {
+		return
+	}
+	if err == nil {
+		c.diskFull.Store(false)
+	} else if isDiskFull(err) && !c.diskFull.Swap(true) {
+		if c.logger != nil {
+			c.logger.Error("disk full, cache switched to read-only", "error", err)
+		}
+	}
+}
+
+// rejected returns whether mutations must be rejected because the Cache is
+// read-only.
+func (c *Cache[K, V]) rejected() bool {
+	if !c.diskFull.Load() {
+		return false
+	}
+	if c.logger != nil {
+		c.logger.Error("rejecting mutation of read-only cache")
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheStopOnDiskFull(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+		WithStopOnDiskFull[string, string](),
+	)
+	cache.Put("a", "aaa")
+	assert.NoError(t, cache.ReadOnly(), "The cache should be writable.")
+
+	persistence.err = fmt.Errorf("write test.json: %w", syscall.ENOSPC)
+	cache.Put("b", "bbb")
+	assert.ErrorIs(t, cache.ReadOnly(), ErrReadOnly, "The cache should have become read-only.")
+
+	assert.False(t, cache.Put("c", "ccc"), "Puts should be rejected.")
+	_, ok := cache.Replace("a", "AAA")
+	assert.False(t, ok, "Replaces should be rejected.")
+	_, ok = cache.Delete("a")
+	assert.False(t, ok, "Deletes should be rejected.")
+	cache.Clear()
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b"}, "The cache should not have changed.")
+	v, _ := cache.Get("a")
+	assert.Equal(t, v, "aaa", "Reads should still be served.")
+
+	// once space is freed, an explicit store makes the cache writable again
+	persistence.err = nil
+	assert.NoError(t, cache.Store(), "Storing the cache should succeed.")
+	assert.NoError(t, cache.ReadOnly(), "The cache should be writable again.")
+	assert.True(t, cache.Put("c", "ccc"), "Puts should be accepted again.")
+}
+
+func TestCacheReadOnlyMethods(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+		WithStopOnDiskFull[string, string](),
+		WithDeleteGrace[string, string](time.Hour),
+		WithLoader[string, string](func(k string) (string, bool, error) { return "loaded", true, nil }),
+	)
+	cache.Put("a", "aaa")
+	cache.Put("gone", "ggg")
+	cache.Delete("gone")
+	persistence.err = syscall.ENOSPC
+	cache.Put("b", "bbb")
+	assert.ErrorIs(t, cache.ReadOnly(), ErrReadOnly, "The cache should have become read-only.")
+
+	added, locked := cache.TryPut("c", "ccc")
+	assert.True(t, locked && !added, "TryPut should report nothing added.")
+	assert.False(t, cache.PutWithTTL("c", "ccc", time.Minute), "PutWithTTL should report nothing added.")
+	ok, err := cache.PutWithMeta("c", "ccc", map[string]string{"owner": "me"})
+	assert.False(t, ok, "PutWithMeta should report nothing added.")
+	assert.ErrorIs(t, err, ErrReadOnly, "PutWithMeta should fail.")
+	assert.False(t, cache.PutLazy("c", func() (string, error) { return "ccc", nil }), "PutLazy should report nothing added.")
+	assert.Equal(t, cache.PutMany(map[string]string{"c": "ccc"}), 0, "PutMany should report nothing added.")
+	assert.ErrorIs(t, cache.BulkLoad(func(put func(k, v string)) {
+		t.Error("BulkLoad should not call the function.")
+	}), ErrReadOnly, "BulkLoad should fail.")
+
+	_, ok = cache.ReplaceWithTTL("a", "AAA", time.Minute)
+	assert.False(t, ok, "ReplaceWithTTL should report no previous element.")
+	_, ok = cache.ReplaceIfPresent("a", "AAA")
+	assert.False(t, ok, "ReplaceIfPresent should report nothing replaced.")
+	_, ok = cache.ReplaceIf("a", "AAA", func(string, bool) bool {
+		t.Error("ReplaceIf should not call the condition.")
+		return true
+	})
+	assert.False(t, ok, "ReplaceIf should report nothing stored.")
+	assert.False(t, cache.LockedUpdate("a", func(v *string) {
+		t.Error("LockedUpdate should not call the function.")
+	}), "LockedUpdate should report nothing updated.")
+	_, ok = cache.Undelete("gone")
+	assert.False(t, ok, "Undelete should restore nothing.")
+	_, ok, err = cache.DeleteDurable("a")
+	assert.False(t, ok, "DeleteDurable should report the element as absent.")
+	assert.ErrorIs(t, err, ErrReadOnly, "DeleteDurable should fail.")
+	cache.ClearNoFlush()
+
+	// values from the loader or a computation are returned, not stored
+	v, err := cache.GetOrCompute("x", func(string) (string, error) { return "xxx", nil })
+	assert.NoError(t, err, "GetOrCompute should not fail.")
+	assert.Equal(t, v, "xxx", "GetOrCompute should return the computed value.")
+	v, _ = cache.Get("y")
+	assert.Equal(t, v, "loaded", "Get should return the loaded value.")
+	v, ok, err = cache.GetFresh("z")
+	assert.NoError(t, err, "GetFresh should not fail.")
+	assert.True(t, ok, "GetFresh should report the key as existing.")
+	assert.Equal(t, v, "loaded", "GetFresh should return the loaded value.")
+
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b"}, "The cache should not have changed.")
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "aaa", "The values should not have changed.")
+	_, ok = cache.Expiry("a")
+	assert.False(t, ok, "No expiry should have been set.")
+	_, ok = cache.Meta("a")
+	assert.False(t, ok, "No metadata should have been set.")
+}
+
+func TestCacheDiskFullWithoutOption(t *testing.T) {
+
+	persistence := &memory{err: syscall.ENOSPC}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+	)
+	cache.Put("a", "aaa")
+	assert.NoError(t, cache.ReadOnly(), "The cache should stay writable without the option.")
+	assert.True(t, cache.Put("b", "bbb"), "Puts should be accepted without the option.")
+}
+
+func TestFileDiskFull(t *testing.T) {
+
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+	err := (&File{Path: "/dev/full"}).Write([]byte("data"))
+	assert.ErrorIs(t, err, ErrDiskFull, "A full disk should be reported as such.")
+	assert.ErrorIs(t, err, syscall.ENOSPC, "The underlying error should still be available.")
+}
@@ -1,9 +1,18 @@
 package cache
 
 import (
+	"bufio"
 	"bytes"
+	"encoding"
 	"encoding/gob"
 	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
@@ -14,65 +23,371 @@ type Encoding[K comparable, V any] interface {
 	Decode(data []byte) (map[K]V, error)
 }
 
-// JSON encodes/decodes cache data in JSON format.
+// NewEncoding returns the Encoding for the given format name, one of
+// "json", "yaml", "toml" or "gob".
+func NewEncoding[K comparable, V any](format string) (Encoding[K, V], error) {
+	switch format {
+	case "json":
+		return &JSON[K, V]{}, nil
+	case "yaml":
+		return &YAML[K, V]{}, nil
+	case "toml":
+		return &TOML[K, V]{}, nil
+	case "gob":
+		return &GOB[K, V]{}, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding format %q", format)
+}
+
+// StreamingEncoding is implemented by encodings that can write the encoded
+// data directly to an io.Writer, without first building it in memory.
+type StreamingEncoding[K comparable, V any] interface {
+	EncodeTo(w io.Writer, data map[K]V) error
+}
+
+// JSON encodes/decodes cache data in JSON format; if OmitEmpty is set, the
+// zero-valued fields of struct values are left out, as if they were all
+// tagged with omitempty, and come back as zero values when decoding.
 type JSON[K comparable, V any] struct {
-	Pretty bool
+	Pretty    bool
+	OmitEmpty bool
 }
 
 // Encode encodes cache data in JSON format.
 func (j *JSON[K, V]) Encode(data map[K]V) ([]byte, error) {
+	var v any = data
+	if isInterface[V]() {
+		// interface values carry their registered type along
+		v = wrapTyped(data)
+	} else if j.OmitEmpty {
+		return j.encodeCompact(data)
+	}
 	if j.Pretty {
-		return json.MarshalIndent(data, "", "  ")
+		return json.MarshalIndent(v, "", "  ")
 	} else {
-		return json.Marshal(data)
+		return json.Marshal(v)
+	}
+}
+
+// encodeCompact encodes cache data in JSON format, leaving out the empty
+// fields of struct values.
+func (j *JSON[K, V]) encodeCompact(data map[K]V) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	tree := map[string]any{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf((*V)(nil)).Elem()
+	for _, v := range tree {
+		omitEmpty(v, t)
+	}
+	if j.Pretty {
+		return json.MarshalIndent(tree, "", "  ")
+	}
+	return json.Marshal(tree)
+}
+
+// omitEmpty removes the empty fields from the decoded JSON objects that
+// correspond to structs, walking the decoded tree along with the Go type it
+// was encoded from.
+func omitEmpty(node any, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if object, ok := node.(map[string]any); ok {
+			omitEmptyFields(object, t)
+		}
+	case reflect.Slice, reflect.Array:
+		if array, ok := node.([]any); ok {
+			for _, item := range array {
+				omitEmpty(item, t.Elem())
+			}
+		}
+	case reflect.Map:
+		if object, ok := node.(map[string]any); ok {
+			for _, item := range object {
+				omitEmpty(item, t.Elem())
+			}
+		}
+	}
+}
+
+// omitEmptyFields removes the empty fields of a struct from its decoded JSON
+// object, including those promoted from embedded structs.
+func omitEmptyFields(object map[string]any, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				omitEmptyFields(object, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, ok := object[name]
+		if !ok {
+			continue
+		}
+		omitEmpty(value, field.Type)
+		if isEmptyJSON(value) {
+			delete(object, name)
+		}
+	}
+}
+
+// isEmptyJSON returns whether a decoded JSON value is empty.
+func isEmptyJSON(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
 	}
+	return false
+}
+
+// EncodeTo encodes cache data in JSON format, writing one entry at a time
+// to the given io.Writer; the output is the same as Encode's. With OmitEmpty
+// the data is encoded in memory first.
+func (j *JSON[K, V]) EncodeTo(w io.Writer, data map[K]V) error {
+	wrap := isInterface[V]()
+	if j.OmitEmpty && !wrap {
+		encoded, err := j.encodeCompact(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(encoded)
+		return err
+	}
+	type entry struct {
+		name  string
+		value V
+	}
+	entries := make([]entry, 0, len(data))
+	for k, v := range data {
+		name, err := jsonKey(k)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{name: name, value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	separator, indent := ":", ""
+	if j.Pretty {
+		separator, indent = ": ", "  "
+	}
+	// write appends the JSON encoding of v, minus the trailing newline
+	// added by the encoder
+	var scratch bytes.Buffer
+	encoder := json.NewEncoder(&scratch)
+	encoder.SetIndent(indent, indent)
+	buffer := bufio.NewWriter(w)
+	write := func(v any) error {
+		scratch.Reset()
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		_, err := buffer.Write(bytes.TrimSuffix(scratch.Bytes(), []byte{'\n'}))
+		return err
+	}
+	buffer.WriteByte('{')
+	for i, e := range entries {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		if j.Pretty {
+			buffer.WriteString("\n" + indent)
+		}
+		if err := write(e.name); err != nil {
+			return err
+		}
+		buffer.WriteString(separator)
+		var value any = e.value
+		if wrap {
+			value = typed[V]{value: e.value}
+		}
+		if err := write(value); err != nil {
+			return err
+		}
+	}
+	if j.Pretty && len(entries) > 0 {
+		buffer.WriteByte('\n')
+	}
+	buffer.WriteByte('}')
+	return buffer.Flush()
+}
+
+// jsonKey returns the string used for the given map key in JSON, following
+// the same rules as the encoding/json package.
+func jsonKey(k any) (string, error) {
+	v := reflect.ValueOf(k)
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if m, ok := k.(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("json: unsupported key type %T", k)
 }
 
 // Decode decodes cache data from JSON format.
 func (*JSON[K, V]) Decode(data []byte) (map[K]V, error) {
+	if isInterface[V]() {
+		m := map[K]typed[V]{}
+		err := json.Unmarshal(data, &m)
+		return unwrapTyped(m), err
+	}
 	m := map[K]V{}
 	err := json.Unmarshal(data, &m)
 	return m, err
 }
 
-// YAML encodes/decodes cache data in YAML format.
-type YAML[K comparable, V any] struct{}
+// YAML encodes/decodes cache data in YAML format; if Entries is set, the
+// data is encoded as a list of key/value entries rather than as a mapping,
+// so that keys of any comparable type (e.g. structs) round-trip.
+type YAML[K comparable, V any] struct {
+	Entries bool
+}
 
 // Encode encodes cache data in YAML format.
-func (*YAML[K, V]) Encode(data map[K]V) ([]byte, error) {
+func (y *YAML[K, V]) Encode(data map[K]V) ([]byte, error) {
+	if isInterface[V]() {
+		// interface values carry their registered type along
+		if y.Entries {
+			return yaml.Marshal(toEntries(wrapTyped(data)))
+		}
+		return yaml.Marshal(wrapTyped(data))
+	}
+	if y.Entries {
+		return yaml.Marshal(toEntries(data))
+	}
 	return yaml.Marshal(data)
 }
 
 // Decode decodes cache data from YAML format.
-func (*YAML[K, V]) Decode(data []byte) (map[K]V, error) {
+func (y *YAML[K, V]) Decode(data []byte) (map[K]V, error) {
+	if isInterface[V]() {
+		if y.Entries {
+			entries := []Entry[K, typed[V]]{}
+			err := yaml.Unmarshal(data, &entries)
+			return unwrapTyped(fromEntries(entries)), err
+		}
+		m := map[K]typed[V]{}
+		err := yaml.Unmarshal(data, &m)
+		return unwrapTyped(m), err
+	}
+	if y.Entries {
+		entries := []Entry[K, V]{}
+		err := yaml.Unmarshal(data, &entries)
+		return fromEntries(entries), err
+	}
 	m := map[K]V{}
 	err := yaml.Unmarshal(data, &m)
 	return m, err
 }
 
-// TOML encodes/decodes cache data in TOML format.
+// TOML encodes/decodes cache data in TOML format; if Entries is set, the
+// data is encoded as an array of key/value tables rather than as a table,
+// so that keys of any comparable type (e.g. structs) round-trip.
 type TOML[K comparable, V any] struct {
+	Entries bool
 	buffer  bytes.Buffer
-	encoder *toml.Encoder
+}
+
+// tomlEntries is the root table of TOML data encoded as entries.
+type tomlEntries[K comparable, V any] struct {
+	Entries []Entry[K, V] `toml:"entries"`
 }
 
 // Encode encodes cache data in TOML format.
 func (t *TOML[K, V]) Encode(data map[K]V) ([]byte, error) {
 	t.buffer.Reset()
-	if t.encoder == nil {
-		t.encoder = toml.NewEncoder(&t.buffer)
+	// encoders are stateful, so a new one is needed for each document
+	encoder := toml.NewEncoder(&t.buffer)
+	var err error
+	if t.Entries {
+		err = encoder.Encode(tomlEntries[K, V]{Entries: toEntries(data)})
+	} else {
+		err = encoder.Encode(data)
 	}
-	err := t.encoder.Encode(data)
-	return t.buffer.Bytes(), err
+	// the buffer is reused, so the caller must not share its memory
+	return bytes.Clone(t.buffer.Bytes()), err
 }
 
 // Decode decodes cache data from TOML format.
-func (*TOML[K, V]) Decode(data []byte) (map[K]V, error) {
+func (t *TOML[K, V]) Decode(data []byte) (map[K]V, error) {
+	if t.Entries {
+		root := tomlEntries[K, V]{}
+		_, err := toml.Decode(string(data), &root)
+		return fromEntries(root.Entries), err
+	}
 	m := map[K]V{}
 	_, err := toml.Decode(string(data), &m)
 	return m, err
 }
 
+// toEntries converts cache data into a list of entries, sorted by the
+// textual representation of their keys so that the output is stable.
+func toEntries[K comparable, V any](data map[K]V) []Entry[K, V] {
+	entries := make([]Entry[K, V], 0, len(data))
+	for k, v := range data {
+		entries = append(entries, Entry[K, V]{Key: k, Value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return fmt.Sprint(entries[i].Key) < fmt.Sprint(entries[j].Key)
+	})
+	return entries
+}
+
+// fromEntries converts a list of entries back into cache data.
+func fromEntries[K comparable, V any](entries []Entry[K, V]) map[K]V {
+	m := make(map[K]V, len(entries))
+	for _, e := range entries {
+		m[e.Key] = e.Value
+	}
+	return m
+}
+
 // GOB encodes/decodes cache data in self-describing binary format.
 type GOB[K comparable, V any] struct{}
 
@@ -95,3 +410,84 @@ func (g *GOB[K, V]) Decode(data []byte) (map[K]V, error) {
 	}
 	return m, nil
 }
+
+// versionMagic prefixes the data encoded by a Versioned encoding.
+var versionMagic = []byte("YAGC")
+
+// Versioned wraps an Encoding, prefixing the encoded data with a header that
+// carries the format version, so that data written in an older format can be
+// migrated on Load (see WithMigration); data with no header is version 0.
+type Versioned[K comparable, V any] struct {
+	Encoding Encoding[K, V]
+	Version  uint8
+}
+
+// Encode encodes cache data with the wrapped encoding, prefixing the result
+// with the version header.
+func (v *Versioned[K, V]) Encode(data map[K]V) ([]byte, error) {
+	payload, err := v.Encoding.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(versionHeader(v.Version), payload...), nil
+}
+
+// Decode checks that the cache data is in the current format version and
+// decodes it with the wrapped encoding.
+func (v *Versioned[K, V]) Decode(data []byte) (map[K]V, error) {
+	version, payload := splitVersion(data)
+	if version != v.Version {
+		return nil, fmt.Errorf("unsupported format version %d, expected %d", version, v.Version)
+	}
+	return v.Encoding.Decode(payload)
+}
+
+// encodeExpiring encodes cache data along with its expiry times with the
+// wrapped encoding, if it can carry them, prefixing the result with the
+// version header.
+func (v *Versioned[K, V]) encodeExpiring(data map[K]V, expiries map[K]time.Time) ([]byte, error) {
+	payload, err := encodeExpiring(v.Encoding, data, expiries)
+	if err != nil {
+		return nil, err
+	}
+	return append(versionHeader(v.Version), payload...), nil
+}
+
+// decodeExpiring checks that the cache data is in the current format
+// version and decodes it, along with its expiry times, with the wrapped
+// encoding.
+func (v *Versioned[K, V]) decodeExpiring(data []byte) (map[K]V, map[K]time.Time, error) {
+	payload, err := v.unwrapData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodeExpiring(v.Encoding, payload)
+}
+
+// unwrap returns the wrapped encoding.
+func (v *Versioned[K, V]) unwrap() Encoding[K, V] {
+	return v.Encoding
+}
+
+// unwrapData checks that the cache data is in the current format version
+// and strips the version header for the wrapped encoding.
+func (v *Versioned[K, V]) unwrapData(data []byte) ([]byte, error) {
+	version, payload := splitVersion(data)
+	if version != v.Version {
+		return nil, fmt.Errorf("unsupported format version %d, expected %d", version, v.Version)
+	}
+	return payload, nil
+}
+
+// versionHeader returns the header for the given format version.
+func versionHeader(version uint8) []byte {
+	return append(append([]byte{}, versionMagic...), version)
+}
+
+// splitVersion splits versioned data into format version and payload.
+func splitVersion(data []byte) (uint8, []byte) {
+	if len(data) > len(versionMagic) && bytes.HasPrefix(data, versionMagic) {
+		return data[len(versionMagic)], data[len(versionMagic)+1:]
+	}
+	return 0, data
+}
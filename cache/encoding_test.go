@@ -0,0 +1,400 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type textKey struct {
+	a, b string
+}
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte(k.a + "/" + k.b), nil
+}
+
+func TestJSONEncodeTo(t *testing.T) {
+
+	for _, pretty := range []bool{false, true} {
+		encoding := &JSON[string, []int]{Pretty: pretty}
+		for _, data := range []map[string][]int{
+			{},
+			{"a": {1}},
+			{"b": {1, 2}, "a": nil, "c\"quoted\"": {3}},
+		} {
+			expected, err := encoding.Encode(data)
+			assert.NoError(t, err, "Encoding should succeed.")
+			var buffer bytes.Buffer
+			assert.NoError(t, encoding.EncodeTo(&buffer, data), "Streaming should succeed.")
+			assert.Equal(t, buffer.String(), string(expected), "Streaming should produce the same output as encoding.")
+		}
+	}
+
+	ints := map[int]string{-1: "a", 10: "b", 2: "c"}
+	expected, _ := (&JSON[int, string]{}).Encode(ints)
+	var buffer bytes.Buffer
+	assert.NoError(t, (&JSON[int, string]{}).EncodeTo(&buffer, ints), "Streaming should succeed.")
+	assert.Equal(t, buffer.String(), string(expected), "Streaming should produce the same output as encoding.")
+
+	texts := map[textKey]int{{"a", "b"}: 1, {"c", "d"}: 2}
+	expected, _ = (&JSON[textKey, int]{}).Encode(texts)
+	buffer.Reset()
+	assert.NoError(t, (&JSON[textKey, int]{}).EncodeTo(&buffer, texts), "Streaming should succeed.")
+	assert.Equal(t, buffer.String(), string(expected), "Streaming should produce the same output as encoding.")
+}
+
+func TestCacheStreaming(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{Pretty: true}),
+	)
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err, "Reading the file should succeed.")
+	assert.Equal(t, string(data), "{\n  \"a\": \"aaa\",\n  \"b\": \"bbb\"\n}", "The file contents are invalid.")
+
+	cache2 := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{Pretty: true}),
+	)
+	assert.NoError(t, cache2.Load(), "Loading should succeed.")
+	assert.ElementsMatch(t, cache2.Keys(), []string{"a", "b"}, "The key set is invalid.")
+}
+
+// noStreaming hides the Writer method of the wrapped File.
+type noStreaming struct {
+	file *File
+}
+
+func (n *noStreaming) Write(data []byte) error { return n.file.Write(data) }
+func (n *noStreaming) Read() ([]byte, error)   { return n.file.Read() }
+
+func benchmarkStore(b *testing.B, persistence func(path string) Persistence) {
+	path := filepath.Join(b.TempDir(), "bench.json")
+	cache := New(
+		WithPersistence[string, string](persistence(path)),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	for i := 0; i < 100000; i++ {
+		cache.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("a moderately long value for key %d", i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cache.Store(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStoreBuffered(b *testing.B) {
+	benchmarkStore(b, func(path string) Persistence { return &noStreaming{file: &File{Path: path}} })
+}
+
+func BenchmarkStoreStreaming(b *testing.B) {
+	benchmarkStore(b, func(path string) Persistence { return &File{Path: path} })
+}
+
+func TestCacheMigration(t *testing.T) {
+
+	type duration struct {
+		Seconds int `json:"seconds"`
+	}
+
+	persistence := &memory{}
+
+	// version 0 is the legacy, unversioned format
+	legacy := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+	)
+	legacy.Put("a", 1)
+	legacy.Store()
+
+	v1 := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&Versioned[string, int]{Encoding: &JSON[string, int]{}, Version: 1}),
+		WithMigration[string, int](0, func(raw []byte) ([]byte, error) { return raw, nil }),
+	)
+	assert.NoError(t, v1.Load(), "Loading a legacy file should succeed.")
+	v1.Put("b", 2)
+	v1.Store()
+	assert.True(t, bytes.HasPrefix(persistence.data, []byte("YAGC\x01")), "The data should carry the version header.")
+
+	// version 2 changes the shape of the values
+	v2 := New(
+		WithPersistence[string, duration](persistence),
+		WithEncoding[string, duration](&Versioned[string, duration]{Encoding: &JSON[string, duration]{}, Version: 2}),
+		WithMigration[string, duration](1, func(raw []byte) ([]byte, error) {
+			old := map[string]int{}
+			if err := json.Unmarshal(raw, &old); err != nil {
+				return nil, err
+			}
+			migrated := map[string]duration{}
+			for k, v := range old {
+				migrated[k] = duration{Seconds: v}
+			}
+			return json.Marshal(migrated)
+		}),
+	)
+	v2.Load()
+	assert.Equal(t, v2.Size(), 2, "The cache should have been migrated from version 1.")
+	d, ok := v2.Get("b")
+	assert.Equal(t, ok, true, "The value should be present in the cache.")
+	assert.Equal(t, d, duration{Seconds: 2}, "The value should have been migrated.")
+
+	// loading a version 0 file with no migration from version 0 fails
+	legacy.Store()
+	assert.ErrorContains(t, v2.Load(), "no migration from format version 0", "The missing migration should be reported.")
+
+	// newer formats cannot be decoded
+	v2.Store()
+	assert.ErrorContains(t, v1.Load(), "unsupported format version 2", "Newer formats should be rejected.")
+}
+
+func TestCacheMigrationExpiring(t *testing.T) {
+
+	// the migration only understands the cache data, not the expiry times
+	double := func(raw []byte) ([]byte, error) {
+		old := map[string]int{}
+		if err := json.Unmarshal(raw, &old); err != nil {
+			return nil, err
+		}
+		for k, v := range old {
+			old[k] = 2 * v
+		}
+		return json.Marshal(old)
+	}
+	compressed := func(e Encoding[string, int]) Encoding[string, int] {
+		c, _ := NewCompressed(e, gzip.DefaultCompression)
+		return c
+	}
+	for name, wrap := range map[string]func(Encoding[string, int]) Encoding[string, int]{
+		"plain":      func(e Encoding[string, int]) Encoding[string, int] { return e },
+		"compressed": compressed,
+	} {
+		persistence := &memory{}
+		v1 := New(
+			WithPersistence[string, int](persistence),
+			WithEncoding(wrap(&Versioned[string, int]{Encoding: &JSON[string, int]{}, Version: 1})),
+		)
+		v1.PutWithTTL("a", 1, time.Hour)
+		v1.Put("b", 2)
+		assert.NoError(t, v1.Store(), "Storing should succeed (%s).", name)
+		expiry, _ := v1.Expiry("a")
+
+		v2 := New(
+			WithPersistence[string, int](persistence),
+			WithEncoding(wrap(&Versioned[string, int]{Encoding: &JSON[string, int]{}, Version: 2})),
+			WithMigration[string, int](1, double),
+		)
+		assert.NoError(t, v2.Load(), "Loading should migrate the data (%s).", name)
+		assert.Equal(t, v2.Entries(), map[string]int{"a": 2, "b": 4}, "The data should have been migrated (%s).", name)
+		migrated, ok := v2.Expiry("a")
+		assert.True(t, ok, "The expiry times should be kept (%s).", name)
+		assert.True(t, migrated.Equal(expiry), "The expiry times should be kept (%s).", name)
+	}
+}
+
+// lossy is an encoding that drops an element when decoding.
+type lossy struct {
+	GOB[string, int]
+}
+
+func (l *lossy) Decode(data []byte) (map[string]int, error) {
+	m, err := l.GOB.Decode(data)
+	delete(m, "a")
+	return m, err
+}
+
+func TestCacheMigrateEncoding(t *testing.T) {
+
+	dir := t.TempDir()
+	current := &File{Path: filepath.Join(dir, "test.json")}
+	cache := New(
+		WithPersistence[string, int](current),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithPolicy[string, int](&Always{}),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+
+	// a mismatch leaves the current backends in place
+	err := cache.MigrateEncoding(&lossy{}, &File{Path: filepath.Join(dir, "lossy.gob")})
+	assert.ErrorIs(t, err, ErrMigrationMismatch, "The mismatch should be reported.")
+	cache.Put("c", 3)
+	restored := New(
+		WithPersistence[string, int](current),
+		WithEncoding[string, int](&JSON[string, int]{}),
+	)
+	assert.NoError(t, restored.Load(), "The current backends should still be in use.")
+	assert.Equal(t, restored.Size(), 3, "The current backends should still be in use.")
+
+	// a successful migration switches to the new backends
+	migrated := &File{Path: filepath.Join(dir, "test.gob")}
+	assert.NoError(t, cache.MigrateEncoding(&GOB[string, int]{}, migrated), "The migration should succeed.")
+	cache.Put("d", 4)
+	restored = New(
+		WithPersistence[string, int](migrated),
+		WithEncoding[string, int](&GOB[string, int]{}),
+	)
+	assert.NoError(t, restored.Load(), "The new backends should be readable.")
+	assert.True(t, Equal(cache, restored, Eq[int]), "The new backends should hold the cache contents.")
+	assert.Equal(t, restored.Size(), 4, "Later writes should go to the new backends.")
+}
+
+func TestJSONOmitEmpty(t *testing.T) {
+
+	type Address struct {
+		Street string `json:"street"`
+		City   string `json:"city,omitempty"`
+	}
+	type Base struct {
+		ID int
+	}
+	type Record struct {
+		Base
+		Name     string            `json:"name"`
+		Age      int               `json:"age"`
+		Active   bool              `json:"active"`
+		Tags     []string          `json:"tags"`
+		Scores   map[string]int    `json:"scores"`
+		Address  *Address          `json:"address"`
+		Previous []Address         `json:"previous"`
+		Ignored  string            `json:"-"`
+		Labels   map[string]string `json:"labels"`
+		hidden   int
+	}
+
+	data := map[string]Record{
+		"empty": {},
+		"sparse": {
+			Name:     "x",
+			Scores:   map[string]int{"zero": 0},
+			Previous: []Address{{}, {City: "Rome"}},
+		},
+		"full": {
+			Base:    Base{ID: 1},
+			Name:    "y",
+			Age:     42,
+			Active:  true,
+			Tags:    []string{"a", ""},
+			Address: &Address{Street: "Main"},
+			Labels:  map[string]string{"k": "v"},
+		},
+	}
+
+	compact, err := (&JSON[string, Record]{OmitEmpty: true}).Encode(data)
+	assert.NoError(t, err, "Encoding should succeed.")
+	plain, _ := (&JSON[string, Record]{}).Encode(data)
+	assert.Less(t, len(compact), len(plain)/2, "The compact encoding should be much smaller.")
+	assert.JSONEq(t, string(compact), `{
+		"empty": {},
+		"full": {"ID": 1, "name": "y", "age": 42, "active": true, "tags": ["a", ""], "address": {"street": "Main"}, "labels": {"k": "v"}},
+		"sparse": {"name": "x", "scores": {"zero": 0}, "previous": [{}, {"city": "Rome"}]}
+	}`, "The compact encoding is invalid.")
+
+	decoded, err := (&JSON[string, Record]{OmitEmpty: true}).Decode(compact)
+	assert.NoError(t, err, "Decoding should succeed.")
+	expected, _ := (&JSON[string, Record]{}).Decode(plain)
+	assert.Equal(t, decoded, expected, "The compact encoding should round-trip.")
+
+	// streaming produces the same output
+	var buffer bytes.Buffer
+	assert.NoError(t, (&JSON[string, Record]{OmitEmpty: true}).EncodeTo(&buffer, data), "Streaming should succeed.")
+	assert.Equal(t, buffer.String(), string(compact), "Streaming should produce the same output as encoding.")
+}
+
+func TestEntriesStructKeys(t *testing.T) {
+
+	type Point struct {
+		X int    `yaml:"x" toml:"x"`
+		Y int    `yaml:"y" toml:"y"`
+		Z string `yaml:"z" toml:"z"`
+	}
+	data := map[Point]string{
+		{X: 1, Y: 2}:          "a",
+		{X: -1, Y: 0, Z: "z"}: "b",
+		{}:                    "c",
+	}
+
+	for _, encoding := range []Encoding[Point, string]{
+		&YAML[Point, string]{Entries: true},
+		&TOML[Point, string]{Entries: true},
+	} {
+		encoded, err := encoding.Encode(data)
+		assert.NoError(t, err, "Encoding with %T should succeed.", encoding)
+		decoded, err := encoding.Decode(encoded)
+		assert.NoError(t, err, "Decoding with %T should succeed.", encoding)
+		assert.Equal(t, decoded, data, "The struct keys should round-trip with %T.", encoding)
+
+		// the output is stable
+		again, _ := encoding.Encode(data)
+		assert.Equal(t, string(again), string(encoded), "The encoding should be stable with %T.", encoding)
+	}
+
+	// through a cache
+	path := filepath.Join(t.TempDir(), "points.toml")
+	cache := New(
+		WithPersistence[Point, string](&File{Path: path}),
+		WithEncoding[Point, string](&TOML[Point, string]{Entries: true}),
+	)
+	for k, v := range data {
+		cache.Put(k, v)
+	}
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+	cache2 := New(
+		WithPersistence[Point, string](&File{Path: path}),
+		WithEncoding[Point, string](&TOML[Point, string]{Entries: true}),
+	)
+	assert.NoError(t, cache2.Load(), "Loading should succeed.")
+	assert.True(t, Equal(cache, cache2, Eq[string]), "The caches should be equal.")
+}
+
+func TestJSONNumericKeys(t *testing.T) {
+
+	for _, encoding := range []*JSON[int64, string]{{}, {Pretty: true}, {OmitEmpty: true}} {
+		data := map[int64]string{math.MinInt64: "min", -1: "minus one", 0: "zero", math.MaxInt64: "max"}
+		encoded, err := encoding.Encode(data)
+		assert.NoError(t, err, "Encoding int64 keys should not fail.")
+		decoded, err := encoding.Decode(encoded)
+		assert.NoError(t, err, "Decoding int64 keys should not fail.")
+		assert.Equal(t, decoded, data, "int64 keys should round-trip exactly.")
+
+		var buffer bytes.Buffer
+		assert.NoError(t, encoding.EncodeTo(&buffer, data), "Streaming int64 keys should not fail.")
+		decoded, _ = encoding.Decode(buffer.Bytes())
+		assert.Equal(t, decoded, data, "Streamed int64 keys should round-trip exactly.")
+	}
+
+	unsigned := &JSON[uint64, bool]{}
+	data := map[uint64]bool{0: false, math.MaxUint64: true}
+	encoded, _ := unsigned.Encode(data)
+	decoded, err := unsigned.Decode(encoded)
+	assert.NoError(t, err, "Decoding uint64 keys should not fail.")
+	assert.Equal(t, decoded, data, "uint64 keys should round-trip exactly.")
+
+	small := &JSON[int8, int]{}
+	encoded, _ = small.Encode(map[int8]int{math.MinInt8: 1, math.MaxInt8: 2})
+	assert.JSONEq(t, string(encoded), `{"-128": 1, "127": 2}`, "Keys should be encoded as decimal strings.")
+	_, err = small.Decode([]byte(`{"128": 1}`))
+	assert.Error(t, err, "Keys out of range should be rejected rather than wrapped around.")
+
+	ints := &JSON[int, int]{}
+	_, err = ints.Decode([]byte(`{"1e3": 1}`))
+	assert.Error(t, err, "Non-integer keys should be rejected.")
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrDecryption is returned (possibly wrapped) by an Encrypted encoding when
+// the data cannot be decrypted, because the key is wrong or the data has
+// been tampered with.
+var ErrDecryption = errors.New("error decrypting data (wrong key or tampered data)")
+
+// Encrypted wraps an Encoding, sealing the encoded data with AES-256-GCM
+// under a random nonce, which is prepended to the ciphertext; use
+// NewEncrypted to create one. Nonces are read from Rand, or from crypto/rand
+// if it is nil: it can be set to plug in a different source (e.g. an HSM), or
+// a deterministic one in tests.
+type Encrypted[K comparable, V any] struct {
+	Rand     io.Reader
+	encoding Encoding[K, V]
+	aead     cipher.AEAD
+}
+
+// NewEncrypted returns an Encrypted encoding wrapping the given one, sealing
+// the data with the given 256-bit key (see DeriveKey).
+func NewEncrypted[K comparable, V any](encoding Encoding[K, V], key [32]byte) (*Encrypted[K, V], error) {
+	if encoding == nil {
+		return nil, fmt.Errorf("no encoding to encrypt")
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypted[K, V]{encoding: encoding, aead: aead}, nil
+}
+
+// Encode encodes cache data with the wrapped encoding, and encrypts the
+// result.
+func (e *Encrypted[K, V]) Encode(data map[K]V) ([]byte, error) {
+	payload, err := e.encoding.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.seal(payload)
+}
+
+// encodeExpiring encodes cache data along with its expiry times with the
+// wrapped encoding, if it can carry them, and encrypts the result.
+func (e *Encrypted[K, V]) encodeExpiring(data map[K]V, expiries map[K]time.Time) ([]byte, error) {
+	payload, err := encodeExpiring(e.encoding, data, expiries)
+	if err != nil {
+		return nil, err
+	}
+	return e.seal(payload)
+}
+
+// Decode decrypts cache data and decodes it with the wrapped encoding.
+func (e *Encrypted[K, V]) Decode(data []byte) (map[K]V, error) {
+	payload, err := e.open(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.encoding.Decode(payload)
+}
+
+// decodeExpiring decrypts cache data and decodes it, along with its expiry
+// times, with the wrapped encoding.
+func (e *Encrypted[K, V]) decodeExpiring(data []byte) (map[K]V, map[K]time.Time, error) {
+	payload, err := e.open(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodeExpiring(e.encoding, payload)
+}
+
+// unwrap returns the wrapped encoding.
+func (e *Encrypted[K, V]) unwrap() Encoding[K, V] {
+	return e.encoding
+}
+
+// unwrapData decrypts cache data for the wrapped encoding.
+func (e *Encrypted[K, V]) unwrapData(data []byte) ([]byte, error) {
+	return e.open(data)
+}
+
+// seal encrypts the encoded data under a new nonce, which it is prefixed
+// with.
+func (e *Encrypted[K, V]) seal(payload []byte) ([]byte, error) {
+	source := e.Rand
+	if source == nil {
+		source = rand.Reader
+	}
+	nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(payload)+e.aead.Overhead())
+	if _, err := io.ReadFull(source, nonce); err != nil {
+		return nil, fmt.Errorf("error reading nonce: %w", err)
+	}
+	return e.aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+// open decrypts the encoded data, checking that it was not tampered with.
+func (e *Encrypted[K, V]) open(data []byte) ([]byte, error) {
+	if len(data) < e.aead.NonceSize()+e.aead.Overhead() {
+		return nil, fmt.Errorf("%w: data too short", ErrDecryption)
+	}
+	nonce, ciphertext := data[:e.aead.NonceSize()], data[e.aead.NonceSize():]
+	payload, err := e.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+	return payload, nil
+}
+
+// keySalt is the fixed salt used by DeriveKey.
+var keySalt = []byte("yagc-encrypted-encoding")
+
+// DeriveKey derives a 256-bit key for NewEncrypted from a passphrase using
+// scrypt; the salt is fixed, so the same passphrase always gives the same
+// key.
+func DeriveKey(passphrase string) [32]byte {
+	var key [32]byte
+	derived, err := scrypt.Key([]byte(passphrase), keySalt, 1<<15, 8, 1, len(key))
+	if err != nil {
+		// only happens with invalid parameters, and these are constant
+		panic(fmt.Sprintf("cache: deriving key failed: %v", err))
+	}
+	copy(key[:], derived)
+	return key
+}
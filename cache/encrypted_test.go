@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncrypted(t *testing.T) {
+
+	data := map[string]string{"a": "secret", "b": "top secret"}
+	key := DeriveKey("correct horse battery staple")
+	assert.Equal(t, DeriveKey("correct horse battery staple"), key, "Keys derived from the same passphrase should match.")
+	assert.NotEqual(t, DeriveKey("wrong horse"), key, "Keys derived from different passphrases should differ.")
+
+	for _, format := range []string{"json", "yaml", "toml", "gob"} {
+		encoding, _ := NewEncoding[string, string](format)
+		encrypted, err := NewEncrypted(encoding, key)
+		assert.NoError(t, err, "Creating the encrypted encoding should succeed.")
+
+		sealed, err := encrypted.Encode(data)
+		assert.NoError(t, err, "Encrypted encoding should succeed.")
+		assert.False(t, bytes.Contains(sealed, []byte("secret")), "Encrypted data should not contain the plaintext in %s format.", format)
+		again, _ := encrypted.Encode(data)
+		assert.NotEqual(t, again, sealed, "Nonces should be random.")
+
+		decoded, err := encrypted.Decode(sealed)
+		assert.NoError(t, err, "Encrypted decoding should succeed.")
+		assert.Equal(t, decoded, data, "Decoded data should match the original in %s format.", format)
+	}
+
+	_, err := NewEncrypted[string, string](nil, key)
+	assert.Error(t, err, "A missing encoding should be rejected.")
+}
+
+func TestEncryptedTampering(t *testing.T) {
+
+	data := map[string]string{"a": "secret"}
+	encrypted, _ := NewEncrypted[string, string](&JSON[string, string]{}, DeriveKey("passphrase"))
+	sealed, _ := encrypted.Encode(data)
+
+	other, _ := NewEncrypted[string, string](&JSON[string, string]{}, DeriveKey("other passphrase"))
+	_, err := other.Decode(sealed)
+	assert.True(t, errors.Is(err, ErrDecryption), "Decoding with the wrong key should fail.")
+
+	for i := range sealed {
+		tampered := append([]byte{}, sealed...)
+		tampered[i] ^= 0x01
+		_, err := encrypted.Decode(tampered)
+		assert.True(t, errors.Is(err, ErrDecryption), "Decoding tampered data should fail at byte %d.", i)
+	}
+
+	_, err = encrypted.Decode(sealed[:10])
+	assert.True(t, errors.Is(err, ErrDecryption), "Decoding truncated data should fail.")
+}
+
+func TestEncryptedRand(t *testing.T) {
+
+	data := map[string]string{"a": "secret"}
+	nonce := bytes.Repeat([]byte{0x2a}, 12)
+	encrypted, _ := NewEncrypted[string, string](&JSON[string, string]{}, DeriveKey("passphrase"))
+
+	encrypted.Rand = bytes.NewReader(nonce)
+	sealed, err := encrypted.Encode(data)
+	assert.NoError(t, err, "Encrypted encoding should succeed.")
+	assert.Equal(t, sealed[:12], nonce, "The nonce should come from the given source.")
+	encrypted.Rand = bytes.NewReader(nonce)
+	again, _ := encrypted.Encode(data)
+	assert.Equal(t, again, sealed, "The same nonce should give the same ciphertext.")
+
+	encrypted.Rand = bytes.NewReader(nonce[:4])
+	_, err = encrypted.Encode(data)
+	assert.Error(t, err, "A short read from the nonce source should fail.")
+}
+
+func TestCacheEncrypted(t *testing.T) {
+
+	encoding, _ := NewEncrypted[string, int](&GOB[string, int]{}, DeriveKey("passphrase"))
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](encoding),
+	)
+	cache.Put("a", 1)
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	cache2 := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](encoding),
+	)
+	assert.NoError(t, cache2.Load(), "Loading should succeed.")
+	value, _ := cache2.Get("a")
+	assert.Equal(t, value, 1, "The value is invalid.")
+}
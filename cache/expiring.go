@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ExpiringEncoding is implemented by encodings that can carry the expiry
+// times of the elements (see PutWithTTL) inside the encoded data, along with
+// the elements themselves: JoinExpiries combines the cache data, as encoded
+// by Encode, with the expiry times, and SplitExpiries separates them again,
+// returning the cache data for Decode; data with no expiry times is only
+// ever encoded by Encode.
+type ExpiringEncoding[K comparable] interface {
+	JoinExpiries(encoded []byte, expiries map[K]time.Time) ([]byte, error)
+	SplitExpiries(data []byte) ([]byte, map[K]time.Time, error)
+}
+
+// expiringWrapper is implemented by encodings wrapping another one, which
+// encode the expiry times along with the cache data through it; unwrapData
+// returns the data for the wrapped encoding to decode.
+type expiringWrapper[K comparable, V any] interface {
+	unwrap() Encoding[K, V]
+	unwrapData(data []byte) ([]byte, error)
+	encodeExpiring(data map[K]V, expiries map[K]time.Time) ([]byte, error)
+	decodeExpiring(data []byte) (map[K]V, map[K]time.Time, error)
+}
+
+// canExpire returns whether the given encoding, or the one it wraps, can
+// carry expiry times.
+func canExpire[K comparable, V any](e Encoding[K, V]) bool {
+	switch e := e.(type) {
+	case expiringWrapper[K, V]:
+		return canExpire(e.unwrap())
+	case ExpiringEncoding[K]:
+		return true
+	}
+	return false
+}
+
+// encodeExpiring encodes cache data along with its expiry times, if the
+// encoding can carry them.
+func encodeExpiring[K comparable, V any](e Encoding[K, V], data map[K]V, expiries map[K]time.Time) ([]byte, error) {
+	if len(expiries) == 0 {
+		return e.Encode(data)
+	}
+	switch x := e.(type) {
+	case expiringWrapper[K, V]:
+		return x.encodeExpiring(data, expiries)
+	case ExpiringEncoding[K]:
+		encoded, err := e.Encode(data)
+		if err != nil {
+			return nil, err
+		}
+		return x.JoinExpiries(encoded, expiries)
+	}
+	return e.Encode(data)
+}
+
+// decodeExpiring decodes cache data along with its expiry times, if the
+// encoding can carry them.
+func decodeExpiring[K comparable, V any](e Encoding[K, V], data []byte) (map[K]V, map[K]time.Time, error) {
+	var expiries map[K]time.Time
+	switch x := e.(type) {
+	case expiringWrapper[K, V]:
+		return x.decodeExpiring(data)
+	case ExpiringEncoding[K]:
+		var err error
+		if data, expiries, err = x.SplitExpiries(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	m, err := e.Decode(data)
+	return m, expiries, err
+}
+
+// The text encodings carry the expiry times in an envelope with exactly
+// these two fields, the cache data and the expiry times.
+const (
+	dataField     = "__data"
+	expiriesField = "__expiries"
+)
+
+// isEnvelope returns whether the decoded fields are those of an envelope.
+func isEnvelope[T any](fields map[string]T) bool {
+	_, data := fields[dataField]
+	_, expiries := fields[expiriesField]
+	return len(fields) == 2 && data && expiries
+}
+
+// JoinExpiries wraps cache data in JSON format in an envelope, along with
+// the expiry times.
+func (j *JSON[K, V]) JoinExpiries(encoded []byte, expiries map[K]time.Time) ([]byte, error) {
+	times, err := json.Marshal(expiries)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(`{"` + dataField + `":`)
+	if err := json.Compact(&buffer, encoded); err != nil {
+		return nil, err
+	}
+	buffer.WriteString(`,"` + expiriesField + `":`)
+	buffer.Write(times)
+	buffer.WriteByte('}')
+	if !j.Pretty {
+		return buffer.Bytes(), nil
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, buffer.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	return pretty.Bytes(), nil
+}
+
+// SplitExpiries unwraps cache data in JSON format from its envelope, if it
+// is in one, along with the expiry times.
+func (*JSON[K, V]) SplitExpiries(data []byte) ([]byte, map[K]time.Time, error) {
+	if !bytes.Contains(data, []byte(`"`+expiriesField+`"`)) {
+		return data, nil, nil
+	}
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(data, &fields) != nil || !isEnvelope(fields) {
+		return data, nil, nil
+	}
+	expiries := map[K]time.Time{}
+	if err := json.Unmarshal(fields[expiriesField], &expiries); err != nil {
+		return nil, nil, fmt.Errorf("invalid expiry times: %w", err)
+	}
+	return fields[dataField], expiries, nil
+}
+
+// JoinExpiries wraps cache data in YAML format in an envelope, along with
+// the expiry times; with Entries, the expiry times are a list of key/value
+// entries too.
+func (y *YAML[K, V]) JoinExpiries(encoded []byte, expiries map[K]time.Time) ([]byte, error) {
+	var data, times yaml.Node
+	if err := yaml.Unmarshal(encoded, &data); err != nil {
+		return nil, err
+	}
+	var err error
+	if y.Entries {
+		err = times.Encode(toEntries(expiries))
+	} else {
+		err = times.Encode(expiries)
+	}
+	if err != nil {
+		return nil, err
+	}
+	envelope := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: dataField}, data.Content[0],
+		{Kind: yaml.ScalarNode, Value: expiriesField}, &times,
+	}}
+	return yaml.Marshal(envelope)
+}
+
+// SplitExpiries unwraps cache data in YAML format from its envelope, if it
+// is in one, along with the expiry times.
+func (y *YAML[K, V]) SplitExpiries(data []byte) ([]byte, map[K]time.Time, error) {
+	if !bytes.Contains(data, []byte(expiriesField)) {
+		return data, nil, nil
+	}
+	fields := map[string]yaml.Node{}
+	if yaml.Unmarshal(data, &fields) != nil || !isEnvelope(fields) {
+		return data, nil, nil
+	}
+	node, times := fields[dataField], fields[expiriesField]
+	var expiries map[K]time.Time
+	if y.Entries {
+		entries := []Entry[K, time.Time]{}
+		if err := times.Decode(&entries); err != nil {
+			return nil, nil, fmt.Errorf("invalid expiry times: %w", err)
+		}
+		expiries = fromEntries(entries)
+	} else if err := times.Decode(&expiries); err != nil {
+		return nil, nil, fmt.Errorf("invalid expiry times: %w", err)
+	}
+	data, err := yaml.Marshal(&node)
+	return data, expiries, err
+}
+
+// tomlExpiries is the table of expiry times that follows cache data in TOML
+// format.
+type tomlExpiries[K comparable] struct {
+	Expiries map[K]time.Time `toml:"__expiries"`
+}
+
+// tomlExpiryEntries is the array of expiry times that follows cache data in
+// TOML format encoded as entries.
+type tomlExpiryEntries[K comparable] struct {
+	Expiries []Entry[K, time.Time] `toml:"__expiries"`
+}
+
+// JoinExpiries appends the expiry times to cache data in TOML format, as a
+// table (or an array of key/value tables, with Entries) of its own.
+func (t *TOML[K, V]) JoinExpiries(encoded []byte, expiries map[K]time.Time) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if t.Entries {
+		err = toml.NewEncoder(&buffer).Encode(tomlExpiryEntries[K]{Expiries: toEntries(expiries)})
+	} else {
+		err = toml.NewEncoder(&buffer).Encode(tomlExpiries[K]{Expiries: expiries})
+	}
+	if err != nil {
+		return nil, err
+	}
+	joined := append(bytes.Clone(encoded), '\n')
+	return append(joined, buffer.Bytes()...), nil
+}
+
+// SplitExpiries separates the expiry times from cache data in TOML format,
+// if they follow it.
+func (t *TOML[K, V]) SplitExpiries(data []byte) ([]byte, map[K]time.Time, error) {
+	header := []byte("[" + expiriesField + "]")
+	if t.Entries {
+		header = []byte("[[" + expiriesField + "]]")
+	}
+	// the encoder escapes newlines in strings, so headers start lines
+	i := bytes.Index(data, header)
+	for i > 0 && data[i-1] != '\n' {
+		j := bytes.Index(data[i+1:], header)
+		if j < 0 {
+			return data, nil, nil
+		}
+		i += j + 1
+	}
+	if i < 0 {
+		return data, nil, nil
+	}
+	var expiries map[K]time.Time
+	if t.Entries {
+		tail := tomlExpiryEntries[K]{}
+		if _, err := toml.Decode(string(data[i:]), &tail); err != nil {
+			return nil, nil, fmt.Errorf("invalid expiry times: %w", err)
+		}
+		expiries = fromEntries(tail.Expiries)
+	} else {
+		tail := tomlExpiries[K]{}
+		if _, err := toml.Decode(string(data[i:]), &tail); err != nil {
+			return nil, nil, fmt.Errorf("invalid expiry times: %w", err)
+		}
+		expiries = tail.Expiries
+	}
+	return data[:i], expiries, nil
+}
+
+// gobExpiriesMagic ends cache data in self-describing binary format that is
+// followed by the expiry times.
+var gobExpiriesMagic = []byte("\x00yagcttl")
+
+// JoinExpiries appends the expiry times to cache data in self-describing
+// binary format, followed by their length and a marker.
+func (*GOB[K, V]) JoinExpiries(encoded []byte, expiries map[K]time.Time) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&expiries); err != nil {
+		return nil, err
+	}
+	joined := append(bytes.Clone(encoded), buffer.Bytes()...)
+	joined = binary.BigEndian.AppendUint64(joined, uint64(buffer.Len()))
+	return append(joined, gobExpiriesMagic...), nil
+}
+
+// SplitExpiries separates the expiry times from cache data in
+// self-describing binary format, if they follow it.
+func (*GOB[K, V]) SplitExpiries(data []byte) ([]byte, map[K]time.Time, error) {
+	if !bytes.HasSuffix(data, gobExpiriesMagic) {
+		return data, nil, nil
+	}
+	end := len(data) - len(gobExpiriesMagic) - 8
+	if end < 0 {
+		return nil, nil, errors.New("invalid expiry times")
+	}
+	size := binary.BigEndian.Uint64(data[end:])
+	if size > uint64(end) {
+		return nil, nil, errors.New("invalid expiry times")
+	}
+	start := end - int(size)
+	expiries := map[K]time.Time{}
+	if err := gob.NewDecoder(bytes.NewReader(data[start:end])).Decode(&expiries); err != nil {
+		return nil, nil, fmt.Errorf("invalid expiry times: %w", err)
+	}
+	return data[:start], expiries, nil
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"sync"
+)
+
+// factory holds a pending lazy or computed value along with the result of
+// building it.
+type factory[V any] struct {
+	once  sync.Once
+	fn    func() (V, error)
+	value V
+	err   error
+}
+
+// PutLazy stores a factory for the value of the given key, unless a value
+// already exists: the first Get for the key invokes the factory, once across
+// all concurrent callers, and replaces it with the value it returns. When the
+// factory fails nothing is stored, and the next Get tries again. Pending
+// factories are not persisted, nor counted in the size of the Cache; a value
+// stored with Put or Replace in the meantime supersedes the factory. A
+// read-only Cache (see ReadOnly) stores no factory and returns false, and
+// pending factories resolved while it is read-only are not stored either.
+func (c *Cache[K, V]) PutLazy(k K, fn func() (V, error)) bool {
+	defer c.timed("put")()
+	if c.logger != nil {
+		c.logger.Debug("putting lazy value into cache", "key", k)
+	}
+	if fn == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return false
+	}
+	if _, ok := c.liveNoLock(k); ok {
+		return false
+	}
+	if c.factories == nil {
+		c.factories = map[K]*factory[V]{}
+	}
+	c.factories[k] = &factory[V]{fn: fn}
+	return true
+}
+
+// resolve invokes the given factory for the key, if no other caller has done
+// so yet, and stores the value it returns unless the factory was superseded
+// in the meantime; it returns the value in the Cache.
+func (c *Cache[K, V]) resolve(k K, f *factory[V]) (V, bool) {
+	f.once.Do(func() {
+		if c.logger != nil {
+			c.logger.Debug("building lazy value", "key", k)
+		}
+		f.value, f.err = f.fn()
+	})
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if v, ok := c.liveNoLock(k); ok {
+		return v, true
+	}
+	if c.rejected() {
+		return f.value, f.err == nil
+	}
+	var zero V
+	if c.factories[k] != f {
+		return zero, false
+	}
+	if f.err != nil {
+		if c.logger != nil {
+			c.logger.Error("error building lazy value", "key", k, "error", f.err)
+		}
+		// give the next Get a chance to try again
+		c.factories[k] = &factory[V]{fn: f.fn}
+		return zero, false
+	}
+	c.setNoLock(k, f.value)
+	c.storeNoLock(false)
+	if c.logger != nil {
+		c.logger.Debug("lazy value stored into cache", "key", k, "value", f.value)
+	}
+	return f.value, true
+}
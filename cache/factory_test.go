@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePutLazy(t *testing.T) {
+
+	var calls atomic.Int32
+	cache := New[string, int]()
+	assert.True(t, cache.PutLazy("a", func() (int, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return 42, nil
+	}), "The factory should have been stored.")
+	assert.Equal(t, cache.Size(), 0, "Pending factories should not be counted.")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, ok := cache.Get("a")
+			assert.True(t, ok, "The value should be present in the cache.")
+			assert.Equal(t, v, 42, "The value should have been built by the factory.")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, calls.Load(), int32(1), "The factory should have run exactly once.")
+	assert.Equal(t, cache.Size(), 1, "The value should have replaced the factory.")
+	assert.False(t, cache.PutLazy("a", func() (int, error) { return 0, nil }), "Existing values should not be replaced.")
+}
+
+func TestCachePutLazyError(t *testing.T) {
+
+	failures := 1
+	cache := New[string, int]()
+	cache.PutLazy("a", func() (int, error) {
+		if failures > 0 {
+			failures--
+			return 0, errors.New("origin down")
+		}
+		return 1, nil
+	})
+
+	_, ok := cache.Get("a")
+	assert.False(t, ok, "A failed factory should result in a miss.")
+	assert.Equal(t, cache.Size(), 0, "A failed factory should not store anything.")
+
+	v, ok := cache.Get("a")
+	assert.True(t, ok, "The factory should be retried.")
+	assert.Equal(t, v, 1, "The value should have been built by the factory.")
+
+	cache.PutLazy("b", func() (int, error) { return 2, nil })
+	cache.Delete("b")
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "Deleting a key should drop its factory.")
+}
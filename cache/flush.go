@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// WithDeadlineAwareFlush applies the deadline-aware flush option to the
+// Cache: whenever the policy requires the cache to be stored, the write is
+// deferred until the application signals an idle window via SignalIdle(),
+// or until maxDefer has elapsed since the first deferred write, whichever
+// comes first. Explicit calls to Store() are never deferred.
+func WithDeadlineAwareFlush[K comparable, V any](maxDefer time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if maxDefer > 0 {
+			c.maxDefer = maxDefer
+		}
+	}
+}
+
+// WithLazyPersistence applies the lazy persistence option to the Cache: no
+// data is written to persistent storage as long as the cache is empty and
+// has never been stored or loaded, so that no empty file gets created before
+// there is anything meaningful in it. Explicit calls to Store() are always
+// honoured.
+func WithLazyPersistence[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.lazy = true
+	}
+}
+
+// SignalIdle tells the Cache that the application is in a low-traffic
+// window, so that any deferred write can be flushed to persistent storage.
+func (c *Cache[K, V]) SignalIdle() error {
+	c.deferLock.Lock()
+	pending := c.deferTimer != nil
+	c.deferLock.Unlock()
+	if !pending {
+		if c.logger != nil {
+			c.logger.Debug("idle signalled, nothing to flush")
+		}
+		return nil
+	}
+	if c.logger != nil {
+		c.logger.Debug("idle signalled, flushing deferred writes")
+	}
+	defer c.storeLock()()
+	return c.flushNoLock()
+}
+
+// deferNoLock marks the Cache as dirty and arms the timer that flushes it
+// anyway after the maximum deferral; it must be called with the lock held.
+func (c *Cache[K, V]) deferNoLock() {
+	c.dirty.Store(true)
+	c.deferLock.Lock()
+	defer c.deferLock.Unlock()
+	if c.deferTimer == nil {
+		c.deferTimer = time.AfterFunc(c.maxDefer, c.flushDeferred)
+	}
+}
+
+// flushDeferred flushes the deferred writes once the maximum deferral has
+// elapsed with no idle window.
+func (c *Cache[K, V]) flushDeferred() {
+	c.deferLock.Lock()
+	c.deferTimer = nil
+	c.deferLock.Unlock()
+	if !c.dirty.Load() {
+		return
+	}
+	if c.logger != nil {
+		c.logger.Debug("maximum deferral elapsed, flushing deferred writes")
+	}
+	defer c.storeLock()()
+	c.flushNoLock()
+}
+
+// flushed records that the Cache contents have been successfully written to
+// persistent storage, so there is nothing left to flush.
+func (c *Cache[K, V]) flushed() {
+	c.dirty.Store(false)
+	c.persisted.Store(true)
+	c.resetDirtyKeys()
+	c.deferLock.Lock()
+	defer c.deferLock.Unlock()
+	if c.deferTimer != nil {
+		c.deferTimer.Stop()
+		c.deferTimer = nil
+	}
+}
+
+// pristineNoLock returns whether lazy persistence applies and the Cache has
+// nothing worth writing yet; it must be called with the lock held.
+func (c *Cache[K, V]) pristineNoLock() bool {
+	return c.lazy && !c.persisted.Load() && c.store.Len() == 0
+}
+
+// SaveEvery starts a goroutine that stores the cache every interval, as a
+// wall-clock backup independent of the policy, whenever it has changes not
+// yet persisted (but never after a failed strict load); it returns a
+// function that stops the goroutine and waits for it to exit, which Close
+// also does. A non-positive interval starts nothing.
+func (c *Cache[K, V]) SaveEvery(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		if c.logger != nil {
+			c.logger.Warn("invalid save interval, not saving on schedule", "interval", interval)
+		}
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !c.dirty.Load() {
+					continue
+				}
+				if c.logger != nil {
+					c.logger.Debug("saving cache on schedule")
+				}
+				c.save()
+			}
+		}
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+	c.onClose(stop)
+	return stop
+}
+
+// save stores the cache on schedule.
+func (c *Cache[K, V]) save() {
+	defer c.storeLock()()
+	if err := c.flushNoLock(); err != nil && c.logger != nil {
+		c.logger.Error("error saving cache on schedule", "error", err)
+	}
+}
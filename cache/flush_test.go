@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheDeadlineAwareFlush(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+		WithDeadlineAwareFlush[string, string](time.Hour),
+	)
+
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+	cache.Delete("a")
+	assert.Equal(t, persistence.Writes(), 0, "The writes should have been deferred.")
+
+	assert.NoError(t, cache.SignalIdle(), "Flushing on idle should succeed.")
+	assert.Equal(t, persistence.Writes(), 1, "The deferred writes should have been flushed once.")
+	assert.NoError(t, cache.SignalIdle(), "Flushing on idle should succeed.")
+	assert.Equal(t, persistence.Writes(), 1, "There should be nothing left to flush.")
+
+	// explicit stores are never deferred
+	cache.Store()
+	assert.Equal(t, persistence.Writes(), 2, "Explicit stores should not be deferred.")
+
+	// with no idle window, the maximum deferral forces the flush
+	persistence = &memory{}
+	cache = New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+		WithDeadlineAwareFlush[string, string](50*time.Millisecond),
+	)
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+	assert.Equal(t, persistence.Writes(), 0, "The writes should have been deferred.")
+	assert.Eventually(t, func() bool { return persistence.Writes() == 1 }, time.Second, 10*time.Millisecond, "The deferred writes should have been flushed after the maximum deferral.")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 1, "The deferred writes should have been flushed once.")
+}
+
+func TestCacheLazyPersistence(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithPolicy[string, string](&Always{}),
+		WithLazyPersistence[string, string](),
+	)
+
+	cache.Clear()
+	cache.Delete("a")
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "No file should be written while the cache is empty.")
+
+	cache.Put("a", "aaa")
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "The file should be written with the first entry.")
+
+	// once written, emptying the cache is persisted as usual
+	cache.Delete("a")
+	restored := New(WithPersistence[string, string](&File{Path: path}))
+	restored.Put("b", "bbb")
+	assert.NoError(t, restored.Load(), "Loading the cache should not fail.")
+	assert.Equal(t, restored.Size(), 0, "The deletion should have been persisted.")
+}
+
+func TestCacheSaveEvery(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Never{}),
+	)
+	stop := cache.SaveEvery(5 * time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 0, "A clean cache should not be saved.")
+
+	cache.Put("a", "aaa")
+	for i := 0; i < 100 && persistence.Writes() == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, persistence.Writes(), 1, "The change should have been saved once.")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 1, "The cache should not be saved again until it changes.")
+
+	stop()
+	stop()
+	cache.Put("b", "bbb")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 1, "No saves should happen once stopped.")
+}
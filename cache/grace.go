@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"time"
+)
+
+// grave holds a deleted value during its grace period.
+type grave[V any] struct {
+	value   V
+	deleted time.Time
+}
+
+// WithDeleteGrace applies the delete grace option to the Cache: deleted
+// elements disappear from the Cache immediately, but their values are kept
+// aside for the given grace period, during which Undelete can bring them
+// back; writing a deleted key within the grace period simply resurrects
+// it with the new value. Values are reaped once the grace period is over.
+func WithDeleteGrace[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if d > 0 {
+			c.deleteGrace = d
+			c.graveyard = map[K]grave[V]{}
+		}
+	}
+}
+
+// Undelete restores an element deleted within the grace period, returning
+// whether it could be restored and its value; a read-only Cache (see
+// ReadOnly) restores nothing.
+func (c *Cache[K, V]) Undelete(k K) (V, bool) {
+	if c.logger != nil {
+		c.logger.Debug("restoring deleted value into cache", "key", k)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		var zero V
+		return zero, false
+	}
+	g, ok := c.graveyard[k]
+	if !ok || c.clock().Sub(g.deleted) > c.deleteGrace {
+		var zero V
+		return zero, false
+	}
+	c.setNoLock(k, g.value)
+	c.storeNoLock(false)
+	if c.logger != nil {
+		c.logger.Debug("deleted value restored into cache", "key", k, "value", g.value)
+	}
+	return g.value, true
+}
+
+// buryNoLock keeps the value of an element being deleted aside for the
+// grace period; it must be called with the write lock held.
+func (c *Cache[K, V]) buryNoLock(k K, v V) {
+	if c.deleteGrace == 0 {
+		return
+	}
+	c.graveyard[k] = grave[V]{value: v, deleted: c.clock()}
+	if c.graceTimer == nil {
+		c.graceTimer = time.AfterFunc(c.deleteGrace, c.reap)
+	}
+}
+
+// reap drops the deleted values whose grace period is over, rescheduling
+// itself while some are still within their grace period.
+func (c *Cache[K, V]) reap() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.graceTimer == nil {
+		// stopped by Close
+		return
+	}
+	c.reapNoLock()
+	if len(c.graveyard) > 0 {
+		c.graceTimer.Reset(c.deleteGrace)
+	} else {
+		c.graceTimer = nil
+	}
+}
+
+// reapNoLock drops the deleted values whose grace period is over; it must
+// be called with the write lock held.
+func (c *Cache[K, V]) reapNoLock() {
+	now := c.clock()
+	for k, g := range c.graveyard {
+		if now.Sub(g.deleted) > c.deleteGrace {
+			if c.logger != nil {
+				c.logger.Debug("reaping deleted value", "key", k)
+			}
+			delete(c.graveyard, k)
+		}
+	}
+}
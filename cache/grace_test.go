@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheDeleteGrace(t *testing.T) {
+
+	now := time.Now()
+	cache := New(WithDeleteGrace[string, string](time.Minute))
+	cache.clock = func() time.Time { return now }
+
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+	cache.Delete("a")
+	cache.Delete("b")
+
+	// deleted elements are hidden immediately
+	_, ok := cache.Get("a")
+	assert.Equal(t, ok, false, "The deleted value should be hidden.")
+	assert.Equal(t, cache.Size(), 0, "The cache size is invalid.")
+	assert.ElementsMatch(t, cache.Keys(), []string{}, "The key set is invalid.")
+
+	// within the grace period they can be resurrected
+	now = now.Add(30 * time.Second)
+	v, ok := cache.Undelete("a")
+	assert.Equal(t, ok, true, "The value should have been restored.")
+	assert.Equal(t, v, "aaa", "The restored value should be as expected.")
+	v, ok = cache.Get("a")
+	assert.Equal(t, ok, true, "The restored value should be visible.")
+	assert.Equal(t, v, "aaa", "The value should be as expected.")
+
+	// after the grace period they are reaped
+	now = now.Add(time.Minute)
+	cache.reap()
+	_, ok = cache.Undelete("b")
+	assert.Equal(t, ok, false, "The value should have been reaped.")
+	assert.Len(t, cache.graveyard, 0, "The deleted values should have been reaped.")
+
+	// a re-Put within the grace period resurrects the key with the new value
+	cache.Delete("a")
+	ok = cache.Put("a", "new")
+	assert.Equal(t, ok, true, "The value should have been put.")
+	_, ok = cache.Undelete("a")
+	assert.Equal(t, ok, false, "There should be nothing left to restore.")
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "new", "The value should be as expected.")
+}
+
+func TestCacheDeleteGraceTimer(t *testing.T) {
+
+	cache := New(WithDeleteGrace[string, string](20 * time.Millisecond))
+	cache.Put("a", "aaa")
+	cache.Delete("a")
+	assert.Eventually(t, func() bool {
+		cache.lock.RLock()
+		defer cache.lock.RUnlock()
+		return len(cache.graveyard) == 0 && cache.graceTimer == nil
+	}, time.Second, 10*time.Millisecond, "The deleted value should have been reaped in the background.")
+}
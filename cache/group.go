@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// Group is a set of named Caches, or namespaces, persisted together as a
+// single nested map from the namespace name to its contents; each Cache
+// keeps its own options, e.g. its policy, but the Group alone is in charge
+// of persisting them. Expiry times (see PutWithTTL) are persisted along, if
+// the encoding can carry them (see ExpiringEncoding), under keys made of the
+// namespace name and the element key in JSON format; otherwise, elements
+// with an expiry are not persisted.
+type Group[K comparable, V any] struct {
+	lock        sync.Mutex
+	caches      map[string]*Cache[K, V]
+	encoding    Encoding[string, map[K]V]
+	persistence Persistence
+	options     []Option[K, V]
+}
+
+// NewGroup creates a new Group whose namespaces are encoded with the given
+// encoding and persisted to the given persistence; the options are applied
+// to each namespace as it is created, before those of the namespace itself
+// (see Cache).
+func NewGroup[K comparable, V any](encoding Encoding[string, map[K]V], persistence Persistence, options ...Option[K, V]) *Group[K, V] {
+	return &Group[K, V]{
+		caches:      map[string]*Cache[K, V]{},
+		encoding:    encoding,
+		persistence: persistence,
+		options:     options,
+	}
+}
+
+// Cache returns the namespace with the given name, creating it if missing
+// with the options of the Group followed by the given ones; the options are
+// ignored if the namespace already exists, e.g. because it was created by
+// Load, so namespaces needing options of their own should be created first.
+func (g *Group[K, V]) Cache(name string, options ...Option[K, V]) *Cache[K, V] {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.cacheNoLock(name, options)
+}
+
+// cacheNoLock returns the namespace with the given name, creating it if
+// missing; it must be called with the lock held.
+func (g *Group[K, V]) cacheNoLock(name string, options []Option[K, V]) *Cache[K, V] {
+	c, ok := g.caches[name]
+	if !ok {
+		all := make([]Option[K, V], 0, len(g.options)+len(options))
+		all = append(append(all, g.options...), options...)
+		c = New(all...)
+		g.caches[name] = c
+	}
+	return c
+}
+
+// Names returns the sorted names of the namespaces in the Group.
+func (g *Group[K, V]) Names() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	names := make([]string, 0, len(g.caches))
+	for name := range g.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store persists the contents of all the namespaces in the Group.
+func (g *Group[K, V]) Store() error {
+	if g.encoding == nil || g.persistence == nil {
+		return errors.New("invalid encoding or persistence")
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	expiring := canExpire(g.encoding)
+	data := make(map[string]map[K]V, len(g.caches))
+	expiries := map[string]time.Time{}
+	for name, c := range g.caches {
+		c.lock.RLock()
+		namespace, times := c.expiringIfNoLock(expiring, c.persistedNoLock())
+		data[name] = maps.Clone(namespace)
+		c.lock.RUnlock()
+		for k, t := range times {
+			key, err := groupExpiryKey(name, k)
+			if err != nil {
+				return err
+			}
+			expiries[key] = t
+		}
+	}
+	encoded, err := encodeExpiring(g.encoding, data, expiries)
+	if err != nil {
+		return err
+	}
+	if err := g.persistence.Write(encoded); err != nil {
+		return err
+	}
+	for _, c := range g.caches {
+		c.flushed()
+	}
+	return nil
+}
+
+// Load reads back the contents of all the namespaces in the Group, along
+// with their expiry times, creating those that are missing; the namespaces
+// that are not in the persisted data are emptied.
+func (g *Group[K, V]) Load() error {
+	if g.encoding == nil || g.persistence == nil {
+		return errors.New("invalid encoding or persistence")
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	encoded, err := g.persistence.Read()
+	if err != nil {
+		return err
+	}
+	data, times, err := decodeExpiring(g.encoding, encoded)
+	if err != nil {
+		return err
+	}
+	expiries := map[string]map[K]time.Time{}
+	for key, t := range times {
+		name, k, err := parseGroupExpiryKey[K](key)
+		if err != nil {
+			return err
+		}
+		if expiries[name] == nil {
+			expiries[name] = map[K]time.Time{}
+		}
+		expiries[name][k] = t
+	}
+	for name := range data {
+		g.cacheNoLock(name, nil)
+	}
+	for name, c := range g.caches {
+		m := data[name]
+		if m == nil {
+			m = map[K]V{}
+		}
+		c.lock.Lock()
+		c.swapNoLock(transform(m, c.loadTransform), expiries[name])
+		c.lock.Unlock()
+	}
+	return nil
+}
+
+// groupExpiryKey returns the key of the expiry time of the element under the
+// given key in the given namespace, i.e. the JSON array of the two.
+func groupExpiryKey[K comparable](name string, k K) (string, error) {
+	key, err := json.Marshal([]any{name, k})
+	if err != nil {
+		return "", fmt.Errorf("invalid key %v in namespace %q: %w", k, name, err)
+	}
+	return string(key), nil
+}
+
+// parseGroupExpiryKey returns the namespace and the element key the given
+// expiry time key is made of.
+func parseGroupExpiryKey[K comparable](key string) (string, K, error) {
+	var (
+		parts []json.RawMessage
+		name  string
+		k     K
+	)
+	if err := json.Unmarshal([]byte(key), &parts); err != nil || len(parts) != 2 {
+		return "", k, fmt.Errorf("invalid expiry time key %q", key)
+	}
+	if err := json.Unmarshal(parts[0], &name); err != nil {
+		return "", k, fmt.Errorf("invalid expiry time key %q: %w", key, err)
+	}
+	if err := json.Unmarshal(parts[1], &k); err != nil {
+		return "", k, fmt.Errorf("invalid expiry time key %q: %w", key, err)
+	}
+	return name, k, nil
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	group := NewGroup[string, int](&JSON[string, map[string]int]{}, &File{Path: path})
+	group.Cache("users").Put("alice", 1)
+	group.Cache("users").Put("bob", 2)
+	group.Cache("groups").Put("admins", 10)
+	assert.Equal(t, group.Cache("users").Size(), 2, "The same namespace should be returned each time.")
+	assert.NoError(t, group.Store(), "Storing the group should succeed.")
+
+	loaded := NewGroup[string, int](&JSON[string, map[string]int]{}, &File{Path: path})
+	loaded.Cache("stale").Put("x", 0)
+	assert.NoError(t, loaded.Load(), "Loading the group should succeed.")
+	assert.Equal(t, loaded.Names(), []string{"groups", "stale", "users"}, "All namespaces should be reconstructed.")
+	assert.ElementsMatch(t, loaded.Cache("users").Keys(), []string{"alice", "bob"}, "The users namespace is invalid.")
+	v, ok := loaded.Cache("groups").Get("admins")
+	assert.True(t, ok, "The groups namespace should hold its element.")
+	assert.Equal(t, v, 10, "The groups namespace is invalid.")
+	assert.Equal(t, loaded.Cache("stale").Size(), 0, "Namespaces not in the persisted data should be emptied.")
+}
+
+func TestGroupTTL(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	group := NewGroup[string, int](&JSON[string, map[string]int]{}, &File{Path: path})
+	group.Cache("users").PutWithTTL("alice", 1, time.Hour)
+	group.Cache("users").Put("bob", 2)
+	group.Cache("groups").PutWithTTL("alice", 10, 2*time.Hour)
+	assert.NoError(t, group.Store(), "Storing the group should succeed.")
+
+	loaded := NewGroup[string, int](&JSON[string, map[string]int]{}, &File{Path: path})
+	assert.NoError(t, loaded.Load(), "Loading the group should succeed.")
+	for _, name := range []string{"users", "groups"} {
+		expected, _ := group.Cache(name).Expiry("alice")
+		expiry, ok := loaded.Cache(name).Expiry("alice")
+		assert.True(t, ok, "The expiry time should have been loaded.")
+		assert.True(t, expiry.Equal(expected), "The expiry time of the %s namespace is invalid.", name)
+	}
+	_, ok := loaded.Cache("users").Expiry("bob")
+	assert.False(t, ok, "Elements with no expiry should have none when loaded.")
+
+	ints := NewGroup[int, int](&YAML[string, map[int]int]{}, &File{Path: filepath.Join(t.TempDir(), "test.yaml")})
+	ints.Cache("squares").PutWithTTL(3, 9, time.Hour)
+	assert.NoError(t, ints.Store(), "Storing the group should succeed.")
+	ints.Cache("squares").Clear()
+	assert.NoError(t, ints.Load(), "Loading the group should succeed.")
+	_, ok = ints.Cache("squares").Expiry(3)
+	assert.True(t, ok, "The expiry time of a non-string key should have been loaded.")
+
+	// expired elements are not loaded back
+	now := time.Now().Add(3 * time.Hour)
+	expired := NewGroup[string, int](&JSON[string, map[string]int]{}, &File{Path: path})
+	expired.Cache("users").clock = func() time.Time { return now }
+	assert.NoError(t, expired.Load(), "Loading the group should succeed.")
+	assert.Equal(t, expired.Cache("users").Keys(), []string{"bob"}, "Expired elements should not be loaded.")
+}
+
+func TestGroupOptions(t *testing.T) {
+
+	evicted := []string{}
+	group := NewGroup[string, int](&JSON[string, map[string]int]{}, &File{Path: filepath.Join(t.TempDir(), "test.json")},
+		WithOnEvict(func(k string, _ int) { evicted = append(evicted, k) }),
+	)
+	limited := group.Cache("limited", WithMaxEntries[string, int](1))
+	limited.Put("a", 1)
+	limited.Put("b", 2)
+	unlimited := group.Cache("unlimited")
+	unlimited.Put("a", 1)
+	unlimited.Put("b", 2)
+	assert.Equal(t, limited.Keys(), []string{"b"}, "The namespace options should have been applied.")
+	assert.Equal(t, unlimited.Size(), 2, "The namespace options should not apply to other namespaces.")
+	assert.Equal(t, evicted, []string{"a"}, "The group options should have been applied too.")
+	assert.Same(t, group.Cache("limited", WithMaxEntries[string, int](5)), limited, "Options should be ignored for existing namespaces.")
+}
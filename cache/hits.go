@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// hitBuckets is the number of one-second buckets kept by the hit tracker,
+// which bounds the window of RecentHitRatio.
+const hitBuckets = 600
+
+// HitRatio returns the ratio of Gets that found the key in the Cache (not
+// counting values provided by the loader) since its creation, or 0 if there
+// have been no Gets.
+func (c *Cache[K, V]) HitRatio() float64 {
+	return ratio(c.hits.hits.Load(), c.hits.misses.Load())
+}
+
+// RecentHitRatio returns the ratio of Gets that found the key in the Cache
+// over the last window, with a one-second granularity and up to ten minutes
+// back, or 0 if there have been no Gets; unlike HitRatio, it reflects how
+// the Cache is currently being used.
+func (c *Cache[K, V]) RecentHitRatio(window time.Duration) float64 {
+	now := c.clock().Unix()
+	seconds := int64(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	} else if seconds > hitBuckets {
+		seconds = hitBuckets
+	}
+	buckets := c.hits.buckets.Load()
+	if buckets == nil {
+		return 0
+	}
+	var hits, misses int64
+	for i := range buckets {
+		if b := buckets[i].Load(); b != nil && b.second > now-seconds && b.second <= now {
+			hits += b.hits.Load()
+			misses += b.misses.Load()
+		}
+	}
+	return ratio(hits, misses)
+}
+
+// ratio returns the ratio of hits over all lookups.
+func ratio(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// hitTracker counts hits and misses, both overall and in a ring of
+// per-second buckets, using atomics only so that Gets do not contend; the
+// ring is only allocated on the first Get.
+type hitTracker struct {
+	hits    atomic.Int64
+	misses  atomic.Int64
+	buckets atomic.Pointer[[hitBuckets]atomic.Pointer[hitBucket]]
+}
+
+// hitBucket holds the hits and misses of one second; a bucket is never
+// reset, but replaced by a new one when its slot in the ring is reused, so
+// that no count for the new second can be lost.
+type hitBucket struct {
+	second int64
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// record counts a hit or a miss at the given time.
+func (t *hitTracker) record(now time.Time, hit bool) {
+	if hit {
+		t.hits.Add(1)
+	} else {
+		t.misses.Add(1)
+	}
+	buckets := t.buckets.Load()
+	if buckets == nil {
+		t.buckets.CompareAndSwap(nil, new([hitBuckets]atomic.Pointer[hitBucket]))
+		buckets = t.buckets.Load()
+	}
+	second := now.Unix()
+	slot := &buckets[second%hitBuckets]
+	b := slot.Load()
+	for b == nil || b.second != second {
+		// the slot is empty or holds an older second, replace its bucket
+		slot.CompareAndSwap(b, &hitBucket{second: second})
+		b = slot.Load()
+	}
+	if hit {
+		b.hits.Add(1)
+	} else {
+		b.misses.Add(1)
+	}
+}
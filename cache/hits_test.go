@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheHitRatio(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New[string, string]()
+	cache.clock = func() time.Time { return now }
+	assert.Equal(t, cache.HitRatio(), 0.0, "With no Gets the ratio should be 0.")
+
+	cache.Put("a", "aaa")
+	for i := 0; i < 90; i++ {
+		cache.Get("a")
+		now = now.Add(time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		cache.Get("b")
+	}
+	assert.Equal(t, cache.HitRatio(), 0.9, "The lifetime ratio should count all Gets.")
+
+	// a burst of misses
+	now = now.Add(time.Minute)
+	for i := 0; i < 30; i++ {
+		cache.Get("b")
+	}
+	assert.InDelta(t, cache.HitRatio(), 90.0/130.0, 1e-9, "The lifetime ratio should lag behind.")
+	assert.Equal(t, cache.RecentHitRatio(10*time.Second), 0.0, "The recent ratio should drop.")
+	assert.InDelta(t, cache.RecentHitRatio(time.Hour), 90.0/130.0, 1e-9, "The window should be capped at the tracked history.")
+
+	// buckets are reused once a bucket's second is out of the ring
+	now = now.Add(hitBuckets * time.Second)
+	cache.Get("a")
+	assert.Equal(t, cache.RecentHitRatio(time.Second), 1.0, "Reused buckets should be reset.")
+}
+
+func TestCacheHitRatioConcurrent(t *testing.T) {
+
+	cache := New[int, int]()
+	cache.Put(0, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				cache.Get(i % 2)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, cache.HitRatio(), 0.5, "All the Gets should have been counted.")
+}
+
+func TestCacheHitRatioLazy(t *testing.T) {
+
+	cache := New[int, int]()
+	assert.Less(t, int(unsafe.Sizeof(cache.hits)), 64, "The hit tracker should not embed its buckets.")
+	assert.Nil(t, cache.hits.buckets.Load(), "No buckets should be allocated before the first Get.")
+	assert.Equal(t, cache.RecentHitRatio(time.Minute), 0.0, "With no Gets the ratio should be 0.")
+	cache.Get(0)
+	assert.NotNil(t, cache.hits.buckets.Load(), "The buckets should be allocated on the first Get.")
+}
+
+func TestCacheHitRatioReuseConcurrent(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New[int, int]()
+	cache.clock = func() time.Time { return now }
+	cache.Put(0, 0)
+	cache.Get(0)
+
+	// all the Gets race to reuse the same bucket
+	later := now.Add(hitBuckets * time.Second)
+	cache.clock = func() time.Time { return later }
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				cache.Get(i % 2)
+			}
+		}(i)
+	}
+	wg.Wait()
+	b := cache.hits.buckets.Load()[later.Unix()%hitBuckets].Load()
+	assert.Equal(t, b.hits.Load()+b.misses.Load(), int64(8000), "No Gets should be lost when a bucket is reused.")
+	assert.Equal(t, cache.RecentHitRatio(time.Second), 0.5, "The recent ratio should count all the Gets.")
+}
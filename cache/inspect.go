@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+)
+
+// EntryInfo describes an element of the Cache, as reported by InspectMany.
+type EntryInfo struct {
+	// Present is whether the element is in the Cache and has not expired.
+	Present bool
+	// TTL is the time left before the element expires, or zero if it is not
+	// present or has no expiry.
+	TTL time.Duration
+	// LastAccess is when the element was last written or read, or the zero
+	// time if it is not present or access tracking is disabled (see
+	// WithAccessTracking).
+	LastAccess time.Time
+	// Size is an estimate of the memory held by the value, in bytes, or zero
+	// if it is not present.
+	Size int
+}
+
+// InspectMany describes the elements under the given keys, all observed at
+// once under the same read lock; inspecting elements does not count as
+// accessing them, and expired elements are reported as not present, but not
+// purged.
+func (c *Cache[K, V]) InspectMany(keys []K) map[K]EntryInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.accessTracking {
+		c.accessLock.Lock()
+		defer c.accessLock.Unlock()
+	}
+	now := c.clock()
+	infos := make(map[K]EntryInfo, len(keys))
+	for _, k := range keys {
+		v, ok := c.store.Get(k)
+		if !ok || c.expiredNoLock(k, now) {
+			infos[k] = EntryInfo{}
+			continue
+		}
+		info := EntryInfo{Present: true, Size: sizeof(reflect.ValueOf(&v).Elem(), map[uintptr]bool{})}
+		if t, ok := c.expiries[k]; ok {
+			info.TTL = t.Sub(now)
+		}
+		if c.accessTracking {
+			info.LastAccess = c.accessed[k]
+		}
+		infos[k] = info
+	}
+	return infos
+}
+
+// sizeof estimates the memory held by the given value, including what it
+// references.
+func sizeof(v reflect.Value, visited map[uintptr]bool) int {
+	return int(v.Type().Size()) + referenced(v, visited)
+}
+
+// referenced estimates the memory referenced by the given value; the memory
+// behind pointers that were already visited is not counted again.
+func referenced(v reflect.Value, visited map[uintptr]bool) int {
+	size := 0
+	switch v.Kind() {
+	case reflect.String:
+		size = v.Len()
+	case reflect.Slice:
+		if v.IsNil() || visited[v.Pointer()] {
+			break
+		}
+		visited[v.Pointer()] = true
+		size = v.Cap() * int(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += referenced(v.Index(i), visited)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			size += referenced(v.Index(i), visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			size += referenced(v.Field(i), visited)
+		}
+	case reflect.Map:
+		if v.IsNil() || visited[v.Pointer()] {
+			break
+		}
+		visited[v.Pointer()] = true
+		for it := v.MapRange(); it.Next(); {
+			size += sizeof(it.Key(), visited) + sizeof(it.Value(), visited)
+		}
+	case reflect.Pointer:
+		if v.IsNil() || visited[v.Pointer()] {
+			break
+		}
+		visited[v.Pointer()] = true
+		size = sizeof(v.Elem(), visited)
+	case reflect.Interface:
+		if !v.IsNil() {
+			size = sizeof(v.Elem(), visited)
+		}
+	}
+	return size
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheInspectMany(t *testing.T) {
+
+	str := int(reflect.TypeOf("").Size())
+	now := time.Now()
+	cache := New(WithAccessTracking[string, string]())
+	cache.clock = func() time.Time { return now }
+	cache.Put("plain", "aaaa")
+	cache.PutWithTTL("expiring", "bb", time.Minute)
+	cache.PutWithTTL("expired", "c", time.Second)
+	now = now.Add(10 * time.Second)
+	cache.Get("plain")
+
+	infos := cache.InspectMany([]string{"plain", "expiring", "expired", "absent"})
+	assert.Len(t, infos, 4, "All keys should be reported.")
+	assert.Equal(t, infos["plain"], EntryInfo{Present: true, LastAccess: now, Size: str + 4}, "The plain element is invalid.")
+	assert.Equal(t, infos["expiring"], EntryInfo{Present: true, TTL: 50 * time.Second, LastAccess: now.Add(-10 * time.Second), Size: str + 2}, "The expiring element is invalid.")
+	assert.Equal(t, infos["expired"], EntryInfo{}, "Expired elements should be reported as not present.")
+	assert.Equal(t, infos["absent"], EntryInfo{}, "Absent elements should be reported as not present.")
+
+	last, _ := cache.LastAccess("expiring")
+	assert.Equal(t, last, now.Add(-10*time.Second), "Inspecting should not count as an access.")
+	assert.Equal(t, cache.Size(), 3, "Inspecting should not purge expired elements.")
+}
+
+func TestSizeof(t *testing.T) {
+
+	type value struct {
+		Name  string
+		Tags  []string
+		Owner *value
+	}
+	owner := &value{Name: "owner"}
+	v := value{Name: "abc", Tags: []string{"x", "yz"}, Owner: owner}
+	v.Owner.Owner = owner
+	cache := New[string, value]()
+	cache.Put("v", v)
+	info := cache.InspectMany([]string{"v"})["v"]
+	// the struct, the tags and their contents, the owner and its name once
+	header, str := int(reflect.TypeOf(v).Size()), int(reflect.TypeOf("").Size())
+	expected := header + 3 + 2*str + 3 + header + 5
+	assert.Equal(t, info.Size, expected, "The size estimate is invalid.")
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"reflect"
+)
+
+// canonical is the shared copy of an interned value.
+type canonical[V any] struct {
+	value      V
+	references int
+}
+
+// WithInterning applies the interning option to the Cache, which keeps a
+// single canonical copy of each distinct value and stores it under all the
+// keys holding an equal value, so that e.g. large identical strings share
+// their storage; it requires values of a comparable type, and it is ignored
+// otherwise.
+func WithInterning[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		t := reflect.TypeOf((*V)(nil)).Elem()
+		if !t.Comparable() {
+			if c.logger != nil {
+				c.logger.Warn("interning requires comparable values", "type", t)
+			}
+			return
+		}
+		c.interned = map[any]*canonical[V]{}
+		// interface values are comparable only if their dynamic type is
+		c.internDynamic = t.Kind() == reflect.Interface
+	}
+}
+
+// WithValueHashDedup applies the content-addressed deduplication option to
+// the Cache, which works like interning but identifies equal values by a hash
+// of their contents, so that it also applies to values that are not of a
+// comparable type, e.g. large []byte blobs: each distinct value is stored once
+// and shared by all the keys holding it, and it is freed once the last one is
+// deleted. The hash defaults to the SHA-256 of the gob encoding of the value;
+// values that cannot be hashed, or whose hash collides with that of a
+// different value, are stored as they are.
+func WithValueHashDedup[K comparable, V any](hash func(v V) []byte) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if hash == nil {
+			hash = gobHash[V]
+		}
+		c.dedup = hash
+		c.interned = map[any]*canonical[V]{}
+	}
+}
+
+// gobHash returns the SHA-256 of the gob encoding of the given value, or nil
+// if it cannot be encoded.
+func gobHash[V any](v V) []byte {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&v); err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(buffer.Bytes())
+	return sum[:]
+}
+
+// Interned returns the number of distinct canonical values held by the
+// Cache and the number of references to them; their difference is the
+// number of copies that interning saved.
+func (c *Cache[K, V]) Interned() (values int, references int) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, value := range c.interned {
+		references += value.references
+	}
+	return len(c.interned), references
+}
+
+// internNoLock returns the canonical copy of the given value, registering
+// it if it is the first of its kind; it must be called with the write lock
+// held.
+func (c *Cache[K, V]) internNoLock(v V) V {
+	key, ok := c.internKey(v)
+	if !ok {
+		return v
+	}
+	if value, ok := c.interned[key]; ok {
+		if c.dedup != nil && !reflect.DeepEqual(value.value, v) {
+			// hash collision
+			return v
+		}
+		value.references++
+		return value.value
+	}
+	c.interned[key] = &canonical[V]{value: v, references: 1}
+	return v
+}
+
+// releaseNoLock drops a reference to the canonical copy of the given value,
+// forgetting it when it is no longer referenced; it must be called with the
+// write lock held.
+func (c *Cache[K, V]) releaseNoLock(v V) {
+	key, ok := c.internKey(v)
+	if !ok {
+		return
+	}
+	if value, ok := c.interned[key]; ok {
+		if c.dedup != nil && !reflect.DeepEqual(value.value, v) {
+			return
+		}
+		value.references--
+		if value.references == 0 {
+			delete(c.interned, key)
+		}
+	}
+}
+
+// internKey returns the key under which the canonical copy of the given
+// value is registered, and whether there is one.
+func (c *Cache[K, V]) internKey(v V) (any, bool) {
+	if c.dedup != nil {
+		hash := c.dedup(v)
+		return string(hash), hash != nil
+	}
+	if c.internDynamic && !reflect.ValueOf(v).Comparable() {
+		return nil, false
+	}
+	return any(v), true
+}
+
+// resetInterningNoLock forgets all the canonical values; it must be called
+// with the write lock held.
+func (c *Cache[K, V]) resetInterningNoLock() {
+	if c.interned != nil {
+		c.interned = map[any]*canonical[V]{}
+	}
+}
+
+// reinternNoLock rebuilds the canonical values from the contents of the
+// store, e.g. after loading; it must be called with the write lock held.
+func (c *Cache[K, V]) reinternNoLock() {
+	if c.interned == nil {
+		return
+	}
+	c.resetInterningNoLock()
+	type entry struct {
+		key   K
+		value V
+	}
+	entries := make([]entry, 0, c.store.Len())
+	c.store.Range(func(k K, v V) bool {
+		entries = append(entries, entry{key: k, value: v})
+		return true
+	})
+	for _, e := range entries {
+		c.store.Set(e.key, c.internNoLock(e.value))
+	}
+}
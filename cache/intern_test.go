@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheInterning(t *testing.T) {
+
+	cache := New(WithInterning[int, string]())
+	for i := 0; i < 1000; i++ {
+		// build a distinct copy of the same large value each time
+		cache.Put(i, strings.Repeat("x", 1<<16))
+	}
+	cache.Put(1000, "other")
+
+	values, references := cache.Interned()
+	assert.Equal(t, values, 2, "There should be one canonical copy per distinct value.")
+	assert.Equal(t, references, 1001, "Every key should reference a canonical copy.")
+
+	first, _ := cache.Get(0)
+	for i := 1; i < 1000; i++ {
+		v, _ := cache.Get(i)
+		assert.Equal(t, unsafe.StringData(v), unsafe.StringData(first), "The value for key %d should share the canonical copy.", i)
+	}
+
+	// replacing and deleting release the references
+	cache.Replace(1000, strings.Repeat("x", 1<<16))
+	values, references = cache.Interned()
+	assert.Equal(t, values, 1, "The replaced value should have been released.")
+	assert.Equal(t, references, 1001, "Every key should reference a canonical copy.")
+	for i := 0; i <= 1000; i++ {
+		cache.Delete(i)
+	}
+	values, references = cache.Interned()
+	assert.Equal(t, values, 0, "All canonical copies should have been released.")
+	assert.Equal(t, references, 0, "All references should have been released.")
+
+	// non-comparable dynamic values are stored as they are
+	dynamic := New(WithInterning[string, any]())
+	dynamic.Put("a", []int{1})
+	dynamic.Put("b", fmt.Sprint(1))
+	dynamic.Put("c", fmt.Sprint(1))
+	values, references = dynamic.Interned()
+	assert.Equal(t, values, 1, "Only comparable values should be interned.")
+	assert.Equal(t, references, 2, "Only comparable values should be interned.")
+
+	// interning is ignored for non-comparable types
+	assert.Nil(t, New(WithInterning[string, []int]()).interned, "Interning should be disabled.")
+}
+
+func TestCacheValueHashDedup(t *testing.T) {
+
+	cache := New(WithValueHashDedup[string, []byte](nil))
+	cache.Put("a", bytes.Repeat([]byte("x"), 1<<16))
+	cache.Put("b", bytes.Repeat([]byte("x"), 1<<16))
+	cache.Put("c", []byte("other"))
+	values, references := cache.Interned()
+	assert.Equal(t, values, 2, "Identical blobs should be stored once.")
+	assert.Equal(t, references, 3, "Every key should reference a stored blob.")
+	a, _ := cache.Get("a")
+	b, _ := cache.Get("b")
+	assert.Equal(t, &a[0], &b[0], "Keys with identical values should share the stored blob.")
+
+	cache.Delete("a")
+	values, _ = cache.Interned()
+	assert.Equal(t, values, 2, "A blob still referenced should be kept.")
+	cache.Delete("b")
+	values, references = cache.Interned()
+	assert.Equal(t, values, 1, "A blob no longer referenced should be freed.")
+	assert.Equal(t, references, 1, "Only the remaining key should reference a blob.")
+
+	// colliding hashes do not mix up different values
+	colliding := New(WithValueHashDedup[string, []byte](func([]byte) []byte { return []byte{0} }))
+	colliding.Put("a", []byte("aaa"))
+	colliding.Put("b", []byte("bbb"))
+	v, _ := colliding.Get("b")
+	assert.Equal(t, v, []byte("bbb"), "A colliding value should be stored as it is.")
+	colliding.Delete("b")
+	values, references = colliding.Interned()
+	assert.Equal(t, values, 1, "Deleting a colliding value should not release the other one.")
+	assert.Equal(t, references, 1, "Deleting a colliding value should not release the other one.")
+}
@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package cache
+
+import (
+	"iter"
+)
+
+// All returns an iterator over the elements in the Cache, in no particular
+// order, for use with range. The keys are taken as a snapshot when the
+// iteration starts, and each one is yielded along with its current value,
+// skipping those removed, or expired, in the meantime; no lock is held while
+// yielding, so the loop body is free to call back into the Cache.
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, k := range c.Keys() {
+			c.lock.RLock()
+			v, ok := c.store.Get(k)
+			ok = ok && !c.expiredNoLock(k, c.clock())
+			c.lock.RUnlock()
+			if ok && !yield(k, v) {
+				return
+			}
+		}
+	}
+}
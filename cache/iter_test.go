@@ -0,0 +1,62 @@
+//go:build go1.23
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheAll(t *testing.T) {
+
+	cache := New[string, int]()
+	for i := 0; i < 10; i++ {
+		cache.Put(fmt.Sprintf("key-%d", i), i)
+	}
+
+	collected := map[string]int{}
+	for k, v := range cache.All() {
+		collected[k] = v
+	}
+	assert.Equal(t, collected, cache.Entries(), "All the entries should be iterated.")
+
+	count := 0
+	for range cache.All() {
+		count++
+		break
+	}
+	assert.Equal(t, count, 1, "The iteration should stop when the loop breaks.")
+
+	// the loop body can change the cache while iterating
+	for k, v := range cache.All() {
+		cache.Replace(k, v*10)
+		cache.Delete(fmt.Sprintf("key-%d", 9-v))
+	}
+	assert.Len(t, cache.Keys(), 5, "Half the entries should have been deleted.")
+	for k, v := range cache.All() {
+		assert.Equal(t, v%10, 0, "The entry for %s should have been replaced.", k)
+	}
+
+	// entries expired before or during the iteration are skipped
+	now := time.Now()
+	cache.clock = func() time.Time { return now }
+	cache.PutWithTTL("expired", 1, time.Minute)
+	cache.PutWithTTL("expiring", 2, time.Hour)
+	now = now.Add(2 * time.Minute)
+	collected = map[string]int{}
+	first := ""
+	for k, v := range cache.All() {
+		if first == "" {
+			first = k
+			now = now.Add(2 * time.Hour)
+		}
+		collected[k] = v
+	}
+	assert.NotContains(t, collected, "expired", "Expired entries should not be iterated.")
+	if first != "expiring" {
+		assert.NotContains(t, collected, "expiring", "Entries expiring while iterating should not be iterated.")
+	}
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"container/list"
+)
+
+// WithMaxEntriesLFU applies the LFU eviction option to the Cache, which then
+// counts the accesses to each of its elements (by Get and by any of the
+// Replace variants overwriting an existing element) and, whenever storing an
+// element pushes its size past the given maximum, evicts the least frequently
+// used ones; among elements accessed equally often, the one that has been at
+// that count the longest is evicted first, so that elements that were never
+// read are evicted in insertion order.
+func WithMaxEntriesLFU[K comparable, V any](n int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if n > 0 {
+			c.maxEntries = n
+			c.evictor = newLFU[K]()
+		}
+	}
+}
+
+// lfuBucket holds the elements accessed the same number of times, in the
+// order in which they reached it.
+type lfuBucket[K comparable] struct {
+	count int
+	keys  *list.List
+}
+
+// lfuEntry locates an element in its bucket.
+type lfuEntry struct {
+	bucket *list.Element
+	key    *list.Element
+}
+
+// lfu is an evictor choosing the least frequently used element; buckets are
+// kept sorted by increasing count, so that all operations take constant time.
+type lfu[K comparable] struct {
+	buckets *list.List
+	entries map[K]lfuEntry
+}
+
+// newLFU creates a new, empty lfu.
+func newLFU[K comparable]() *lfu[K] {
+	return &lfu[K]{buckets: list.New(), entries: map[K]lfuEntry{}}
+}
+
+// written counts an access to an existing element, or inserts a new one.
+func (l *lfu[K]) written(k K) {
+	if _, ok := l.entries[k]; ok {
+		l.read(k)
+		return
+	}
+	front := l.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket[K]).count != 1 {
+		front = l.buckets.PushFront(&lfuBucket[K]{count: 1, keys: list.New()})
+	}
+	l.entries[k] = lfuEntry{bucket: front, key: front.Value.(*lfuBucket[K]).keys.PushBack(k)}
+}
+
+// read counts an access to the element, moving it to the next bucket.
+func (l *lfu[K]) read(k K) {
+	e, ok := l.entries[k]
+	if !ok {
+		return
+	}
+	current := e.bucket.Value.(*lfuBucket[K])
+	next := e.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket[K]).count != current.count+1 {
+		next = l.buckets.InsertAfter(&lfuBucket[K]{count: current.count + 1, keys: list.New()}, e.bucket)
+	}
+	current.keys.Remove(e.key)
+	if current.keys.Len() == 0 {
+		l.buckets.Remove(e.bucket)
+	}
+	l.entries[k] = lfuEntry{bucket: next, key: next.Value.(*lfuBucket[K]).keys.PushBack(k)}
+}
+
+// forget drops the element.
+func (l *lfu[K]) forget(k K) {
+	e, ok := l.entries[k]
+	if !ok {
+		return
+	}
+	bucket := e.bucket.Value.(*lfuBucket[K])
+	bucket.keys.Remove(e.key)
+	if bucket.keys.Len() == 0 {
+		l.buckets.Remove(e.bucket)
+	}
+	delete(l.entries, k)
+}
+
+// victim returns the least frequently used element.
+func (l *lfu[K]) victim() (K, bool) {
+	if front := l.buckets.Front(); front != nil {
+		return front.Value.(*lfuBucket[K]).keys.Front().Value.(K), true
+	}
+	var zero K
+	return zero, false
+}
+
+// reset drops all the elements.
+func (l *lfu[K]) reset() {
+	l.buckets.Init()
+	l.entries = map[K]lfuEntry{}
+}
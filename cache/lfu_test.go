@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheMaxEntriesLFU(t *testing.T) {
+
+	evicted := []string{}
+	cache := New(
+		WithMaxEntriesLFU[string, int](3),
+		WithOnEvict(func(k string, _ int) { evicted = append(evicted, k) }),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("c", 3)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Replace("b", 20)
+	cache.Put("d", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b", "d"}, "The least frequently used element should have been evicted.")
+
+	// putting an existing element is not an access
+	cache.Put("d", 40)
+	cache.Put("d", 40)
+	cache.Put("e", 5)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b", "e"}, "The least frequently used element should have been evicted.")
+	assert.Equal(t, evicted, []string{"c", "d"}, "The eviction hook should have been invoked.")
+}
+
+func TestCacheMaxEntriesLFUTies(t *testing.T) {
+
+	cache := New(WithMaxEntriesLFU[string, int](3))
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("c", 3)
+	cache.Put("d", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"b", "c", "d"}, "Among unread elements, the oldest inserted should be evicted.")
+
+	// b and d reach the same count, b first
+	cache.Get("c")
+	cache.Get("c")
+	cache.Get("b")
+	cache.Get("d")
+	cache.Put("e", 5)
+	assert.ElementsMatch(t, cache.Keys(), []string{"c", "d", "e"}, "Among equally used elements, the one at that count the longest should be evicted.")
+	cache.Put("f", 6)
+	assert.ElementsMatch(t, cache.Keys(), []string{"c", "d", "f"}, "Elements never read should be evicted first.")
+}
+
+func TestCacheMaxEntriesLFUArrivalOrder(t *testing.T) {
+
+	cache := New(WithMaxEntriesLFU[string, int](3))
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("c", 3)
+	cache.Get("c")
+	cache.Get("b")
+	cache.Get("a")
+	cache.Put("d", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b", "d"}, "Among equally used elements, the first to reach that count should be evicted, regardless of insertion order.")
+
+	// a reaches the count before b, d last
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("d")
+	cache.Get("d")
+	cache.Put("e", 5)
+	assert.ElementsMatch(t, cache.Keys(), []string{"b", "d", "e"}, "Among equally used elements, the first to reach that count should be evicted.")
+
+	// a deleted element is inserted anew
+	cache.Delete("b")
+	cache.Put("b", 2)
+	cache.Put("f", 6)
+	assert.ElementsMatch(t, cache.Keys(), []string{"b", "d", "f"}, "Among unread elements, the oldest inserted should be evicted.")
+}
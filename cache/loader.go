@@ -0,0 +1,308 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Loader retrieves the value associated with a key from the origin whenever
+// it is not available in the Cache; it returns whether the key exists at the
+// origin and any error encountered while retrieving it.
+type Loader[K comparable, V any] func(k K) (V, bool, error)
+
+// WithLoader applies the loader option to the Cache, which makes it a
+// read-through cache: any Get for a missing key invokes the loader and
+// stores its result, unless the Cache is read-only (see ReadOnly), in which
+// case the result is only returned.
+func WithLoader[K comparable, V any](l Loader[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if l != nil {
+			c.loader = l
+		}
+	}
+}
+
+// WithLoaderTTL applies the loader TTL option to the Cache: the elements
+// stored by the loader, whether by Get, Materialize or GetFresh write-back,
+// expire after the given TTL (see PutWithTTL), after which the next Get
+// invokes the loader again; the elements stored in any other way are not
+// affected.
+func WithLoaderTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if ttl > 0 {
+			c.loaderTTL = ttl
+		}
+	}
+}
+
+// WithErrorCaching applies the error caching option to the Cache: loader
+// errors for which shouldCache returns true (or all of them, if it is nil)
+// are remembered for the given TTL, during which loading the same key fails
+// with the same error without invoking the loader, to shed load off a
+// failing origin.
+func WithErrorCaching[K comparable, V any](ttl time.Duration, shouldCache func(error) bool) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if ttl > 0 {
+			c.errorTTL = ttl
+			c.shouldCache = shouldCache
+			c.failures = map[K]failure{}
+		}
+	}
+}
+
+// failure is a loader error remembered by the Cache.
+type failure struct {
+	err error
+	at  time.Time
+}
+
+// LoaderMode determines how a Get for a missing key uses the loader.
+type LoaderMode int
+
+const (
+	// BlockingLoad makes Get wait for the loader and return its value.
+	BlockingLoad LoaderMode = iota
+	// AsyncLoad makes Get report a miss right away and run the loader in the
+	// background, once per key at a time, so that a later Get finds the value.
+	AsyncLoad
+)
+
+// WithLoaderMode applies the loader mode option to the Cache, choosing
+// whether a Get for a missing key blocks on the loader (the default) or
+// triggers a background load.
+func WithLoaderMode[K comparable, V any](mode LoaderMode) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.loaderMode = mode
+	}
+}
+
+// WithFreshWriteBack applies the fresh write-back option to the Cache, so
+// that the values retrieved by GetFresh replace the cached ones.
+func WithFreshWriteBack[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.freshWriteBack = true
+	}
+}
+
+// GetFresh bypasses the Cache and always retrieves the value for the given
+// key via the loader, e.g. for consistency-critical reads; the fresh value
+// is only stored in the Cache, replacing any cached one and invoking the
+// on-put hook (see WithOnPut), if WithFreshWriteBack is set. It returns
+// whether the key exists at the origin; a read-only Cache (see ReadOnly)
+// never stores it.
+func (c *Cache[K, V]) GetFresh(k K) (V, bool, error) {
+	defer c.timed("get")()
+	if c.loader == nil {
+		if c.logger != nil {
+			c.logger.Error("getting fresh value with no loader")
+		}
+		var zero V
+		return zero, false, errors.New("no loader configured")
+	}
+	if c.logger != nil {
+		c.logger.Debug("getting fresh value through loader", "key", k)
+	}
+	v, ok, err := c.loader(k)
+	if err != nil {
+		if c.logger != nil {
+			c.logger.Error("error getting fresh value through loader", "key", k, "error", err)
+		}
+		return v, false, err
+	}
+	if !ok || !c.freshWriteBack {
+		return v, ok, nil
+	}
+	stored := false
+	defer c.putted(k, v, &stored)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return v, true, nil
+	}
+	c.setNoLock(k, v)
+	c.loadedNoLock(k)
+	stored = true
+	c.storeNoLock(false)
+	if c.logger != nil {
+		c.logger.Debug("fresh value written back into cache", "key", k, "value", v)
+	}
+	return v, true, nil
+}
+
+// Materialize proactively loads all the given keys that are not yet in the
+// Cache via the loader, running up to GOMAXPROCS loads at a time; it returns
+// how many keys were loaded and how many failed, along with the combined
+// loader errors. A read-only Cache (see ReadOnly) loads the values without
+// storing them.
+func (c *Cache[K, V]) Materialize(keys []K) (loaded int, failed int, err error) {
+	if c.loader == nil {
+		if c.logger != nil {
+			c.logger.Error("materializing cache with no loader")
+		}
+		return 0, 0, errors.New("no loader configured")
+	}
+
+	if c.logger != nil {
+		c.logger.Debug("materializing cache", "keys", len(keys))
+	}
+
+	missing := []K{}
+	c.lock.RLock()
+	for _, k := range keys {
+		if _, ok := c.store.Get(k); !ok || c.expiredNoLock(k, c.clock()) {
+			missing = append(missing, k)
+		}
+	}
+	c.lock.RUnlock()
+
+	var (
+		lock   sync.Mutex
+		errs   []error
+		wg     sync.WaitGroup
+		queue  = make(chan K)
+		worker = func() {
+			defer wg.Done()
+			for k := range queue {
+				_, ok, err := c.loadThrough(k)
+				lock.Lock()
+				if err != nil {
+					failed++
+					errs = append(errs, fmt.Errorf("key %v: %w", k, err))
+				} else if ok {
+					loaded++
+				}
+				lock.Unlock()
+			}
+		}
+	)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(missing) {
+		workers = len(missing)
+	}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	for _, k := range missing {
+		queue <- k
+	}
+	close(queue)
+	wg.Wait()
+
+	if c.logger != nil {
+		c.logger.Debug("cache materialized", "loaded", loaded, "failed", failed)
+	}
+	return loaded, failed, errors.Join(errs...)
+}
+
+// loadThrough invokes the loader for the given key and, if the origin has
+// it, stores the value unless some other value was stored in the meantime;
+// it returns the value in the Cache.
+func (c *Cache[K, V]) loadThrough(k K) (V, bool, error) {
+	if err := c.failed(k); err != nil {
+		if c.logger != nil {
+			c.logger.Debug("returning cached loader error", "key", k, "error", err)
+		}
+		var zero V
+		return zero, false, err
+	}
+	if c.logger != nil {
+		c.logger.Debug("loading value through loader", "key", k)
+	}
+	v, ok, err := c.loader(k)
+	if err != nil {
+		if c.logger != nil {
+			c.logger.Error("error loading value through loader", "key", k, "error", err)
+		}
+		c.fail(k, err)
+		return v, false, err
+	}
+	if !ok {
+		if c.logger != nil {
+			c.logger.Debug("value not available at origin", "key", k)
+		}
+		return v, false, nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return v, true, nil
+	}
+	if existing, ok := c.liveNoLock(k); ok {
+		return existing, true, nil
+	}
+	c.setNoLock(k, v)
+	c.loadedNoLock(k)
+	c.storeNoLock(false)
+	if c.logger != nil {
+		c.logger.Debug("value loaded into cache", "key", k, "value", v)
+	}
+	return v, true, nil
+}
+
+// loadedNoLock updates the bookkeeping after the loader has stored the
+// element under the given key; it must be called with the write lock held.
+func (c *Cache[K, V]) loadedNoLock(k K) {
+	if c.loaderTTL > 0 {
+		c.expireNoLock(k, c.loaderTTL)
+	}
+}
+
+// loadAsync starts loading the value for the given key via the loader in the
+// background, unless a load for the same key is already in progress.
+func (c *Cache[K, V]) loadAsync(k K) {
+	c.loadingLock.Lock()
+	defer c.loadingLock.Unlock()
+	if _, ok := c.loading[k]; ok {
+		if c.logger != nil {
+			c.logger.Debug("background load already in progress", "key", k)
+		}
+		return
+	}
+	if c.loading == nil {
+		c.loading = map[K]struct{}{}
+	}
+	c.loading[k] = struct{}{}
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		defer func() {
+			c.loadingLock.Lock()
+			delete(c.loading, k)
+			c.loadingLock.Unlock()
+		}()
+		c.loadThrough(k)
+	}()
+}
+
+// failed returns the loader error remembered for the given key, if it is
+// still within its TTL.
+func (c *Cache[K, V]) failed(k K) error {
+	if c.errorTTL == 0 {
+		return nil
+	}
+	c.failuresLock.Lock()
+	defer c.failuresLock.Unlock()
+	f, ok := c.failures[k]
+	if !ok {
+		return nil
+	}
+	if c.clock().Sub(f.at) > c.errorTTL {
+		delete(c.failures, k)
+		return nil
+	}
+	return f.err
+}
+
+// fail remembers the loader error for the given key, if it must be cached.
+func (c *Cache[K, V]) fail(k K, err error) {
+	if c.errorTTL == 0 || (c.shouldCache != nil && !c.shouldCache(err)) {
+		return
+	}
+	c.failuresLock.Lock()
+	defer c.failuresLock.Unlock()
+	c.failures[k] = failure{err: err, at: c.clock()}
+}
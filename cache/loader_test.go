@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheMaterialize(t *testing.T) {
+
+	var calls int32
+
+	cache := New(
+		WithLoader(func(k string) (string, bool, error) {
+			atomic.AddInt32(&calls, 1)
+			switch {
+			case strings.HasPrefix(k, "err"):
+				return "", false, errors.New("origin failure")
+			case strings.HasPrefix(k, "none"):
+				return "", false, nil
+			}
+			return k + k + k, true, nil
+		}),
+	)
+	cache.Put("a", "xxx")
+
+	loaded, failed, err := cache.Materialize([]string{"a", "b", "c", "d", "err1", "err2", "none"})
+	assert.Equal(t, loaded, 3, "The number of loaded keys is invalid.")
+	assert.Equal(t, failed, 2, "The number of failed keys is invalid.")
+	assert.ErrorContains(t, err, "err1", "The error should report the failed key.")
+	assert.ErrorContains(t, err, "err2", "The error should report the failed key.")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(6), "The loader should not be called for present keys.")
+
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b", "c", "d"}, "The key set is invalid.")
+	v, ok := cache.Get("a")
+	assert.Equal(t, ok, true, "The value should be present in the cache.")
+	assert.Equal(t, v, "xxx", "The existing value should not have been reloaded.")
+
+	// read-through on Get
+	v, ok = cache.Get("e")
+	assert.Equal(t, ok, true, "The value should have been loaded.")
+	assert.Equal(t, v, "eee", "The value should be as expected.")
+	_, ok = cache.Get("none")
+	assert.Equal(t, ok, false, "The value should not be present at the origin.")
+
+	// no loader
+	_, _, err = New[string, string]().Materialize([]string{"a"})
+	assert.Error(t, err, "Materializing without a loader should fail.")
+}
+
+func TestCacheLoaderTTL(t *testing.T) {
+
+	now := time.Now()
+	calls := 0
+	cache := New(
+		WithLoader(func(k string) (string, bool, error) {
+			calls++
+			return fmt.Sprint(k, calls), true, nil
+		}),
+		WithLoaderTTL[string, string](time.Minute),
+	)
+	cache.clock = func() time.Time { return now }
+
+	v, _ := cache.Get("a")
+	assert.Equal(t, v, "a1", "The value should have been loaded.")
+	expiry, ok := cache.Expiry("a")
+	assert.True(t, ok, "Loaded elements should expire.")
+	assert.Equal(t, expiry, now.Add(time.Minute), "The expiry is invalid.")
+	cache.Put("b", "put")
+	_, ok = cache.Expiry("b")
+	assert.False(t, ok, "Elements not stored by the loader should not expire.")
+
+	now = now.Add(30 * time.Second)
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "a1", "Unexpired loaded elements should be served from the cache.")
+	now = now.Add(time.Minute)
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "a2", "Expired loaded elements should be loaded again.")
+	assert.Equal(t, calls, 2, "The loader should have been invoked again.")
+	expiry, _ = cache.Expiry("a")
+	assert.Equal(t, expiry, now.Add(time.Minute), "Reloaded elements should expire again.")
+
+	loaded, _, _ := cache.Materialize([]string{"c"})
+	assert.Equal(t, loaded, 1, "The key should have been materialized.")
+	_, ok = cache.Expiry("c")
+	assert.True(t, ok, "Materialized elements should expire.")
+}
+
+func TestCacheGetFresh(t *testing.T) {
+
+	var calls int32
+	loader := func(k string) (string, bool, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if k == "err" {
+			return "", false, errors.New("origin failure")
+		}
+		return fmt.Sprintf("%s-%d", k, n), true, nil
+	}
+
+	cache := New(WithLoader(loader))
+	cache.Put("a", "cached")
+
+	v, ok, err := cache.GetFresh("a")
+	assert.NoError(t, err, "Getting a fresh value should succeed.")
+	assert.Equal(t, ok, true, "The value should exist at the origin.")
+	assert.Equal(t, v, "a-1", "The value should come from the loader.")
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "cached", "The cached value should not have been replaced.")
+
+	_, _, err = cache.GetFresh("err")
+	assert.Error(t, err, "The loader error should be returned.")
+
+	// with write-back the fresh value replaces the cached one
+	puts := []string{}
+	cache = New(
+		WithLoader(loader),
+		WithFreshWriteBack[string, string](),
+		WithOnPut(func(_ *Cache[string, string], k, v string) { puts = append(puts, k+"="+v) }),
+	)
+	cache.Put("a", "cached")
+	v, _, _ = cache.GetFresh("a")
+	assert.Equal(t, v, "a-3", "The value should come from the loader.")
+	v, _ = cache.Get("a")
+	assert.Equal(t, v, "a-3", "The cached value should have been replaced.")
+	assert.Equal(t, puts, []string{"a=cached", "a=a-3"}, "The on-put hook should run for the written back value.")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(3), "The loader should have been called for each fresh read.")
+}
+
+func TestCacheAsyncLoad(t *testing.T) {
+
+	var calls int32
+	release := make(chan struct{})
+	cache := New(
+		WithLoader(func(k string) (string, bool, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return strings.ToUpper(k), true, nil
+		}),
+		WithLoaderMode[string, string](AsyncLoad),
+	)
+
+	for i := 0; i < 3; i++ {
+		_, ok := cache.Get("a")
+		assert.False(t, ok, "A miss should be reported right away.")
+	}
+	close(release)
+
+	var (
+		v  string
+		ok bool
+	)
+	for i := 0; i < 100 && !ok; i++ {
+		time.Sleep(time.Millisecond)
+		v, ok = cache.Get("a")
+	}
+	assert.True(t, ok, "The value should have been loaded in the background.")
+	assert.Equal(t, v, "A", "The loaded value should be returned.")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(1), "Concurrent misses should share a single load.")
+}
+
+func TestCacheErrorCaching(t *testing.T) {
+
+	var (
+		calls     int32
+		retryable = errors.New("origin overloaded")
+		fatal     = errors.New("origin broken")
+		now       = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	cache := New(
+		WithLoader(func(k string) (string, bool, error) {
+			atomic.AddInt32(&calls, 1)
+			if k == "fatal" {
+				return "", false, fatal
+			}
+			return "", false, retryable
+		}),
+		WithErrorCaching[string, string](time.Minute, func(err error) bool {
+			return errors.Is(err, retryable)
+		}),
+	)
+	cache.clock = func() time.Time { return now }
+
+	_, err := cache.GetE("a")
+	assert.ErrorIs(t, err, retryable, "The loader error should be returned.")
+	_, err = cache.GetE("a")
+	assert.ErrorIs(t, err, retryable, "The cached error should be returned.")
+	_, ok := cache.Get("a")
+	assert.False(t, ok, "The cached error should be a miss.")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(1), "The cached error should short-circuit the loader.")
+
+	cache.GetE("fatal")
+	cache.GetE("fatal")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(3), "Errors not matching the predicate should not be cached.")
+
+	now = now.Add(2 * time.Minute)
+	_, err = cache.GetE("a")
+	assert.ErrorIs(t, err, retryable, "The loader error should be returned.")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(4), "The loader should be retried after the TTL.")
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"container/list"
+)
+
+// WithMaxEntries applies the LRU eviction option to the Cache, which then
+// keeps track of the order in which its elements are accessed (by Get and by
+// any of the Put and Replace variants) and, whenever storing an element
+// pushes its size past the given maximum, evicts the least recently used
+// ones.
+func WithMaxEntries[K comparable, V any](n int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if n > 0 {
+			c.maxEntries = n
+			c.evictor = newLRU[K]()
+		}
+	}
+}
+
+// WithWatermarks applies the watermark eviction option to the Cache, which
+// then lets its size grow up to the high watermark and, whenever storing an
+// element pushes it past that, evicts the least recently used elements in
+// bulk, down to the low watermark, so that evictions happen in batches
+// rather than on every insertion past the maximum. To evict the least
+// frequently used ones instead, apply WithMaxEntriesLFU first. The option is
+// ignored unless 0 <= low < high.
+func WithWatermarks[K comparable, V any](high, low int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if low >= 0 && low < high {
+			c.maxEntries = high
+			c.watermarks = true
+			c.lowWatermark = low
+			if c.evictor == nil {
+				c.evictor = newLRU[K]()
+			}
+		}
+	}
+}
+
+// WithOnEvict applies the eviction hook option to the Cache; the hook is
+// invoked with the key and value of each element evicted to make room for
+// new ones (see WithMaxEntries, WithMaxEntriesLFU and
+// WithRandomizedEviction) or under memory pressure (see
+// WithMemoryPressureEviction). It runs with the
+// write lock held, so it must not call any method of the Cache.
+func WithOnEvict[K comparable, V any](fn func(k K, v V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.onEvict = fn
+		}
+	}
+}
+
+// evictor keeps track of the accesses to the elements of a Cache, to choose
+// which one to evict when it grows past its maximum size.
+type evictor[K comparable] interface {
+	// written records that the element under the key was stored, either
+	// anew or replacing an existing one.
+	written(k K)
+	// read records that the element under the key was read.
+	read(k K)
+	// forget drops the element under the key.
+	forget(k K)
+	// victim returns the element to evict next, if any.
+	victim() (K, bool)
+	// reset drops all the elements.
+	reset()
+}
+
+// concurrentReader is implemented by evictors whose read method can be
+// called by concurrent readers of the Cache without the eviction lock, since
+// it only ever runs concurrently with itself.
+type concurrentReader interface {
+	concurrentReads()
+}
+
+// lru is an evictor choosing the least recently used element.
+type lru[K comparable] struct {
+	order    *list.List
+	elements map[K]*list.Element
+}
+
+// newLRU creates a new, empty lru.
+func newLRU[K comparable]() *lru[K] {
+	return &lru[K]{order: list.New(), elements: map[K]*list.Element{}}
+}
+
+// written marks the element as the most recently used.
+func (l *lru[K]) written(k K) {
+	l.read(k)
+}
+
+// read marks the element as the most recently used.
+func (l *lru[K]) read(k K) {
+	if e, ok := l.elements[k]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.elements[k] = l.order.PushFront(k)
+}
+
+// forget drops the element.
+func (l *lru[K]) forget(k K) {
+	if e, ok := l.elements[k]; ok {
+		l.order.Remove(e)
+		delete(l.elements, k)
+	}
+}
+
+// victim returns the least recently used element.
+func (l *lru[K]) victim() (K, bool) {
+	if e := l.order.Back(); e != nil {
+		return e.Value.(K), true
+	}
+	var zero K
+	return zero, false
+}
+
+// reset drops all the elements.
+func (l *lru[K]) reset() {
+	l.order.Init()
+	l.elements = map[K]*list.Element{}
+}
+
+// writtenEvictionNoLock evicts elements if storing the element under the
+// given key made the Cache grow too large, and then records it, so that it
+// cannot be evicted itself, unless it is pinned; it must be called with the
+// write lock held.
+func (c *Cache[K, V]) writtenEvictionNoLock(k K) {
+	if c.evictor == nil {
+		return
+	}
+	c.evictNoLock()
+	if c.pinned[k] {
+		return
+	}
+	c.evictionLock.Lock()
+	defer c.evictionLock.Unlock()
+	c.evictor.written(k)
+}
+
+// readEvictionNoLock records that the element under the given key was read,
+// unless it is pinned; it must be called with at least the read lock held.
+func (c *Cache[K, V]) readEvictionNoLock(k K) {
+	if c.evictor == nil || c.pinned[k] {
+		return
+	}
+	if _, ok := c.evictor.(concurrentReader); ok {
+		c.evictor.read(k)
+		return
+	}
+	c.evictionLock.Lock()
+	defer c.evictionLock.Unlock()
+	c.evictor.read(k)
+}
+
+// forgetEvictionNoLock drops the element under the given key from eviction;
+// it must be called with the write lock held.
+func (c *Cache[K, V]) forgetEvictionNoLock(k K) {
+	if c.evictor == nil {
+		return
+	}
+	c.evictionLock.Lock()
+	defer c.evictionLock.Unlock()
+	c.evictor.forget(k)
+}
+
+// evictNoLock evicts elements until the Cache is within its maximum size,
+// or down to its low watermark, if any (see WithWatermarks); it must be
+// called with the write lock held.
+func (c *Cache[K, V]) evictNoLock() {
+	if c.maxEntries == 0 || c.store.Len() <= c.maxEntries {
+		return
+	}
+	if c.watermarks {
+		c.evictDownNoLock(c.lowWatermark)
+		return
+	}
+	c.evictDownNoLock(c.maxEntries)
+}
+
+// evictDownNoLock evicts elements until the size of the Cache is at most the
+// given one; it must be called with the write lock held.
+func (c *Cache[K, V]) evictDownNoLock(size int) {
+	for c.store.Len() > size {
+		c.evictionLock.Lock()
+		k, ok := c.evictor.victim()
+		c.evictionLock.Unlock()
+		if !ok {
+			if len(c.pinned) > 0 && c.logger != nil {
+				c.logger.Warn("cannot evict, all the elements are pinned", "size", c.store.Len(), "target", size)
+			}
+			return
+		}
+		v, _ := c.store.Get(k)
+		if c.logger != nil {
+			c.logger.Debug("evicting value", "key", k)
+		}
+		c.dropNoLock(k)
+		c.stats.evictions.Add(1)
+		if c.onEvict != nil {
+			c.onEvict(k, v)
+		}
+	}
+}
+
+// resetEvictionNoLock rebuilds the eviction bookkeeping from the contents of
+// the store, e.g. after loading, dropping the pins of the elements no longer
+// there, and evicts the elements in excess; it must be called with the write
+// lock held.
+func (c *Cache[K, V]) resetEvictionNoLock() {
+	for k := range c.pinned {
+		if _, ok := c.store.Get(k); !ok {
+			delete(c.pinned, k)
+		}
+	}
+	if c.evictor == nil {
+		return
+	}
+	c.evictionLock.Lock()
+	c.evictor.reset()
+	c.store.Range(func(k K, _ V) bool {
+		if !c.pinned[k] {
+			c.evictor.written(k)
+		}
+		return true
+	})
+	c.evictionLock.Unlock()
+	c.evictNoLock()
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheMaxEntries(t *testing.T) {
+
+	evicted := map[string]int{}
+	cache := New(
+		WithMaxEntries[string, int](3),
+		WithOnEvict(func(k string, v int) { evicted[k] = v }),
+	)
+	for i := 0; i < 3; i++ {
+		cache.Put(fmt.Sprint(i), i)
+	}
+	cache.Put("3", 3)
+	assert.Equal(t, cache.Size(), 3, "The cache should not exceed its maximum size.")
+	_, ok := cache.Get("0")
+	assert.False(t, ok, "The least recently used element should have been evicted.")
+	assert.Equal(t, evicted, map[string]int{"0": 0}, "The eviction hook should have been invoked.")
+
+	// reading and replacing count as uses
+	cache.Get("1")
+	cache.Replace("2", 20)
+	cache.Put("4", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"1", "2", "4"}, "The least recently used element should have been evicted.")
+	cache.Delete("1")
+	cache.Put("5", 5)
+	assert.ElementsMatch(t, cache.Keys(), []string{"2", "4", "5"}, "Deleted elements should not be evicted.")
+	assert.Len(t, evicted, 2, "Only evicted elements should be reported.")
+}
+
+func TestCacheMaxEntriesLoad(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	cache := New(
+		WithPersistence[string, int](&File{Path: path}),
+		WithEncoding[string, int](&JSON[string, int]{}),
+	)
+	for i := 0; i < 10; i++ {
+		cache.Put(fmt.Sprint(i), i)
+	}
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	bounded := New(
+		WithPersistence[string, int](&File{Path: path}),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		WithMaxEntries[string, int](5),
+	)
+	assert.NoError(t, bounded.Load(), "Loading should succeed.")
+	assert.Equal(t, bounded.Size(), 5, "Loading should evict the elements in excess.")
+	bounded.Put("new", 10)
+	assert.Equal(t, bounded.Size(), 5, "The cache should not exceed its maximum size.")
+	_, ok := bounded.Get("new")
+	assert.True(t, ok, "The newest element should be kept.")
+}
+
+func TestCacheMaxEntriesBookkeeping(t *testing.T) {
+
+	cache := New(
+		WithMaxEntries[string, int](2),
+		WithSoftDelete[string, int](time.Hour),
+		WithDirtyKeyTracking[string, int](),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.resetDirtyKeys()
+	cache.Put("c", 3)
+	assert.ElementsMatch(t, cache.Keys(), []string{"b", "c"}, "The least recently used element should have been evicted.")
+	assert.Empty(t, cache.tombstones, "Evicting should not leave a tombstone behind.")
+	assert.Equal(t, cache.DirtyKeys(), []string{"c"}, "Evicting should not be tracked as a delete.")
+	assert.Equal(t, cache.Stats().Evictions, int64(1), "The eviction should be counted.")
+
+	cache.Delete("b")
+	assert.Contains(t, cache.tombstones, "b", "Deleting should still leave a tombstone behind.")
+}
+
+func TestCacheWatermarks(t *testing.T) {
+
+	evicted := []string{}
+	cache := New(
+		WithWatermarks[string, int](4, 2),
+		WithOnEvict(func(k string, _ int) { evicted = append(evicted, k) }),
+	)
+	for i := 0; i < 4; i++ {
+		cache.Put(fmt.Sprint(i), i)
+	}
+	cache.Get("0")
+	assert.Equal(t, cache.Size(), 4, "The cache should grow up to the high watermark.")
+	assert.Empty(t, evicted, "Nothing should be evicted up to the high watermark.")
+	cache.Put("4", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"0", "4"}, "The cache should shrink down to the low watermark.")
+	assert.Equal(t, evicted, []string{"1", "2", "3"}, "The least recently used elements should have been evicted.")
+	assert.Equal(t, cache.Stats().Evictions, int64(3), "All evictions should be counted.")
+
+	// LFU can be chosen too
+	lfu := New(WithMaxEntriesLFU[string, int](10), WithWatermarks[string, int](3, 2))
+	lfu.Put("a", 1)
+	lfu.Put("b", 2)
+	lfu.Put("c", 3)
+	lfu.Get("b")
+	lfu.Put("d", 4)
+	assert.ElementsMatch(t, lfu.Keys(), []string{"b", "d"}, "The least frequently used elements should have been evicted.")
+
+	assert.Equal(t, New(WithWatermarks[string, int](2, 2)).maxEntries, 0, "Invalid watermarks should be ignored.")
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// WithMemoryPressureEviction applies the memory pressure eviction option to
+// the Cache, which then starts a goroutine reading the heap usage of the
+// whole program (see runtime.MemStats) every interval, until the Cache is
+// closed (see Close); whenever the heap in use exceeds the given threshold,
+// in bytes, the least recently used elements are evicted, down to a low
+// watermark of the given number of elements fewer, so that the Cache keeps
+// shrinking as long as the pressure lasts. To evict the least frequently
+// used ones instead, apply WithMaxEntriesLFU first.
+func WithMemoryPressureEviction[K comparable, V any](interval time.Duration, threshold uint64, perCycle int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if interval > 0 && threshold > 0 && perCycle > 0 {
+			c.memoryInterval = interval
+			c.heapThreshold = threshold
+			c.shedPerCycle = perCycle
+			if c.evictor == nil {
+				c.evictor = newLRU[K]()
+			}
+		}
+	}
+}
+
+// WithSoftMemoryLimit applies the soft memory limit option to the Cache,
+// which then starts a goroutine reading the heap usage of the whole program
+// (see runtime.MemStats) every interval, until the Cache is closed (see
+// Close), and evicts the least recently used elements whenever the heap in
+// use comes within the given margin, in bytes, of the given limit; if the
+// limit is not positive, the soft memory limit of the Go runtime is used
+// instead (see debug.SetMemoryLimit and GOMEMLIMIT), as long as one is set.
+// Each cycle evicts as many elements as set by WithMemoryPressureEviction,
+// whose goroutine and interval are shared if it is applied too, or about a
+// tenth of them otherwise.
+func WithSoftMemoryLimit[K comparable, V any](interval time.Duration, limit int64, margin int64) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if interval > 0 && margin >= 0 {
+			c.memoryInterval = interval
+			c.softLimit = true
+			c.memoryLimit = limit
+			c.limitMargin = margin
+			if c.evictor == nil {
+				c.evictor = newLRU[K]()
+			}
+		}
+	}
+}
+
+// heapInUse returns the bytes of heap memory in use by the program.
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// pressured returns whether the program is under memory pressure, with the
+// given bytes of heap memory in use.
+func (c *Cache[K, V]) pressured(heap uint64) bool {
+	if c.heapThreshold > 0 && heap > c.heapThreshold {
+		return true
+	}
+	if !c.softLimit {
+		return false
+	}
+	limit := c.memoryLimit
+	if limit <= 0 {
+		limit = debug.SetMemoryLimit(-1)
+	}
+	if limit == math.MaxInt64 {
+		// no limit set
+		return false
+	}
+	return heap > math.MaxInt64 || int64(heap) >= limit-c.limitMargin
+}
+
+// relieve evicts elements if the program is under memory pressure.
+func (c *Cache[K, V]) relieve() {
+	heap := heapInUse()
+	if !c.pressured(heap) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	size := c.store.Len()
+	shed := c.shedPerCycle
+	if shed == 0 {
+		shed = size/10 + 1
+	}
+	target := size - shed
+	if target < 0 {
+		target = 0
+	}
+	c.evictDownNoLock(target)
+	if c.store.Len() < size {
+		if c.logger != nil {
+			c.logger.Debug("values evicted under memory pressure", "heap", heap, "count", size-c.store.Len())
+		}
+		c.storeNoLock(false)
+	}
+}
+
+// startMemoryJanitor starts the goroutine evicting elements under memory
+// pressure, if memory pressure eviction or the soft memory limit is enabled;
+// it is stopped by Close.
+func (c *Cache[K, V]) startMemoryJanitor() {
+	if c.memoryInterval == 0 {
+		return
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(c.memoryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.relieve()
+			}
+		}
+	}()
+	c.onClose(func() {
+		close(done)
+		<-exited
+	})
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheMemoryPressureEviction(t *testing.T) {
+
+	runtime.GC()
+	threshold := heapInUse() + 32<<20
+	cache := New(WithMemoryPressureEviction[int, int](5*time.Millisecond, threshold, 10))
+	defer cache.Close()
+	for i := 0; i < 100; i++ {
+		cache.Put(i, i)
+	}
+	cache.Get(0)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, cache.Size(), 100, "Nothing should be evicted below the threshold.")
+
+	ballast := make([]byte, 64<<20)
+	for i := range ballast {
+		ballast[i] = 1
+	}
+	assert.Eventually(t, func() bool { return cache.Size() < 100 }, time.Second, 5*time.Millisecond, "Elements should be evicted past the threshold.")
+	runtime.KeepAlive(ballast)
+	ballast = nil
+	runtime.GC()
+	time.Sleep(20 * time.Millisecond)
+
+	size := cache.Size()
+	assert.Equal(t, (100-size)%10, 0, "Elements should be evicted in batches.")
+	_, ok := cache.Get(0)
+	assert.Equal(t, ok, size > 0, "The least recently used elements should be evicted first.")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, cache.Size(), size, "Nothing should be evicted once the pressure is gone.")
+	assert.Equal(t, cache.Stats().Evictions, int64(100-size), "The evictions should be counted.")
+}
+
+func TestCacheSoftMemoryLimit(t *testing.T) {
+
+	for _, runtimeLimit := range []bool{false, true} {
+		runtime.GC()
+		limit := int64(heapInUse() + 48<<20)
+		options := []Option[int, int]{}
+		if runtimeLimit {
+			defer debug.SetMemoryLimit(debug.SetMemoryLimit(limit))
+			options = append(options, WithSoftMemoryLimit[int, int](5*time.Millisecond, 0, 16<<20))
+		} else {
+			options = append(options, WithSoftMemoryLimit[int, int](5*time.Millisecond, limit, 16<<20))
+		}
+		cache := New(options...)
+		for i := 0; i < 100; i++ {
+			cache.Put(i, i)
+		}
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, cache.Size(), 100, "Nothing should be evicted away from the limit.")
+
+		ballast := make([]byte, 40<<20)
+		for i := range ballast {
+			ballast[i] = 1
+		}
+		assert.Eventually(t, func() bool { return cache.Size() < 100 }, time.Second, 5*time.Millisecond, "Elements should be evicted close to the limit.")
+		runtime.KeepAlive(ballast)
+		cache.Close()
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// TTLMetaKey is the metadata key that PutWithMeta reads the TTL of the
+// element from, if WithKeyTTLOverrideFromMeta is set.
+const TTLMetaKey = "ttl"
+
+// WithKeyTTLOverrideFromMeta applies the metadata TTL option to the Cache:
+// PutWithMeta then reads the TTL of the element from the metadata under
+// TTLMetaKey, if any, as a duration string (see time.ParseDuration), and
+// applies it as with PutWithTTL, overriding any computed one.
+func WithKeyTTLOverrideFromMeta[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.metaTTL = true
+	}
+}
+
+// PutWithMeta is like Put, but it attaches the given metadata to the element,
+// e.g. its origin; metadata only lives in memory and is not persisted, and
+// putting the element in any other way clears it. With
+// WithKeyTTLOverrideFromMeta, the metadata may also set the TTL of the
+// element, and an invalid TTL is reported as an error, with nothing stored.
+// A read-only Cache (see ReadOnly) stores nothing and fails with
+// ErrReadOnly.
+func (c *Cache[K, V]) PutWithMeta(k K, v V, meta map[string]string) (bool, error) {
+	defer c.timed("put")()
+	if c.logger != nil {
+		c.logger.Debug("putting value into cache with metadata", "key", k, "value", v, "meta", meta)
+	}
+	var (
+		ttl time.Duration
+		set bool
+	)
+	if s, ok := meta[TTLMetaKey]; ok && c.metaTTL {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil {
+			if c.logger != nil {
+				c.logger.Error("invalid TTL in metadata", "key", k, "ttl", s, "error", err)
+			}
+			return false, fmt.Errorf("invalid %q metadata: %w", TTLMetaKey, err)
+		}
+		set = true
+	}
+	stored := false
+	defer c.putted(k, v, &stored)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return false, ErrReadOnly
+	}
+	if _, ok := c.liveNoLock(k); ok {
+		return false, nil
+	}
+	c.setNoLock(k, v)
+	if set {
+		c.expireNoLock(k, ttl)
+	}
+	if len(meta) > 0 {
+		if c.meta == nil {
+			c.meta = map[K]map[string]string{}
+		}
+		c.meta[k] = maps.Clone(meta)
+	}
+	stored = true
+	c.storeNoLock(false)
+	return true, nil
+}
+
+// Meta returns a copy of the metadata attached to the element under the
+// given key (see PutWithMeta), and whether there is any.
+func (c *Cache[K, V]) Meta(k K) (map[string]string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	meta, ok := c.meta[k]
+	if !ok || c.expiredNoLock(k, c.clock()) {
+		return nil, false
+	}
+	return maps.Clone(meta), true
+}
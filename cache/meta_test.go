@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePutWithMeta(t *testing.T) {
+
+	cache := New[string, int]()
+	stored, err := cache.PutWithMeta("a", 1, map[string]string{"origin": "db", TTLMetaKey: "1m"})
+	assert.NoError(t, err, "Putting with metadata should not fail.")
+	assert.True(t, stored, "The element should have been stored.")
+	meta, ok := cache.Meta("a")
+	assert.True(t, ok, "The element should have metadata.")
+	assert.Equal(t, meta, map[string]string{"origin": "db", TTLMetaKey: "1m"}, "The metadata is invalid.")
+	_, ok = cache.Expiry("a")
+	assert.False(t, ok, "The TTL metadata should be ignored without the option.")
+
+	stored, _ = cache.PutWithMeta("a", 2, map[string]string{"origin": "api"})
+	assert.False(t, stored, "Existing elements should not be replaced.")
+	cache.Replace("a", 3)
+	_, ok = cache.Meta("a")
+	assert.False(t, ok, "Putting in any other way should clear the metadata.")
+	cache.PutWithMeta("b", 1, map[string]string{"origin": "db"})
+	cache.Delete("b")
+	_, ok = cache.Meta("b")
+	assert.False(t, ok, "Deleting should clear the metadata.")
+}
+
+func TestCacheKeyTTLOverrideFromMeta(t *testing.T) {
+
+	now := time.Now()
+	cache := New(WithKeyTTLOverrideFromMeta[string, int]())
+	cache.clock = func() time.Time { return now }
+
+	stored, err := cache.PutWithMeta("a", 1, map[string]string{TTLMetaKey: "90s"})
+	assert.NoError(t, err, "Putting with a valid TTL should not fail.")
+	assert.True(t, stored, "The element should have been stored.")
+	expiry, ok := cache.Expiry("a")
+	assert.True(t, ok, "The element should expire.")
+	assert.Equal(t, expiry, now.Add(90*time.Second), "The expiry is invalid.")
+	cache.PutWithMeta("b", 2, map[string]string{"origin": "db"})
+	_, ok = cache.Expiry("b")
+	assert.False(t, ok, "Elements with no TTL metadata should not expire.")
+
+	stored, err = cache.PutWithMeta("c", 3, map[string]string{TTLMetaKey: "soon"})
+	assert.ErrorContains(t, err, `invalid "ttl" metadata`, "A malformed TTL should be reported.")
+	assert.False(t, stored, "Nothing should be stored with a malformed TTL.")
+	assert.False(t, cache.Contains("c"), "Nothing should be stored with a malformed TTL.")
+
+	now = now.Add(time.Minute)
+	_, ok = cache.Get("a")
+	assert.True(t, ok, "The element should not expire before its TTL.")
+	now = now.Add(time.Minute)
+	_, ok = cache.Get("a")
+	assert.False(t, ok, "The element should expire after its TTL.")
+	_, ok = cache.Meta("a")
+	assert.False(t, ok, "Expired elements should have no metadata.")
+}
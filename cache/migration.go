@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrMigrationMismatch is returned by MigrateEncoding when the data read back
+// through the new backends differs from the contents of the Cache.
+var ErrMigrationMismatch = errors.New("migrated data does not match the cache contents")
+
+// Migration converts the raw payload of a format version into the payload
+// of the following version.
+type Migration func(raw []byte) ([]byte, error)
+
+// WithMigration applies a migration option to the Cache: when loading data
+// written by a Versioned encoding in an older format, the migration
+// registered for each version is applied in turn, from the data's version
+// up to the current one. Migrations are given the cache data as encoded by
+// the encoding wrapped by Versioned, without the expiry times (see
+// ExpiringEncoding), which are kept as they are.
+func WithMigration[K comparable, V any](from int, fn Migration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil && from >= 0 {
+			if c.migrations == nil {
+				c.migrations = map[int]Migration{}
+			}
+			c.migrations[from] = fn
+		}
+	}
+}
+
+// decodeMigrating decodes data with the given encoding along with its expiry
+// times, like decodeExpiring, first bringing it up to the current format
+// version if it was written by a Versioned encoding, even one wrapped in
+// another encoding, in an older format.
+func (c *Cache[K, V]) decodeMigrating(e Encoding[K, V], data []byte) (map[K]V, map[K]time.Time, error) {
+	switch x := e.(type) {
+	case *Versioned[K, V]:
+		if version, payload := splitVersion(data); version < x.Version {
+			return c.decodeMigrated(x, version, payload)
+		}
+	case expiringWrapper[K, V]:
+		payload, err := x.unwrapData(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c.decodeMigrating(x.unwrap(), payload)
+	}
+	return decodeExpiring(e, data)
+}
+
+// decodeMigrated applies the migrations registered for each format version
+// in turn to the payload of versioned data in an older format, and decodes
+// the result with the wrapped encoding; if the wrapped encoding carries the
+// expiry times itself, only the cache data is migrated, without them.
+func (c *Cache[K, V]) decodeMigrated(versioned *Versioned[K, V], version uint8, payload []byte) (map[K]V, map[K]time.Time, error) {
+	var expiries map[K]time.Time
+	split := false
+	if _, ok := versioned.Encoding.(expiringWrapper[K, V]); !ok {
+		if x, ok := versioned.Encoding.(ExpiringEncoding[K]); ok {
+			var err error
+			if payload, expiries, err = x.SplitExpiries(payload); err != nil {
+				return nil, nil, err
+			}
+			split = true
+		}
+	}
+	for ; version < versioned.Version; version++ {
+		fn, ok := c.migrations[int(version)]
+		if !ok {
+			return nil, nil, fmt.Errorf("no migration from format version %d", version)
+		}
+		if c.logger != nil {
+			c.logger.Debug("migrating cache data", "from", version, "to", version+1)
+		}
+		var err error
+		if payload, err = fn(payload); err != nil {
+			return nil, nil, fmt.Errorf("migrating from format version %d: %w", version, err)
+		}
+	}
+	if split {
+		m, err := versioned.Encoding.Decode(payload)
+		return m, expiries, err
+	}
+	return decodeExpiring(versioned.Encoding, payload)
+}
+
+// MigrateEncoding moves the Cache to a new encoding and persistence: it loads
+// the data through the current backends, writes it through the new ones and
+// reads it back, switching the Cache over only if the decoded data matches
+// its contents; otherwise the current backends are left in place and
+// ErrMigrationMismatch is returned.
+func (c *Cache[K, V]) MigrateEncoding(encoding Encoding[K, V], persistence Persistence) error {
+	if encoding == nil || persistence == nil {
+		return errors.New("invalid encoding or persistence")
+	}
+	if c.logger != nil {
+		c.logger.Debug("migrating cache to new encoding and persistence")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.loadNoLock(); err != nil {
+		return fmt.Errorf("loading through the current backends: %w", err)
+	}
+	current, expiries := c.expiringWithNoLock(encoding, c.snapshotNoLock())
+
+	data, err := encodeExpiring(encoding, current, expiries)
+	if err != nil {
+		return fmt.Errorf("encoding with the new encoding: %w", err)
+	}
+	if err = persistence.Write(data); err != nil {
+		return fmt.Errorf("writing to the new persistence: %w", err)
+	}
+	if data, err = persistence.Read(); err != nil {
+		return fmt.Errorf("reading back from the new persistence: %w", err)
+	}
+	migrated, times, err := decodeExpiring(encoding, data)
+	if err != nil {
+		return fmt.Errorf("decoding with the new encoding: %w", err)
+	}
+	if len(migrated) != len(current) || (len(current) > 0 && !reflect.DeepEqual(migrated, current)) || !sameExpiries(times, expiries) {
+		if c.logger != nil {
+			c.logger.Error("migrated data does not match, keeping current backends", "expected", len(current), "actual", len(migrated))
+		}
+		return ErrMigrationMismatch
+	}
+
+	c.ioLock.Lock()
+	c.encoding = encoding
+	c.persistence = persistence
+	c.ioLock.Unlock()
+	if c.logger != nil {
+		c.logger.Debug("cache migrated", "entries", len(current))
+	}
+	return nil
+}
+
+// sameExpiries returns whether the two sets of expiry times match.
+func sameExpiries[K comparable](a, b map[K]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, t := range a {
+		if u, ok := b[k]; !ok || !t.Equal(u) {
+			return false
+		}
+	}
+	return true
+}
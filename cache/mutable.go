@@ -0,0 +1,93 @@
+package cache
+
+// WithMutableAccess applies the mutable access option to the Cache, which
+// then keeps each value in its own memory location, so that LockedUpdate can
+// mutate values in place rather than copying them out of and back into the
+// store; this pays off with large struct values.
+func WithMutableAccess[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.store = &pointerStore[K, V]{data: map[K]*V{}}
+	}
+}
+
+// LockedUpdate calls fn with a pointer to the value stored under the given
+// key, holding the write lock, and then persists the cache according to the
+// policy; it returns whether the key exists. With WithMutableAccess (and no
+// interning) the pointer refers to the stored value itself, otherwise to a
+// copy that is stored back once fn returns. Either way, the pointer is only
+// valid while fn runs and must not escape it. A read-only Cache (see
+// ReadOnly) does not call fn and returns false.
+func (c *Cache[K, V]) LockedUpdate(k K, fn func(v *V)) bool {
+	defer c.timed("replace")()
+	if c.logger != nil {
+		c.logger.Debug("updating value in cache", "key", k)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return false
+	}
+	if _, ok := c.liveNoLock(k); !ok {
+		return false
+	}
+	if s, ok := c.store.(*pointerStore[K, V]); ok && c.interned == nil {
+		p := s.data[k]
+		fn(p)
+		observe(c.policy, *p)
+		c.writtenNoLock(k)
+	} else {
+		v, _ := c.store.Get(k)
+		fn(&v)
+		c.setNoLock(k, v)
+	}
+	c.storeNoLock(false)
+	return true
+}
+
+// pointerStore is a Store keeping each value in its own memory location.
+type pointerStore[K comparable, V any] struct {
+	data map[K]*V
+}
+
+// Get returns the value associated with the key and whether it exists.
+func (p *pointerStore[K, V]) Get(k K) (V, bool) {
+	if v, ok := p.data[k]; ok {
+		return *v, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set associates the value with the key, reusing the memory location of
+// the existing value, if any.
+func (p *pointerStore[K, V]) Set(k K, v V) {
+	if old, ok := p.data[k]; ok {
+		*old = v
+		return
+	}
+	p.data[k] = &v
+}
+
+// Delete removes the key and its value.
+func (p *pointerStore[K, V]) Delete(k K) {
+	delete(p.data, k)
+}
+
+// Range calls fn for each element, stopping when it returns false.
+func (p *pointerStore[K, V]) Range(fn func(k K, v V) bool) {
+	for k, v := range p.data {
+		if !fn(k, *v) {
+			return
+		}
+	}
+}
+
+// Len returns the number of elements.
+func (p *pointerStore[K, V]) Len() int {
+	return len(p.data)
+}
+
+// Clear drops all the elements.
+func (p *pointerStore[K, V]) Clear() {
+	p.data = map[K]*V{}
+}
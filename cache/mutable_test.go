@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type large struct {
+	Counter int
+	Payload [4096]int
+}
+
+func TestCacheLockedUpdate(t *testing.T) {
+
+	for _, mutable := range []bool{true, false} {
+		persistence := &memory{}
+		options := []Option[string, large]{
+			WithPersistence[string, large](persistence),
+			WithPolicy[string, large](&Always{}),
+		}
+		if mutable {
+			options = append(options, WithMutableAccess[string, large]())
+		}
+		cache := New(options...)
+		cache.Put("a", large{})
+
+		var first *large
+		for i := 0; i < 3; i++ {
+			ok := cache.LockedUpdate("a", func(v *large) {
+				if first == nil {
+					first = v
+				} else if mutable {
+					assert.Same(t, v, first, "The value should be mutated in place.")
+				}
+				v.Counter++
+				v.Payload[i] = i + 1
+			})
+			assert.True(t, ok, "Present keys should be updated.")
+		}
+		assert.False(t, cache.LockedUpdate("b", func(v *large) { t.Error("Absent keys should not be updated.") }), "Absent keys should not be updated.")
+
+		v, _ := cache.Get("a")
+		assert.Equal(t, v.Counter, 3, "The updates should be reflected.")
+		assert.Equal(t, v.Payload[:4], []int{1, 2, 3, 0}, "The updates should be reflected.")
+		assert.Equal(t, persistence.Writes(), 4, "Each update should have been persisted.")
+
+		restored := New(WithPersistence[string, large](persistence))
+		restored.Load()
+		v, _ = restored.Get("a")
+		assert.Equal(t, v.Counter, 3, "The updates should have been persisted.")
+	}
+}
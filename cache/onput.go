@@ -0,0 +1,41 @@
+package cache
+
+// maxPutDepth is the maximum number of on-put hooks that can be nested in
+// the same call chain, to stop hooks that keep putting elements in the Cache
+// from recursing forever.
+const maxPutDepth = 16
+
+// WithOnPut applies the on-put hook option to the Cache; the hook is invoked
+// after each element is successfully stored by Put, TryPut, PutMany (or
+// PutMulti), any of the Replace variants or the GetFresh write-back (see
+// WithFreshWriteBack), e.g. to maintain derived elements in the same Cache. It runs outside the lock, so it can safely
+// access the Cache; to stop hooks from recursing forever through the
+// elements they put in turn, hooks are skipped once 16 of them are nested in
+// the same call chain, regardless of the hooks running in other ones. The
+// Cache handed to the hook is a view of the same Cache that carries the
+// depth of the chain, also across goroutines: hooks must put elements
+// through it, rather than through another reference to the Cache, for their
+// depth to be counted.
+func WithOnPut[K comparable, V any](fn func(c *Cache[K, V], k K, v V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.onPut = fn
+		}
+	}
+}
+
+// putted invokes the on-put hook, if any, if the element was stored; it is
+// meant to be deferred before acquiring the lock, so that it runs after the
+// lock is released.
+func (c *Cache[K, V]) putted(k K, v V, stored *bool) {
+	if c.onPut == nil || !*stored {
+		return
+	}
+	if c.putDepth >= maxPutDepth {
+		if c.logger != nil {
+			c.logger.Warn("maximum on-put hook depth reached, skipping hook", "key", k)
+		}
+		return
+	}
+	c.onPut(&Cache[K, V]{state: c.state, putDepth: c.putDepth + 1, ctx: c.ctx}, k, v)
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheOnPut(t *testing.T) {
+
+	cache := New(
+		WithOnPut(func(c *Cache[string, int], k string, v int) {
+			if strings.HasPrefix(k, "user:") {
+				c.Replace("users:count", len(c.Keys())-1)
+			}
+		}),
+	)
+	cache.Put("user:1", 1)
+	cache.Put("user:2", 2)
+	count, _ := cache.Get("users:count")
+	assert.Equal(t, count, 2, "The hook should have updated the counter.")
+	cache.Put("user:1", 10)
+	count, _ = cache.Get("users:count")
+	assert.Equal(t, count, 2, "The hook should not run when nothing is stored.")
+	cache.Replace("user:3", 3)
+	cache.PutMany(map[string]int{"user:4": 4, "user:5": 5})
+	count, _ = cache.Get("users:count")
+	assert.Equal(t, count, 5, "The hook should run for replaced and bulk put elements.")
+}
+
+func TestCacheOnPutRecursion(t *testing.T) {
+
+	calls := 0
+	cache := New(
+		WithOnPut(func(c *Cache[int, int], k int, v int) {
+			calls++
+			c.Put(k+1, v)
+		}),
+	)
+	cache.Put(0, 0)
+	assert.Equal(t, calls, maxPutDepth, "Nested hooks should stop at the maximum depth.")
+	assert.Equal(t, cache.Size(), maxPutDepth+1, "The elements put by the hooks should be stored.")
+}
+
+func TestCacheOnPutConcurrent(t *testing.T) {
+
+	var calls atomic.Int32
+	cache := New(
+		WithOnPut(func(c *Cache[int, int], k int, v int) {
+			calls.Add(1)
+			time.Sleep(time.Millisecond)
+			c.Put(k+1, v)
+		}),
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.Put(i*100, i)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int(calls.Load()), 40*maxPutDepth, "Concurrent call chains should each reach the maximum depth.")
+	assert.Equal(t, cache.Size(), 40*(maxPutDepth+1), "The elements put by the hooks should be stored.")
+}
+
+func TestCacheOnPutAsync(t *testing.T) {
+
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	cache := New(
+		WithOnPut(func(c *Cache[int, int], k int, v int) {
+			calls.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Put(k+1, v)
+			}()
+		}),
+	)
+	cache.Put(0, 0)
+	assert.Eventually(t, func() bool { return cache.Size() == maxPutDepth+1 }, time.Second, time.Millisecond, "The elements put by the hooks should be stored.")
+	wg.Wait()
+	assert.Equal(t, int(calls.Load()), maxPutDepth, "Hooks handing work to other goroutines should stop at the maximum depth.")
+}
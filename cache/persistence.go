@@ -4,30 +4,186 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"syscall"
 )
 
+// ErrNoData is returned (possibly wrapped) by a Persistence when there is
+// simply nothing to read back yet, as opposed to a genuine failure.
+var ErrNoData = errors.New("no data")
+
 // Persistence defines the behaviour of how a Cache contents
-// get persisted.
+// get persisted; Read returns an error wrapping ErrNoData when
+// there is nothing to read.
 type Persistence interface {
 	Write(data []byte) error
 	Read() ([]byte, error)
 }
 
+// StreamingPersistence is implemented by persistences that can provide an
+// io.WriteCloser to write the encoded data to incrementally; the data is
+// committed when the writer is closed, unless the writer also has an
+// Abort() error method, which is called instead when writing fails.
+type StreamingPersistence interface {
+	Writer() (io.WriteCloser, error)
+}
+
+// Pinger is implemented by persistences that can check whether their
+// underlying storage is reachable, without reading or writing any data.
+type Pinger interface {
+	Ping() error
+}
+
+// VersionedPersistence is implemented by persistences that can tell whether
+// the data they hold has changed, by returning a version that differs
+// whenever it does; the version of missing data is empty.
+type VersionedPersistence interface {
+	Version() (string, error)
+}
+
+// ValidatingPersistence is implemented by persistences that hold several
+// copies of the data, e.g. Fallback, and can pass over those the Cache
+// cannot use: ReadValid is like Read, but it only returns data for which
+// valid returns no error, treating the others like those that could not be
+// read; the Cache validates the data by decoding it.
+type ValidatingPersistence interface {
+	ReadValid(valid func(data []byte) error) ([]byte, error)
+}
+
 // File persists the encoded data, and reads it back from a
-// given file.
+// given file; data is written to a temporary file in the same
+// directory, which is then renamed over the given one, so that
+// a crash mid-write never leaves a truncated file behind. If
+// Sync is set, the temporary file is flushed to stable storage
+// before being renamed.
 type File struct {
 	Path string
+	Sync bool
 }
 
-// Write writes data to the given file.
+// Write writes data to the given file; if the disk is full, the
+// error wraps ErrDiskFull.
 func (f *File) Write(data []byte) error {
-	return os.WriteFile(f.Path, data, 0644)
+	err := f.write(data)
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %w", ErrDiskFull, err)
+	}
+	return err
+}
+
+// write writes data to the given file through a Writer.
+func (f *File) write(data []byte) error {
+	w, err := f.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		abort(w)
+		return err
+	}
+	return w.Close()
+}
+
+// Writer opens a temporary file for writing, which replaces the
+// given file when the writer is closed; if the given file exists
+// and is not a regular file (e.g. a device), it is written to
+// directly instead.
+func (f *File) Writer() (io.WriteCloser, error) {
+	if info, err := os.Stat(f.Path); err == nil && !info.Mode().IsRegular() {
+		return os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	}
+	file, err := os.CreateTemp(filepath.Dir(f.Path), "."+filepath.Base(f.Path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &atomicWriter{file: file, path: f.Path, sync: f.Sync}, nil
 }
 
-// Read reads data back from the given file.
+// Read reads data back from the given file; a missing file
+// means there is no data.
 func (f *File) Read() ([]byte, error) {
-	return os.ReadFile(f.Path)
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrNoData, err)
+	}
+	return data, err
+}
+
+// Ping checks that the directory holding the given file exists.
+func (f *File) Ping() error {
+	info, err := os.Stat(filepath.Dir(f.Path))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", filepath.Dir(f.Path))
+	}
+	return nil
+}
+
+// Version returns the modification time and size of the given file.
+func (f *File) Version() (string, error) {
+	info, err := os.Stat(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// atomicWriter writes to a temporary file, and renames it over the
+// target file when closed.
+type atomicWriter struct {
+	file *os.File
+	path string
+	sync bool
+}
+
+// Write writes data to the temporary file.
+func (w *atomicWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close commits the data written so far, renaming the temporary file
+// over the target; if anything fails, the target is left untouched.
+func (w *atomicWriter) Close() error {
+	var err error
+	if w.sync {
+		err = w.file.Sync()
+	}
+	if e := w.file.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(w.file.Name(), w.path)
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+	}
+	return err
+}
+
+// Abort discards the data written so far, leaving the target untouched.
+func (w *atomicWriter) Abort() error {
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
+
+// abort gives up on the data written to w, without committing it if the
+// writer supports that, otherwise by simply closing it.
+func abort(w io.WriteCloser) error {
+	if a, ok := w.(interface{ Abort() error }); ok {
+		return a.Abort()
+	}
+	return w.Close()
 }
 
 // Console persists the encoded data to the console; it cannot read
@@ -42,9 +198,9 @@ func (c *Console) Write(data []byte) error {
 	return err
 }
 
-// Read reads data back from the given file.
+// Read always returns no data, since the console cannot be read back.
 func (*Console) Read() ([]byte, error) {
-	return nil, errors.New("not implemented")
+	return nil, ErrNoData
 }
 
 // Discard does not persist data anywhere, nor can it recover it.
@@ -55,7 +211,69 @@ func (*Discard) Write(_ []byte) error {
 	return nil
 }
 
-// Read always returns no data and a generic "not implemented" error.
+// Read always returns no data.
 func (*Discard) Read() ([]byte, error) {
-	return nil, errors.New("not implemented")
+	return nil, ErrNoData
+}
+
+// Fallback persists the encoded data to a primary Persistence and, whenever
+// reading it back from the primary fails, or the data read cannot be decoded
+// (see ValidatingPersistence), tries each of the replicas in turn until one
+// succeeds; writes only ever go to the primary.
+type Fallback struct {
+	Primary  Persistence
+	Replicas []Persistence
+}
+
+// Write writes data to the primary Persistence.
+func (f *Fallback) Write(data []byte) error {
+	return f.Primary.Write(data)
+}
+
+// Read reads data back from the primary Persistence, falling back to the
+// replicas in order; if all of them fail, the combined error is returned,
+// which only wraps ErrNoData if none of them has any data.
+func (f *Fallback) Read() ([]byte, error) {
+	return f.ReadValid(nil)
+}
+
+// ReadValid is like Read, but it also falls back whenever the data read is
+// not valid, if a validation function is given.
+func (f *Fallback) ReadValid(valid func(data []byte) error) ([]byte, error) {
+	read := func(p Persistence) ([]byte, error) {
+		data, err := p.Read()
+		if err == nil && valid != nil {
+			if err = valid(data); err != nil {
+				err = fmt.Errorf("invalid data: %w", err)
+			}
+		}
+		return data, err
+	}
+	data, err := read(f.Primary)
+	if err == nil {
+		return data, nil
+	}
+	sources := []string{"primary"}
+	errs := []error{err}
+	for i, replica := range f.Replicas {
+		data, err := read(replica)
+		if err == nil {
+			return data, nil
+		}
+		sources = append(sources, fmt.Sprintf("replica %d", i))
+		errs = append(errs, err)
+	}
+	nodata := true
+	for _, err := range errs {
+		nodata = nodata && errors.Is(err, ErrNoData)
+	}
+	for i, err := range errs {
+		if nodata || !errors.Is(err, ErrNoData) {
+			errs[i] = fmt.Errorf("%s: %w", sources[i], err)
+		} else {
+			// a genuine failure elsewhere must not be mistaken for no data
+			errs[i] = fmt.Errorf("%s: %v", sources[i], err)
+		}
+	}
+	return nil, errors.Join(errs...)
 }
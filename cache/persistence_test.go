@@ -0,0 +1,399 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallback(t *testing.T) {
+
+	dir := t.TempDir()
+
+	replica := &File{Path: filepath.Join(dir, "replica.json")}
+	cache := New(
+		WithPersistence[string, string](replica),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+	)
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+
+	// the primary does not exist, so reading must go through the replica
+	cache2 := New(
+		WithPersistence[string, string](&Fallback{
+			Primary:  &File{Path: filepath.Join(dir, "missing.json")},
+			Replicas: []Persistence{&Discard{}, replica},
+		}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	err := cache2.Load()
+	assert.NoError(t, err, "Loading from the replica should succeed.")
+	assert.ElementsMatch(t, cache2.Keys(), []string{"a", "b"}, "The key set is invalid.")
+
+	// when all reads fail the errors are combined
+	cache3 := New(
+		WithPersistence[string, string](&Fallback{
+			Primary:  &File{Path: filepath.Join(dir, "missing.json")},
+			Replicas: []Persistence{&Discard{}},
+		}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	err = cache3.Load()
+	assert.ErrorContains(t, err, "primary", "The error should report the primary failure.")
+	assert.ErrorContains(t, err, "replica 0", "The error should report the replica failure.")
+}
+
+func TestFallbackInvalid(t *testing.T) {
+
+	dir := t.TempDir()
+	corrupt := &File{Path: filepath.Join(dir, "corrupt.json")}
+	assert.NoError(t, corrupt.Write([]byte("{not json")), "Writing the corrupt data should succeed.")
+	replica := &File{Path: filepath.Join(dir, "replica.json")}
+	assert.NoError(t, replica.Write([]byte(`{"a":"aaa"}`)), "Writing the replica should succeed.")
+
+	cache := New(
+		WithPersistence[string, string](&Fallback{Primary: corrupt, Replicas: []Persistence{replica}}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	assert.NoError(t, cache.Load(), "Loading should fall back to the replica when the primary cannot be decoded.")
+	assert.Equal(t, cache.Keys(), []string{"a"}, "The replica data should have been loaded.")
+
+	cache = New(
+		WithPersistence[string, string](&Fallback{Primary: corrupt, Replicas: []Persistence{corrupt}}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	cache.Put("b", "bbb")
+	err := cache.Load()
+	assert.ErrorContains(t, err, "primary: invalid data", "The error should report the invalid primary data.")
+	assert.ErrorContains(t, err, "replica 0: invalid data", "The error should report the invalid replica data.")
+	assert.Equal(t, cache.Keys(), []string{"b"}, "The cache should be left untouched.")
+
+	data, err := (&Fallback{Primary: corrupt, Replicas: []Persistence{replica}}).Read()
+	assert.NoError(t, err, "Reading without validation should succeed.")
+	assert.Equal(t, string(data), "{not json", "Reading without validation should not fall back.")
+}
+
+// memory is a Persistence keeping the data in memory and counting the
+// writes; it can be made to fail on demand.
+type memory struct {
+	lock   sync.Mutex
+	data   []byte
+	writes int
+	err    error
+}
+
+func (m *memory) Write(data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.data = append([]byte(nil), data...)
+	m.writes++
+	return nil
+}
+
+func (m *memory) Read() ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.data, nil
+}
+
+func (m *memory) Writes() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.writes
+}
+
+func TestPersistenceNoData(t *testing.T) {
+
+	dir := t.TempDir()
+	empty := map[string]Persistence{
+		"file":     &File{Path: filepath.Join(dir, "missing.json")},
+		"console":  &Console{},
+		"discard":  &Discard{},
+		"rotating": &GzipRotatingFile{Path: filepath.Join(dir, "missing.json")},
+		"fallback": &Fallback{Primary: &Discard{}, Replicas: []Persistence{&File{Path: filepath.Join(dir, "missing.json")}}},
+	}
+	for name, persistence := range empty {
+		_, err := persistence.Read()
+		assert.ErrorIs(t, err, ErrNoData, "The %s persistence should report no data.", name)
+	}
+
+	_, err := (&File{Path: filepath.Join(dir, "missing.json")}).Read()
+	assert.ErrorIs(t, err, os.ErrNotExist, "The underlying error should still be available.")
+
+	// a directory cannot be read as a file, which is a genuine failure
+	_, err = (&File{Path: dir}).Read()
+	assert.Error(t, err, "Reading a directory should fail.")
+	assert.NotErrorIs(t, err, ErrNoData, "A genuine failure should not be reported as no data.")
+	_, err = (&Fallback{Primary: &File{Path: dir}, Replicas: []Persistence{&Discard{}}}).Read()
+	assert.NotErrorIs(t, err, ErrNoData, "A genuine failure should not be reported as no data.")
+
+	// an empty file is data, although there is none in it
+	path := filepath.Join(dir, "empty.json")
+	os.WriteFile(path, nil, 0644)
+	_, err = (&File{Path: path}).Read()
+	assert.NoError(t, err, "An existing empty file should be readable.")
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	assert.NoError(t, cache.Load(), "Loading empty data should succeed.")
+	assert.Equal(t, cache.Size(), 0, "Empty data should hold no elements.")
+
+	assert.ErrorIs(t, New[string, string]().Load(), ErrNoData, "Loading with no data should report it.")
+}
+
+func TestCacheCircuitBreaker(t *testing.T) {
+
+	persistence := &memory{err: errors.New("backend down")}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithCircuitBreaker[string, string](2, 20*time.Millisecond),
+	)
+
+	cache.Put("a", "aaa")
+	assert.Equal(t, cache.Breaker(), BreakerClosed, "The breaker should still be closed.")
+	cache.Put("b", "bbb")
+	assert.Equal(t, cache.Breaker(), BreakerOpen, "The breaker should have opened.")
+
+	// during the outage the cache keeps serving from memory
+	ok := cache.Put("c", "ccc")
+	assert.Equal(t, ok, true, "The value should have been put in memory.")
+	v, ok := cache.Get("c")
+	assert.Equal(t, ok, true, "The value should be present in the cache.")
+	assert.Equal(t, v, "ccc", "The value should be as expected.")
+	assert.ErrorIs(t, cache.Store(), ErrCircuitOpen, "Storing should report the open breaker.")
+
+	// once the backend recovers, the probe flushes the accumulated state
+	persistence.lock.Lock()
+	persistence.err = nil
+	persistence.lock.Unlock()
+	assert.Eventually(t, func() bool { return cache.Breaker() == BreakerClosed }, time.Second, 10*time.Millisecond, "The breaker should have closed.")
+	assert.Equal(t, persistence.Writes(), 1, "The accumulated state should have been flushed once.")
+	data, _ := persistence.Read()
+	assert.JSONEq(t, string(data), `{"a":"aaa","b":"bbb","c":"ccc"}`, "The flushed state is invalid.")
+
+	cache.Put("d", "ddd")
+	assert.Equal(t, persistence.Writes(), 2, "Writes should have resumed.")
+}
+
+func TestGzipRotatingFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	persistence := &GzipRotatingFile{Path: path, MaxSize: 64}
+
+	data := []byte(strings.Repeat("0123456789", 20))
+	assert.NoError(t, persistence.Write(data), "Writing should not fail.")
+	segments, _ := filepath.Glob(path + ".*.gz")
+	assert.Len(t, segments, 4, "The data should have been split across segments.")
+	read, err := persistence.Read()
+	assert.NoError(t, err, "Reading should not fail.")
+	assert.Equal(t, read, data, "The full data should be read back.")
+
+	// a smaller write rolls off the stale segments
+	assert.NoError(t, persistence.Write(data[:10]), "Writing should not fail.")
+	segments, _ = filepath.Glob(path + ".*.gz")
+	assert.Len(t, segments, 1, "Stale segments should have been removed.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, data[:10], "Only the new data should be read back.")
+
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	for i := 0; i < 20; i++ {
+		cache.Put(fmt.Sprintf("key-%02d", i), strings.Repeat("v", i))
+	}
+	assert.NoError(t, cache.Store(), "Streaming to the segments should not fail.")
+	restored := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	assert.NoError(t, restored.Load(), "Loading from the segments should not fail.")
+	assert.True(t, Equal(cache, restored, Eq[string]), "The cache should be read back in full.")
+}
+
+func TestGzipRotatingFileAtomicWrite(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+	persistence := &GzipRotatingFile{Path: path, MaxSize: 16}
+	old := []byte(strings.Repeat("old", 20))
+	assert.NoError(t, persistence.Write(old), "Writing should not fail.")
+	segments, _ := filepath.Glob(path + ".*.gz")
+	assert.Len(t, segments, 4, "The data should have been split across segments.")
+
+	w, err := persistence.Writer()
+	assert.NoError(t, err, "Opening the writer should succeed.")
+	w.Write([]byte(strings.Repeat("new", 30)))
+	read, _ := persistence.Read()
+	assert.Equal(t, read, old, "The segments should not change before the writer is closed.")
+	assert.NoError(t, abort(w), "Aborting should succeed.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, old, "The segments should not change when the write is aborted.")
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 5, "No new segments should be left behind.")
+
+	broken := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&brokenStream{}),
+	)
+	broken.Put("b", "bbb")
+	assert.Error(t, broken.Store(), "Storing should fail.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, old, "The segments should not change when streaming fails.")
+	entries, _ = os.ReadDir(dir)
+	assert.Len(t, entries, 5, "No new segments should be left behind.")
+
+	// a larger write adds segments, a smaller one rolls them off
+	data := []byte(strings.Repeat("0123456789", 10))
+	assert.NoError(t, persistence.Write(data), "Writing should not fail.")
+	segments, _ = filepath.Glob(path + ".*.gz")
+	assert.Len(t, segments, 7, "The new segments should have been added.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, data, "The new data should be read back.")
+	assert.NoError(t, persistence.Write(data[:20]), "Writing should not fail.")
+	segments, _ = filepath.Glob(path + ".*.gz")
+	assert.Len(t, segments, 2, "Stale segments should have been removed.")
+	listed, _ := persistence.segments()
+	assert.ElementsMatch(t, listed, segments, "The manifest should list the new segments.")
+	assert.True(t, strings.HasSuffix(listed[0], ".0.gz") && strings.HasSuffix(listed[1], ".1.gz"), "The manifest should list the segments in order.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, data[:20], "Only the new data should be read back.")
+	entries, _ = os.ReadDir(dir)
+	assert.Len(t, entries, 3, "No stale segments should be left behind.")
+	info, _ := os.Stat(segments[0])
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0644), "The segment permissions are invalid.")
+}
+
+func TestGzipRotatingFileSwitch(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+	persistence := &GzipRotatingFile{Path: path, MaxSize: 16}
+	old := []byte(strings.Repeat("old", 20))
+	assert.NoError(t, persistence.Write(old), "Writing should not fail.")
+	before, _ := persistence.segments()
+
+	// the new generation is written alongside the current one
+	w, _ := persistence.Writer()
+	w.Write([]byte(strings.Repeat("new", 30)))
+	segments, _ := filepath.Glob(path + ".*.gz")
+	assert.Len(t, segments, 4+6, "The new generation should be written alongside the current one.")
+	read, _ := persistence.Read()
+	assert.Equal(t, read, old, "Readers should see the current generation until the switch.")
+	assert.NoError(t, w.Close(), "Closing the writer should succeed.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, []byte(strings.Repeat("new", 30)), "Readers should see the new generation after the switch.")
+	for _, segment := range before {
+		_, err := os.Stat(segment)
+		assert.ErrorIs(t, err, os.ErrNotExist, "The previous generation should have been removed.")
+	}
+}
+
+func TestGzipRotatingFileLegacy(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+	data := []byte(strings.Repeat("0123456789", 6))
+	for i := 0; i < 3; i++ {
+		legacy := &GzipRotatingFile{Path: fmt.Sprintf("%s.%d", path, i)}
+		assert.NoError(t, legacy.Write(data[i*20:i*20+20]), "Writing should not fail.")
+		// turn the segment into one written without a manifest
+		listed, _ := legacy.segments()
+		os.Rename(listed[0], fmt.Sprintf("%s.%d.gz", path, i))
+		os.Remove(legacy.manifest())
+	}
+	persistence := &GzipRotatingFile{Path: path}
+	read, err := persistence.Read()
+	assert.NoError(t, err, "Reading legacy segments should not fail.")
+	assert.Equal(t, read, data, "Legacy segments should be read back in full.")
+
+	assert.NoError(t, persistence.Write(data[:10]), "Writing should not fail.")
+	read, _ = persistence.Read()
+	assert.Equal(t, read, data[:10], "Only the new data should be read back.")
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 2, "Legacy segments should have been removed.")
+}
+
+func TestFileAtomicWrite(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+	for _, sync := range []bool{false, true} {
+		file := &File{Path: path, Sync: sync}
+		assert.NoError(t, file.Write([]byte("old")), "Writing should succeed.")
+
+		w, err := file.Writer()
+		assert.NoError(t, err, "Opening the writer should succeed.")
+		w.Write([]byte("partial"))
+		data, _ := os.ReadFile(path)
+		assert.Equal(t, string(data), "old", "The file should not change before the writer is closed.")
+		assert.NoError(t, abort(w), "Aborting should succeed.")
+		data, _ = os.ReadFile(path)
+		assert.Equal(t, string(data), "old", "The file should not change when the write is aborted.")
+
+		w, _ = file.Writer()
+		w.Write([]byte("new"))
+		assert.NoError(t, w.Close(), "Closing the writer should succeed.")
+		data, _ = os.ReadFile(path)
+		assert.Equal(t, string(data), "new", "The file should change once the writer is closed.")
+
+		info, _ := os.Stat(path)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0644), "The file permissions are invalid.")
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 1, "No temporary files should be left behind.")
+		os.Remove(path)
+	}
+}
+
+// brokenStream fails halfway through streaming the encoded data.
+type brokenStream struct {
+	JSON[string, string]
+}
+
+func (*brokenStream) EncodeTo(w io.Writer, _ map[string]string) error {
+	w.Write([]byte(`{"a":`))
+	return errors.New("broken stream")
+}
+
+func TestCacheAtomicStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	cache.Put("a", "aaa")
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	broken := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&brokenStream{}),
+	)
+	broken.Put("b", "bbb")
+	assert.Error(t, broken.Store(), "Storing should fail.")
+
+	restored := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	assert.NoError(t, restored.Load(), "Loading the previous contents should succeed.")
+	assert.Equal(t, restored.Keys(), []string{"a"}, "The previous contents should be intact.")
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAllPinned is returned by OverBudget when the Cache holds more elements
+// than its maximum size, because all those that could be evicted are pinned.
+var ErrAllPinned = errors.New("cache over budget with all elements pinned")
+
+// Pin exempts the element under the given key from eviction (see
+// WithMaxEntries and its variants) until it is unpinned, deleted or expires;
+// it returns whether the element is in the Cache. When all the elements are
+// pinned, storing a new one makes the Cache grow past its maximum size (see
+// OverBudget).
+func (c *Cache[K, V]) Pin(k K) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.liveNoLock(k); !ok {
+		return false
+	}
+	if c.logger != nil {
+		c.logger.Debug("pinning value", "key", k)
+	}
+	if c.pinned == nil {
+		c.pinned = map[K]bool{}
+	}
+	c.pinned[k] = true
+	c.forgetEvictionNoLock(k)
+	return true
+}
+
+// Unpin makes the element under the given key evictable again, as the most
+// recently used one; if the Cache grew past its maximum size while it was
+// pinned, the elements in excess are evicted right away.
+func (c *Cache[K, V]) Unpin(k K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.pinned[k] {
+		return
+	}
+	if c.logger != nil {
+		c.logger.Debug("unpinning value", "key", k)
+	}
+	delete(c.pinned, k)
+	if c.evictor == nil {
+		return
+	}
+	c.evictionLock.Lock()
+	c.evictor.written(k)
+	c.evictionLock.Unlock()
+	if size := c.store.Len(); c.maxEntries > 0 && size > c.maxEntries {
+		c.evictNoLock()
+		if c.store.Len() < size {
+			c.storeNoLock(false)
+		}
+	}
+}
+
+// Pinned returns whether the element under the given key is pinned.
+func (c *Cache[K, V]) Pinned(k K) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.pinned[k]
+}
+
+// OverBudget returns an error wrapping ErrAllPinned if the Cache holds more
+// elements than its maximum size, because all the others are pinned, nil
+// otherwise.
+func (c *Cache[K, V]) OverBudget() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.evictor != nil && c.maxEntries > 0 && c.store.Len() > c.maxEntries {
+		return fmt.Errorf("%w: %d entries, at most %d allowed", ErrAllPinned, c.store.Len(), c.maxEntries)
+	}
+	return nil
+}
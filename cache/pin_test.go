@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePin(t *testing.T) {
+
+	cache := New(WithMaxEntries[string, int](2))
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	assert.True(t, cache.Pin("a"), "Pinning a present element should succeed.")
+	assert.False(t, cache.Pin("x"), "Pinning a missing element should fail.")
+	assert.True(t, cache.Pinned("a"), "The element should be pinned.")
+	cache.Get("b")
+	cache.Get("a")
+	cache.Put("c", 3)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "c"}, "Pinned elements should not be evicted.")
+	assert.NoError(t, cache.OverBudget(), "The cache should be within its budget.")
+
+	// with all the elements pinned, the cache grows past its maximum
+	cache.Pin("c")
+	cache.Put("d", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "c", "d"}, "Pinned elements should not be evicted.")
+	cache.Pin("d")
+	cache.Put("e", 5)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "c", "d", "e"}, "Pinned elements should not be evicted.")
+	assert.ErrorIs(t, cache.OverBudget(), ErrAllPinned, "The cache should be over budget.")
+	assert.ErrorContains(t, cache.OverBudget(), "4 entries, at most 2 allowed", "The error should report the sizes.")
+
+	// unpinning evicts the elements in excess right away
+	cache.Unpin("a")
+	assert.False(t, cache.Pinned("a"), "The element should not be pinned anymore.")
+	assert.ElementsMatch(t, cache.Keys(), []string{"c", "d"}, "The unpinned elements in excess should have been evicted.")
+	cache.Delete("c")
+	assert.False(t, cache.Pinned("c"), "Deleting should drop the pin.")
+	cache.Put("c", 3)
+	cache.Put("f", 6)
+	assert.ElementsMatch(t, cache.Keys(), []string{"d", "f"}, "Elements put again should not be pinned.")
+	assert.NoError(t, cache.OverBudget(), "The cache should be within its budget.")
+}
+
+func TestCachePinLFU(t *testing.T) {
+
+	cache := New(WithMaxEntriesLFU[string, int](2))
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Get("b")
+	cache.Pin("a")
+	cache.Get("a")
+	cache.Put("c", 3)
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "c"}, "Pinned elements should not be evicted.")
+	cache.Unpin("a")
+	cache.Get("c")
+	cache.Put("d", 4)
+	assert.ElementsMatch(t, cache.Keys(), []string{"c", "d"}, "Unpinned elements should be evictable again.")
+}
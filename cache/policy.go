@@ -1,5 +1,11 @@
 package cache
 
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
 type Policy interface {
 	Trigger() bool
 }
@@ -16,16 +22,131 @@ func (*Never) Trigger() bool {
 	return false
 }
 
+// Batched triggers once every Size calls; a Size of 0 or 1 (or less)
+// triggers on every call.
 type Batched struct {
 	Size  int
 	count int
 }
 
+// NewBatched returns a Batched policy triggering once every size calls; it
+// panics if size is not positive.
+func NewBatched(size int) *Batched {
+	if size < 1 {
+		panic(fmt.Sprintf("cache: invalid batch size %d", size))
+	}
+	return &Batched{Size: size}
+}
+
 func (b *Batched) Trigger() bool {
 	b.count++
-	if b.count == b.Size {
+	if b.count >= b.Size {
 		b.count = 0
 		return true
 	}
 	return false
 }
+
+// Periodic triggers at most once every Interval: the first time it is asked,
+// and then whenever at least Interval has elapsed since it last triggered;
+// it is safe for concurrent use.
+type Periodic struct {
+	Interval time.Duration
+	lock     sync.Mutex
+	last     time.Time
+	now      func() time.Time
+}
+
+func (p *Periodic) Trigger() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	// time.Now carries a monotonic reading, so wall clock jumps do not count
+	t := now()
+	if !p.last.IsZero() && t.Sub(p.last) < p.Interval {
+		return false
+	}
+	p.last = t
+	return true
+}
+
+// composite combines the decisions of a set of policies.
+type composite struct {
+	policies []Policy
+	all      bool
+}
+
+// All returns a Policy that triggers only when all of the given policies
+// trigger on the same call. Every policy is asked on every call, exactly
+// once, even when the outcome is already known, so that stateful policies
+// (e.g. Batched, counting the writes) stay consistent; values written to the
+// Cache are passed on to the Observers among them. With no policies, it
+// always triggers.
+func All(policies ...Policy) Policy {
+	return &composite{policies: policies, all: true}
+}
+
+// Any returns a Policy that triggers when any of the given policies does; as
+// with All, every policy is asked on every call. With no policies, it never
+// triggers.
+func Any(policies ...Policy) Policy {
+	return &composite{policies: policies}
+}
+
+func (c *composite) Trigger() bool {
+	result := c.all
+	for _, p := range c.policies {
+		// no short-circuiting, every policy must see every call
+		if c.all {
+			result = p.Trigger() && result
+		} else {
+			result = p.Trigger() || result
+		}
+	}
+	return result
+}
+
+// observe passes the value written to the Cache on to the policy, if it is
+// an Observer, or to the Observers among the policies it combines.
+func observe[V any](p Policy, v V) {
+	switch p := p.(type) {
+	case Observer[V]:
+		p.Observe(v)
+	case *composite:
+		for _, p := range p.policies {
+			observe(p, v)
+		}
+	}
+}
+
+// Observer is implemented by policies that need to see the values written
+// to the Cache in order to decide when to trigger.
+type Observer[V any] interface {
+	Observe(v V)
+}
+
+// SizeThreshold triggers whenever the estimated size of the values written
+// since it last triggered, as reported by Sizeof, reaches Threshold bytes,
+// bounding the amount of data not yet persisted.
+type SizeThreshold[V any] struct {
+	Threshold int
+	Sizeof    func(v V) int
+	grown     int
+}
+
+func (s *SizeThreshold[V]) Observe(v V) {
+	if s.Sizeof != nil {
+		s.grown += s.Sizeof(v)
+	}
+}
+
+func (s *SizeThreshold[V]) Trigger() bool {
+	if s.grown >= s.Threshold {
+		s.grown = 0
+		return true
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheSizeThreshold(t *testing.T) {
+
+	writes := func(size int) int {
+		persistence := &memory{}
+		cache := New(
+			WithPersistence[string, string](persistence),
+			WithEncoding[string, string](&JSON[string, string]{}),
+			WithPolicy[string, string](&SizeThreshold[string]{
+				Threshold: 1000,
+				Sizeof:    func(v string) int { return len(v) },
+			}),
+		)
+		for i := 0; i < 20; i++ {
+			cache.Put(fmt.Sprintf("key-%02d", i), strings.Repeat("x", size))
+		}
+		return persistence.Writes()
+	}
+
+	assert.Equal(t, writes(10), 0, "Small values should not reach the threshold.")
+	assert.Equal(t, writes(100), 2, "The cache should flush every 1000 bytes.")
+	assert.Equal(t, writes(1000), 20, "Large values should flush on every put.")
+}
+
+func TestPeriodic(t *testing.T) {
+
+	clock := time.Now()
+	policy := &Periodic{Interval: time.Minute, now: func() time.Time { return clock }}
+
+	assert.True(t, policy.Trigger(), "The first call should trigger.")
+	assert.False(t, policy.Trigger(), "The policy should not trigger within the interval.")
+	clock = clock.Add(59 * time.Second)
+	assert.False(t, policy.Trigger(), "The policy should not trigger within the interval.")
+	clock = clock.Add(time.Second)
+	assert.True(t, policy.Trigger(), "The policy should trigger once the interval has elapsed.")
+	clock = clock.Add(30 * time.Second)
+	assert.False(t, policy.Trigger(), "The interval should restart when the policy triggers.")
+	clock = clock.Add(10 * time.Minute)
+	assert.True(t, policy.Trigger(), "The policy should trigger once however long has elapsed.")
+	assert.False(t, policy.Trigger(), "The policy should not trigger twice in a row.")
+}
+
+func TestPeriodicConcurrent(t *testing.T) {
+
+	policy := &Periodic{Interval: time.Hour}
+	var wg sync.WaitGroup
+	var triggered atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if policy.Trigger() {
+				triggered.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, triggered.Load(), int32(1), "Only one concurrent call should trigger.")
+}
+
+// counting counts how many times it is asked, and triggers as told.
+type counting struct {
+	result bool
+	calls  int
+}
+
+func (c *counting) Trigger() bool {
+	c.calls++
+	return c.result
+}
+
+func TestComposite(t *testing.T) {
+
+	yes, no := &counting{result: true}, &counting{result: false}
+	assert.False(t, All(no, yes).Trigger(), "All should not trigger unless all policies do.")
+	assert.True(t, All(yes, yes).Trigger(), "All should trigger when all policies do.")
+	assert.True(t, Any(yes, no).Trigger(), "Any should trigger when any policy does.")
+	assert.False(t, Any(no, no).Trigger(), "Any should not trigger unless a policy does.")
+	assert.Equal(t, yes.calls, 4, "Every policy should be asked exactly once per call.")
+	assert.Equal(t, no.calls, 4, "Every policy should be asked exactly once per call.")
+
+	assert.True(t, All().Trigger(), "All with no policies should trigger.")
+	assert.False(t, Any().Trigger(), "Any with no policies should not trigger.")
+
+	// the batches keep counting even when the other policy decides the outcome
+	every2, every3 := &Batched{Size: 2}, &Batched{Size: 3}
+	both, either := All(every2, every3), Any(&Batched{Size: 2}, &Batched{Size: 3})
+	var alls, anys []int
+	for i := 1; i <= 12; i++ {
+		if both.Trigger() {
+			alls = append(alls, i)
+		}
+		if either.Trigger() {
+			anys = append(anys, i)
+		}
+	}
+	assert.Equal(t, alls, []int{6, 12}, "All should trigger on common multiples.")
+	assert.Equal(t, anys, []int{2, 3, 4, 6, 8, 9, 10, 12}, "Any should trigger on either multiple.")
+}
+
+func TestCacheComposite(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](Any(
+			&Batched{Size: 10},
+			&SizeThreshold[string]{Threshold: 100, Sizeof: func(v string) int { return len(v) }},
+		)),
+	)
+	cache.Put("a", "x")
+	assert.Equal(t, persistence.Writes(), 0, "Neither policy should trigger yet.")
+	cache.Put("b", strings.Repeat("x", 100))
+	assert.Equal(t, persistence.Writes(), 1, "Values should be observed through the combinator.")
+	for i := 0; i < 8; i++ {
+		cache.Put(fmt.Sprintf("key-%d", i), "x")
+	}
+	assert.Equal(t, persistence.Writes(), 2, "The batch should trigger on the tenth write.")
+}
+
+func TestBatched(t *testing.T) {
+
+	for size, expected := range map[int][]int{
+		-1: {1, 2, 3, 4, 5, 6},
+		0:  {1, 2, 3, 4, 5, 6},
+		1:  {1, 2, 3, 4, 5, 6},
+		2:  {2, 4, 6},
+		3:  {3, 6},
+	} {
+		policy := &Batched{Size: size}
+		var triggered []int
+		for i := 1; i <= 6; i++ {
+			if policy.Trigger() {
+				triggered = append(triggered, i)
+			}
+		}
+		assert.Equal(t, triggered, expected, "A batch of size %d triggers on the wrong calls.", size)
+	}
+
+	assert.Equal(t, NewBatched(3), &Batched{Size: 3}, "The constructor should set the size.")
+	assert.Panics(t, func() { NewBatched(0) }, "A batch of size 0 should be rejected.")
+	assert.Panics(t, func() { NewBatched(-1) }, "A negative batch size should be rejected.")
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GzipRotatingFile persists the encoded data as a set of gzip-compressed
+// segments, each holding up to MaxSize bytes of uncompressed data, and a
+// manifest (Path.manifest) listing them in order. Every write produces a
+// new generation of segments (Path.<generation>.0.gz, Path.<generation>.1.gz
+// and so on) alongside the current one, then switches to it by renaming a
+// new manifest over the existing one, so that readers see either the old
+// data or the new one in full, and a failed write leaves the previous
+// generation untouched; the segments of the previous generation are removed
+// after the switch. Reading decompresses and concatenates the segments
+// listed in the manifest; without one, the segments written before the
+// manifest was introduced (Path.0.gz, Path.1.gz and so on) are read instead.
+// If MaxSize is not positive, all data goes into a single segment.
+type GzipRotatingFile struct {
+	Path    string
+	MaxSize int64
+}
+
+// Write writes data to the set of segments.
+func (g *GzipRotatingFile) Write(data []byte) error {
+	w, err := g.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		abort(w)
+		return err
+	}
+	return w.Close()
+}
+
+// Writer opens the first segment of a new generation for writing; further
+// segments are opened as each one fills up, and the new generation replaces
+// the current one, whose segments are removed, when the writer is closed.
+func (g *GzipRotatingFile) Writer() (io.WriteCloser, error) {
+	w := &rotatingWriter{g: g}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Read reads data back from the segments listed in the manifest,
+// decompressing them.
+func (g *GzipRotatingFile) Read() ([]byte, error) {
+	segments, err := g.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("%w: no segments found for %s", ErrNoData, g.Path)
+	}
+	var buffer bytes.Buffer
+	for i, segment := range segments {
+		file, err := os.Open(segment)
+		if err != nil {
+			return nil, err
+		}
+		err = decompress(&buffer, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, err)
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// manifest returns the name of the manifest.
+func (g *GzipRotatingFile) manifest() string {
+	return g.Path + ".manifest"
+}
+
+// segments returns the names of the current segments, in order: those
+// listed in the manifest or, without one, the legacy segments.
+func (g *GzipRotatingFile) segments() ([]string, error) {
+	data, err := os.ReadFile(g.manifest())
+	if errors.Is(err, fs.ErrNotExist) {
+		return g.legacy(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(g.Path)
+	segments := []string{}
+	for _, name := range strings.Split(string(data), "\n") {
+		if name != "" {
+			segments = append(segments, filepath.Join(dir, name))
+		}
+	}
+	return segments, nil
+}
+
+// legacy returns the names of the segments written without a manifest.
+func (g *GzipRotatingFile) legacy() []string {
+	segments := []string{}
+	for i := 0; ; i++ {
+		segment := fmt.Sprintf("%s.%d.gz", g.Path, i)
+		if _, err := os.Stat(segment); err != nil {
+			return segments
+		}
+		segments = append(segments, segment)
+	}
+}
+
+// decompress appends the decompressed contents of r to the buffer.
+func decompress(buffer *bytes.Buffer, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	_, err = io.Copy(buffer, gz)
+	return err
+}
+
+// rotatingWriter writes compressed data to the segments of a new generation
+// of a GzipRotatingFile, moving to the next one when the current one is full.
+type rotatingWriter struct {
+	g          *GzipRotatingFile
+	generation string
+	temps      []string
+	written    int64
+	file       *os.File
+	gz         *gzip.Writer
+}
+
+// Write compresses data into the current segment, rotating as needed.
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.g.MaxSize > 0 && w.written >= w.g.MaxSize {
+			if err := w.close(); err != nil {
+				return total, err
+			}
+			if err := w.open(); err != nil {
+				return total, err
+			}
+		}
+		n := len(p)
+		if w.g.MaxSize > 0 && int64(n) > w.g.MaxSize-w.written {
+			n = int(w.g.MaxSize - w.written)
+		}
+		m, err := w.gz.Write(p[:n])
+		total += m
+		w.written += int64(m)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close flushes the current segment and switches to the new generation,
+// renaming a new manifest over the existing one, then removes the segments
+// of the previous generation; if anything fails before the switch, the
+// current generation is left untouched.
+func (w *rotatingWriter) Close() error {
+	if err := w.close(); err != nil {
+		w.remove()
+		return err
+	}
+	stale, err := w.g.segments()
+	if err != nil {
+		w.remove()
+		return err
+	}
+	var manifest strings.Builder
+	for _, temp := range w.temps {
+		manifest.WriteString(filepath.Base(temp) + "\n")
+	}
+	if err := (&File{Path: w.g.manifest()}).Write([]byte(manifest.String())); err != nil {
+		w.remove()
+		return err
+	}
+	w.temps = nil
+	for _, segment := range stale {
+		if err := os.Remove(segment); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort discards the data written so far, removing the temporary segments
+// and leaving the existing ones untouched.
+func (w *rotatingWriter) Abort() error {
+	w.close()
+	return w.remove()
+}
+
+// open creates the next segment of the new generation; the first one names
+// the generation itself.
+func (w *rotatingWriter) open() error {
+	var file *os.File
+	var err error
+	base := filepath.Base(w.g.Path)
+	if w.generation == "" {
+		file, err = os.CreateTemp(filepath.Dir(w.g.Path), base+".*.0.gz")
+	} else {
+		file, err = os.OpenFile(fmt.Sprintf("%s.%s.%d.gz", w.g.Path, w.generation, len(w.temps)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if w.generation == "" {
+		w.generation = strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file.Name()), base+"."), ".0.gz")
+	}
+	w.temps = append(w.temps, file.Name())
+	w.file = file
+	w.gz = gzip.NewWriter(file)
+	w.written = 0
+	return nil
+}
+
+// close flushes and closes the current segment.
+func (w *rotatingWriter) close() error {
+	err := w.gz.Close()
+	if e := w.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// remove removes the segments of the new generation.
+func (w *rotatingWriter) remove() error {
+	var err error
+	for _, temp := range w.temps {
+		if e := os.Remove(temp); err == nil && !errors.Is(e, fs.ErrNotExist) {
+			err = e
+		}
+	}
+	w.temps = nil
+	return err
+}
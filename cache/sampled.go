@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// WithRandomizedEviction applies the sampled LRU eviction option to the
+// Cache which, like WithMaxEntries, evicts elements whenever storing one
+// pushes its size past the given maximum, but only approximates the least
+// recently used one: it samples the given number of elements at random and
+// evicts the least recently used among them. It keeps no global ordering of
+// the elements, which makes reads cheaper, as they only stamp the element
+// with the time of the access, at the price of sometimes evicting a more
+// recently used element; the larger the sample, the closer to exact LRU.
+func WithRandomizedEviction[K comparable, V any](n int, samples int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if n > 0 && samples > 0 {
+			c.maxEntries = n
+			c.evictor = newSampled[K](samples)
+		}
+	}
+}
+
+// sampledEntry is an element tracked by sampled, along with the logical time
+// of its last use.
+type sampledEntry struct {
+	index int
+	used  atomic.Uint64
+}
+
+// sampled is an evictor choosing the least recently used element among a
+// random sample; the elements are kept in a slice, so that they can be
+// sampled in constant time, and their uses are recorded atomically, so that
+// reads can run concurrently (see concurrentReader).
+type sampled[K comparable] struct {
+	samples int
+	keys    []K
+	entries map[K]*sampledEntry
+	clock   atomic.Uint64
+	random  *rand.Rand
+}
+
+// newSampled creates a new, empty sampled evictor with the given sample
+// size.
+func newSampled[K comparable](samples int) *sampled[K] {
+	return &sampled[K]{
+		samples: samples,
+		entries: map[K]*sampledEntry{},
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// written marks the element as the most recently used, tracking it if new.
+func (s *sampled[K]) written(k K) {
+	if _, ok := s.entries[k]; !ok {
+		s.entries[k] = &sampledEntry{index: len(s.keys)}
+		s.keys = append(s.keys, k)
+	}
+	s.read(k)
+}
+
+// read marks the element as the most recently used.
+func (s *sampled[K]) read(k K) {
+	if e, ok := s.entries[k]; ok {
+		e.used.Store(s.clock.Add(1))
+	}
+}
+
+// concurrentReads marks read as safe to call concurrently with itself.
+func (s *sampled[K]) concurrentReads() {}
+
+// forget drops the element, moving the last one in its place.
+func (s *sampled[K]) forget(k K) {
+	e, ok := s.entries[k]
+	if !ok {
+		return
+	}
+	last := len(s.keys) - 1
+	if e.index != last {
+		moved := s.keys[last]
+		s.keys[e.index] = moved
+		s.entries[moved].index = e.index
+	}
+	var zero K
+	s.keys[last] = zero
+	s.keys = s.keys[:last]
+	delete(s.entries, k)
+}
+
+// victim returns the least recently used element among a random sample.
+func (s *sampled[K]) victim() (K, bool) {
+	var (
+		victim K
+		oldest uint64
+		found  bool
+	)
+	if len(s.keys) == 0 {
+		return victim, false
+	}
+	for i := 0; i < s.samples; i++ {
+		k := s.keys[s.random.Intn(len(s.keys))]
+		if used := s.entries[k].used.Load(); !found || used < oldest {
+			victim, oldest, found = k, used, true
+		}
+	}
+	return victim, true
+}
+
+// reset drops all the elements.
+func (s *sampled[K]) reset() {
+	s.keys = nil
+	s.entries = map[K]*sampledEntry{}
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheRandomizedEviction(t *testing.T) {
+
+	evicted := []int{}
+	cache := New(
+		WithRandomizedEviction[int, int](100, 5),
+		WithOnEvict(func(k int, _ int) { evicted = append(evicted, k) }),
+	)
+	cache.evictor.(*sampled[int]).random = rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		cache.Put(i, i)
+	}
+	// the second half becomes more recently used than the first
+	for i := 50; i < 100; i++ {
+		cache.Get(i)
+	}
+	for i := 100; i < 150; i++ {
+		cache.Put(i, i)
+	}
+	assert.Equal(t, cache.Size(), 100, "The cache should not exceed its maximum size.")
+	assert.Len(t, evicted, 50, "The elements in excess should have been evicted.")
+	old := 0
+	for _, k := range evicted {
+		if k < 50 {
+			old++
+		}
+	}
+	assert.GreaterOrEqual(t, old, 35, "Mostly the least recently used elements should have been evicted.")
+
+	cache.Delete(120)
+	cache.Put(150, 150)
+	assert.Len(t, evicted, 50, "Deleting should make room.")
+	_, ok := cache.Get(150)
+	assert.True(t, ok, "The element just stored should not be evicted.")
+}
+
+func benchmarkEvictionGet(b *testing.B, option Option[int, int]) {
+	cache := New(option)
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Get(i % 1000)
+			i++
+		}
+	})
+}
+
+func BenchmarkGetExactLRU(b *testing.B) {
+	benchmarkEvictionGet(b, WithMaxEntries[int, int](1000))
+}
+
+func BenchmarkGetRandomizedEviction(b *testing.B) {
+	benchmarkEvictionGet(b, WithRandomizedEviction[int, int](1000, 5))
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"time"
+)
+
+// WithSoftDelete applies the soft delete option to the Cache: deleting an
+// element leaves a timestamped tombstone behind, so that merging with a
+// replica that still holds an older copy of the element does not bring it
+// back; tombstones are garbage-collected once older than the given TTL.
+// Tombstones only live in memory and are not persisted.
+func WithSoftDelete[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if ttl > 0 {
+			c.softDelete = ttl
+			c.tombstones = map[K]time.Time{}
+			c.modified = map[K]time.Time{}
+		}
+	}
+}
+
+// tombstoned returns whether this Cache holds a tombstone for the given key
+// that is newer than the other Cache's copy of the element; when the other
+// Cache does not track modification times, the tombstone always wins.
+func (c *Cache[K, V]) tombstoned(k K, other *Cache[K, V]) bool {
+	c.lock.RLock()
+	deleted, ok := c.tombstones[k]
+	c.lock.RUnlock()
+	if !ok || c.clock().Sub(deleted) > c.softDelete {
+		return false
+	}
+	other.lock.RLock()
+	modified := other.modified[k]
+	other.lock.RUnlock()
+	return !modified.After(deleted)
+}
+
+// reconcile applies the other Cache's tombstones to this Cache, removing the
+// elements that were not modified after being deleted in the other Cache.
+func (c *Cache[K, V]) reconcile(other *Cache[K, V]) {
+	other.lock.RLock()
+	tombstones := make(map[K]time.Time, len(other.tombstones))
+	for k, deleted := range other.tombstones {
+		tombstones[k] = deleted
+	}
+	other.lock.RUnlock()
+	if len(tombstones) == 0 {
+		return
+	}
+
+	if c.logger != nil {
+		c.logger.Debug("reconciling tombstones", "count", len(tombstones))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	changed := false
+	for k, deleted := range tombstones {
+		if c.clock().Sub(deleted) > other.softDelete {
+			continue
+		}
+		if _, ok := c.store.Get(k); !ok {
+			continue
+		}
+		if c.modified[k].After(deleted) {
+			continue
+		}
+		c.deleteNoLock(k)
+		if c.softDelete > 0 {
+			// keep the time of the original deletion
+			c.tombstones[k] = deleted
+		}
+		changed = true
+	}
+	c.collectTombstonesNoLock()
+	if changed {
+		c.storeNoLock(false)
+	}
+}
+
+// collectTombstonesNoLock removes the tombstones older than the soft delete
+// TTL; it must be called with the write lock held.
+func (c *Cache[K, V]) collectTombstonesNoLock() {
+	if c.softDelete == 0 {
+		return
+	}
+	now := c.clock()
+	for k, deleted := range c.tombstones {
+		if now.Sub(deleted) > c.softDelete {
+			delete(c.tombstones, k)
+		}
+	}
+}
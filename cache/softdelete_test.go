@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheSoftDelete(t *testing.T) {
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	a := New(WithSoftDelete[string, string](time.Minute))
+	a.clock = clock
+	b := New(WithSoftDelete[string, string](time.Minute))
+	b.clock = clock
+
+	a.Put("k", "v")
+	b.Put("k", "v")
+	b.Put("x", "x")
+
+	// delete on replica A, then merge B into A: the key must stay deleted
+	now = now.Add(time.Second)
+	a.Delete("k")
+	a.Merge(b)
+	_, ok := a.Get("k")
+	assert.Equal(t, ok, false, "The soft-deleted value should not be resurrected.")
+	_, ok = a.Get("x")
+	assert.Equal(t, ok, true, "The other values should be merged.")
+
+	// merging A into B propagates the deletion
+	b.Merge(a)
+	_, ok = b.Get("k")
+	assert.Equal(t, ok, false, "The tombstone should have been applied.")
+
+	// a value written after the tombstone wins
+	now = now.Add(time.Second)
+	b.Put("k", "new")
+	a.Merge(b)
+	v, ok := a.Get("k")
+	assert.Equal(t, ok, true, "A newer value should override the tombstone.")
+	assert.Equal(t, v, "new", "The value should be as expected.")
+
+	// tombstones are garbage-collected after the TTL
+	a.Delete("k")
+	assert.Len(t, a.tombstones, 1, "The tombstone should be present.")
+	now = now.Add(2 * time.Minute)
+	a.Delete("<not present>")
+	assert.Len(t, a.tombstones, 0, "The tombstone should have been collected.")
+}
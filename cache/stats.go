@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats reports how many Gets found the key in the Cache (Hits) and how many
+// did not (Misses), not counting values provided by the loader, how many
+// elements were stored (Puts) and removed (Deletes), e.g. deleted or purged
+// once expired, and how many were evicted instead (Evictions), e.g. to make
+// room for new ones; loading the Cache from persistent storage does not
+// count.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Puts      int64
+	Deletes   int64
+	Evictions int64
+}
+
+// Stats returns a snapshot of the access statistics of the Cache since its
+// creation or the last call to ResetStats; reading them does not contend
+// with accesses to the Cache.
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:      c.hits.hits.Load(),
+		Misses:    c.hits.misses.Load(),
+		Puts:      c.stats.puts.Load(),
+		Deletes:   c.stats.deletes.Load(),
+		Evictions: c.stats.evictions.Load(),
+	}
+}
+
+// ResetStats zeroes the access statistics, including those HitRatio is
+// computed from.
+func (c *Cache[K, V]) ResetStats() {
+	c.hits.hits.Store(0)
+	c.hits.misses.Store(0)
+	c.stats.puts.Store(0)
+	c.stats.deletes.Store(0)
+	c.stats.evictions.Store(0)
+}
+
+// accessStats holds the access counters, other than hits and misses.
+type accessStats struct {
+	puts      atomic.Int64
+	deletes   atomic.Int64
+	evictions atomic.Int64
+}
+
+// PersistenceStats reports how many times the Cache contents have been
+// encoded and written to persistent storage, how many of those attempts
+// failed and how long they took overall; when the encoding streams straight
+// into the persistence, each flush counts as both an encode and a write,
+// and its whole duration is accounted to the write.
+type PersistenceStats struct {
+	Encodes      int64
+	EncodeErrors int64
+	EncodeTime   time.Duration
+	Writes       int64
+	WriteErrors  int64
+	WriteTime    time.Duration
+}
+
+// AverageEncodeTime returns the average duration of an encode.
+func (s PersistenceStats) AverageEncodeTime() time.Duration {
+	if s.Encodes == 0 {
+		return 0
+	}
+	return s.EncodeTime / time.Duration(s.Encodes)
+}
+
+// AverageWriteTime returns the average duration of a write.
+func (s PersistenceStats) AverageWriteTime() time.Duration {
+	if s.Writes == 0 {
+		return 0
+	}
+	return s.WriteTime / time.Duration(s.Writes)
+}
+
+// PersistenceStats returns a snapshot of the persistence statistics, to
+// tell whether encoding or I/O dominates the time spent flushing.
+func (c *Cache[K, V]) PersistenceStats() PersistenceStats {
+	return PersistenceStats{
+		Encodes:      c.pstats.encodes.Load(),
+		EncodeErrors: c.pstats.encodeErrors.Load(),
+		EncodeTime:   time.Duration(c.pstats.encodeTime.Load()),
+		Writes:       c.pstats.writes.Load(),
+		WriteErrors:  c.pstats.writeErrors.Load(),
+		WriteTime:    time.Duration(c.pstats.writeTime.Load()),
+	}
+}
+
+// persistenceStats holds the persistence counters.
+type persistenceStats struct {
+	encodes      atomic.Int64
+	encodeErrors atomic.Int64
+	encodeTime   atomic.Int64
+	writes       atomic.Int64
+	writeErrors  atomic.Int64
+	writeTime    atomic.Int64
+}
+
+// encoded records an encode.
+func (s *persistenceStats) encoded(d time.Duration, err error) {
+	s.encodes.Add(1)
+	s.encodeTime.Add(int64(d))
+	if err != nil {
+		s.encodeErrors.Add(1)
+	}
+}
+
+// written records a write.
+func (s *persistenceStats) written(d time.Duration, err error) {
+	s.writes.Add(1)
+	s.writeTime.Add(int64(d))
+	if err != nil {
+		s.writeErrors.Add(1)
+	}
+}
+
+// streamed records an encode streamed into a write.
+func (s *persistenceStats) streamed(d time.Duration, err error) {
+	s.encoded(0, nil)
+	s.written(d, err)
+}
+
+// FlushStatus reports the outcome of the latest attempts to write the Cache
+// contents to persistent storage.
+type FlushStatus struct {
+	// LastFlush is the time of the latest successful write.
+	LastFlush time.Time
+	// LastError is the error of the latest write, if it failed.
+	LastError error
+	// ConsecutiveFailures is the number of writes that failed in a row.
+	ConsecutiveFailures int
+}
+
+// FlushStatus returns the outcome of the latest writes to persistent
+// storage, e.g. to report the health of the Cache.
+func (c *Cache[K, V]) FlushStatus() FlushStatus {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+	return FlushStatus{
+		LastFlush:           c.lastFlush,
+		LastError:           c.lastFlushErr,
+		ConsecutiveFailures: c.flushFailures,
+	}
+}
+
+// flushAttempted records the outcome of a write to persistent storage.
+func (c *Cache[K, V]) flushAttempted(err error) {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+	c.lastFlushErr = err
+	if err != nil {
+		c.flushFailures++
+		return
+	}
+	c.lastFlush = c.clock()
+	c.flushFailures = 0
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePersistenceStats(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&YAML[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+	)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		cache.Put(k, k+k+k)
+	}
+	stats := cache.PersistenceStats()
+	assert.Equal(t, stats.Encodes, int64(5), "There should be one encode per flush.")
+	assert.Equal(t, stats.Writes, int64(5), "There should be one write per flush.")
+	assert.Equal(t, stats.EncodeErrors, int64(0), "There should be no encode errors.")
+	assert.Equal(t, stats.WriteErrors, int64(0), "There should be no write errors.")
+	assert.Greater(t, stats.EncodeTime, time.Duration(0), "The encode time should have been measured.")
+	assert.Equal(t, stats.AverageEncodeTime(), stats.EncodeTime/5, "The average encode time is invalid.")
+	assert.Equal(t, stats.AverageWriteTime(), stats.WriteTime/5, "The average write time is invalid.")
+
+	persistence.err = errors.New("backend down")
+	cache.Put("f", "fff")
+	stats = cache.PersistenceStats()
+	assert.Equal(t, stats.Writes, int64(6), "The failed write should be counted.")
+	assert.Equal(t, stats.WriteErrors, int64(1), "The write error should be counted.")
+
+	// streaming flushes count as both
+	streaming := New(
+		WithPersistence[string, string](&File{Path: filepath.Join(t.TempDir(), "test.json")}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	streaming.Put("a", "aaa")
+	streaming.Store()
+	stats = streaming.PersistenceStats()
+	assert.Equal(t, stats.Encodes, int64(1), "The streamed flush should count as an encode.")
+	assert.Equal(t, stats.Writes, int64(1), "The streamed flush should count as a write.")
+	assert.Equal(t, (PersistenceStats{}).AverageWriteTime(), time.Duration(0), "The average of nothing should be zero.")
+}
+
+func TestCacheFlushStatus(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithPolicy[string, string](&Always{}),
+	)
+	cache.clock = func() time.Time { return now }
+	assert.Equal(t, cache.FlushStatus(), FlushStatus{}, "Nothing should have been flushed yet.")
+
+	cache.Put("a", "aaa")
+	assert.Equal(t, cache.FlushStatus(), FlushStatus{LastFlush: now}, "The flush should be recorded.")
+
+	persistence.err = errors.New("disk full")
+	cache.Put("b", "bbb")
+	cache.Put("c", "ccc")
+	status := cache.FlushStatus()
+	assert.Equal(t, status.LastFlush, now, "The last successful flush should be kept.")
+	assert.EqualError(t, status.LastError, "disk full", "The error should be recorded.")
+	assert.Equal(t, status.ConsecutiveFailures, 2, "The failures should be counted.")
+
+	assert.NoError(t, cache.Ping(), "Persistences that cannot be pinged should be deemed reachable.")
+	assert.NoError(t, (&File{Path: filepath.Join(t.TempDir(), "test.json")}).Ping(), "An existing directory should be reachable.")
+	assert.Error(t, (&File{Path: filepath.Join(t.TempDir(), "missing", "test.json")}).Ping(), "A missing directory should be unreachable.")
+}
+
+func TestCacheStats(t *testing.T) {
+
+	cache := New(WithMaxEntries[string, int](2))
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("a", 10)
+	cache.Replace("b", 20)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("missing")
+	cache.Put("c", 3)
+	cache.Delete("c")
+	cache.Delete("missing")
+	assert.Equal(t, cache.Stats(), Stats{Hits: 2, Misses: 1, Puts: 4, Deletes: 1, Evictions: 1}, "The statistics are invalid.")
+
+	cache.ResetStats()
+	assert.Equal(t, cache.Stats(), Stats{}, "The statistics should have been reset.")
+	cache.Get("a")
+	assert.Equal(t, cache.Stats(), Stats{Hits: 1}, "The statistics should count again after a reset.")
+}
@@ -0,0 +1,134 @@
+package cache
+
+// Store is the in-memory storage backing a Cache; implementations need not
+// be safe for concurrent use, since the Cache serialises all accesses under
+// its own lock. A Store can optionally implement Clear() to drop all its
+// elements at once and Shrink() to release unused memory.
+type Store[K comparable, V any] interface {
+	// Get returns the value associated with the key and whether it exists.
+	Get(k K) (V, bool)
+	// Set associates the value with the key.
+	Set(k K, v V)
+	// Delete removes the key and its value.
+	Delete(k K)
+	// Range calls fn for each element, stopping when it returns false.
+	Range(fn func(k K, v V) bool)
+	// Len returns the number of elements.
+	Len() int
+}
+
+// WithStore applies the store option to the Cache, replacing the default
+// Go map with a different in-memory storage implementation.
+func WithStore[K comparable, V any](s Store[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if s != nil {
+			c.store = s
+		}
+	}
+}
+
+// mapStore is the default Store, backed by a plain Go map.
+type mapStore[K comparable, V any] struct {
+	data map[K]V
+}
+
+// newMapStore creates a mapStore holding the given map, or an empty one.
+func newMapStore[K comparable, V any](data map[K]V) *mapStore[K, V] {
+	if data == nil {
+		data = map[K]V{}
+	}
+	return &mapStore[K, V]{data: data}
+}
+
+// Get returns the value associated with the key and whether it exists.
+func (m *mapStore[K, V]) Get(k K) (V, bool) {
+	v, ok := m.data[k]
+	return v, ok
+}
+
+// Set associates the value with the key.
+func (m *mapStore[K, V]) Set(k K, v V) {
+	m.data[k] = v
+}
+
+// Delete removes the key and its value.
+func (m *mapStore[K, V]) Delete(k K) {
+	delete(m.data, k)
+}
+
+// Range calls fn for each element, stopping when it returns false.
+func (m *mapStore[K, V]) Range(fn func(k K, v V) bool) {
+	for k, v := range m.data {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Len returns the number of elements.
+func (m *mapStore[K, V]) Len() int {
+	return len(m.data)
+}
+
+// Clear drops all the elements.
+func (m *mapStore[K, V]) Clear() {
+	m.data = map[K]V{}
+}
+
+// Shrink rebuilds the underlying map at its current size.
+func (m *mapStore[K, V]) Shrink() {
+	data := make(map[K]V, len(m.data))
+	for k, v := range m.data {
+		data[k] = v
+	}
+	m.data = data
+}
+
+// snapshotNoLock returns the contents of the store as a map, leaving out the
+// expired elements, without copying it when using the default Store and no
+// element has an expiry; the result must not be modified and must only be
+// used while holding the lock.
+func (c *Cache[K, V]) snapshotNoLock() map[K]V {
+	if m, ok := c.store.(*mapStore[K, V]); ok {
+		return c.unexpiredNoLock(m.data)
+	}
+	now := c.clock()
+	data := make(map[K]V, c.store.Len())
+	c.store.Range(func(k K, v V) bool {
+		if !c.expiredNoLock(k, now) {
+			data[k] = v
+		}
+		return true
+	})
+	return data
+}
+
+// resetNoLock replaces the contents of the store with the given map; it
+// must be called with the write lock held.
+func (c *Cache[K, V]) resetNoLock(data map[K]V) {
+	if m, ok := c.store.(*mapStore[K, V]); ok {
+		m.data = data
+		return
+	}
+	c.clearNoLock()
+	for k, v := range data {
+		c.store.Set(k, v)
+	}
+}
+
+// clearNoLock drops all the elements in the store; it must be called with
+// the write lock held.
+func (c *Cache[K, V]) clearNoLock() {
+	if s, ok := c.store.(interface{ Clear() }); ok {
+		s.Clear()
+		return
+	}
+	keys := make([]K, 0, c.store.Len())
+	c.store.Range(func(k K, _ V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	for _, k := range keys {
+		c.store.Delete(k)
+	}
+}
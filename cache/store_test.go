@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceStore is a Store keeping its elements in a sorted slice.
+type sliceStore struct {
+	keys   []string
+	values []string
+	calls  int
+}
+
+func (s *sliceStore) find(k string) (int, bool) {
+	i := sort.SearchStrings(s.keys, k)
+	return i, i < len(s.keys) && s.keys[i] == k
+}
+
+func (s *sliceStore) Get(k string) (string, bool) {
+	s.calls++
+	if i, ok := s.find(k); ok {
+		return s.values[i], true
+	}
+	return "", false
+}
+
+func (s *sliceStore) Set(k string, v string) {
+	s.calls++
+	i, ok := s.find(k)
+	if ok {
+		s.values[i] = v
+		return
+	}
+	s.keys = append(s.keys[:i], append([]string{k}, s.keys[i:]...)...)
+	s.values = append(s.values[:i], append([]string{v}, s.values[i:]...)...)
+}
+
+func (s *sliceStore) Delete(k string) {
+	s.calls++
+	if i, ok := s.find(k); ok {
+		s.keys = append(s.keys[:i], s.keys[i+1:]...)
+		s.values = append(s.values[:i], s.values[i+1:]...)
+	}
+}
+
+func (s *sliceStore) Range(fn func(k string, v string) bool) {
+	s.calls++
+	for i := range s.keys {
+		if !fn(s.keys[i], s.values[i]) {
+			return
+		}
+	}
+}
+
+func (s *sliceStore) Len() int {
+	return len(s.keys)
+}
+
+func TestCacheStore(t *testing.T) {
+
+	store := &sliceStore{}
+	cache := New(
+		WithStore[string, string](store),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPersistence[string, string](&File{Path: t.TempDir() + "/test.json"}),
+	)
+
+	cache.Put("c", "ccc")
+	cache.Put("a", "aaa")
+	cache.Replace("b", "bbb")
+	assert.Equal(t, store.keys, []string{"a", "b", "c"}, "The values should be held by the custom store.")
+	assert.Equal(t, cache.Size(), 3, "The cache size is invalid.")
+	assert.ElementsMatch(t, cache.Keys(), []string{"a", "b", "c"}, "The key set is invalid.")
+
+	v, ok := cache.Get("b")
+	assert.Equal(t, ok, true, "The value should be present in the cache.")
+	assert.Equal(t, v, "bbb", "The value should be as expected.")
+
+	cache.Delete("b")
+	assert.Equal(t, store.keys, []string{"a", "c"}, "The value should have been removed from the custom store.")
+
+	// loading goes through the store too
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+	cache.Clear()
+	assert.Equal(t, store.Len(), 0, "The custom store should be empty.")
+	assert.NoError(t, cache.Load(), "Loading should succeed.")
+	assert.Equal(t, store.keys, []string{"a", "c"}, "The values should have been loaded into the custom store.")
+	assert.Greater(t, store.calls, 0, "The cache should route through the custom store.")
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+)
+
+// Entry is a key/value pair in the Cache.
+type Entry[K comparable, V any] struct {
+	Key   K `json:"key" yaml:"key" toml:"key"`
+	Value V `json:"value" yaml:"value" toml:"value"`
+}
+
+// streamChunk is the number of values fetched from the store each time the
+// read lock is taken while streaming entries.
+const streamChunk = 256
+
+// StreamKeys returns a channel yielding the keys in the Cache at the time of
+// the call; the channel is closed when all keys have been yielded or when
+// the context is cancelled, whichever comes first.
+func (c *Cache[K, V]) StreamKeys(ctx context.Context) <-chan K {
+	keys := c.Keys()
+	out := make(chan K)
+	go func() {
+		defer close(out)
+		for _, k := range keys {
+			select {
+			case out <- k:
+			case <-ctx.Done():
+				if c.logger != nil {
+					c.logger.Debug("keys streaming cancelled", "error", ctx.Err())
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// StreamEntries returns a channel yielding the entries in the Cache; the set
+// of keys is snapshotted at the time of the call, whereas values are fetched
+// in chunks as the entries are consumed, so the lock is never held for the
+// whole drain and entries deleted, or expired, in the meantime are skipped. The channel is
+// closed when all entries have been yielded or when the context is cancelled,
+// whichever comes first.
+func (c *Cache[K, V]) StreamEntries(ctx context.Context) <-chan Entry[K, V] {
+	keys := c.Keys()
+	out := make(chan Entry[K, V])
+	go func() {
+		defer close(out)
+		chunk := make([]Entry[K, V], 0, streamChunk)
+		for len(keys) > 0 {
+			n := streamChunk
+			if n > len(keys) {
+				n = len(keys)
+			}
+			chunk = chunk[:0]
+			c.lock.RLock()
+			now := c.clock()
+			for _, k := range keys[:n] {
+				if v, ok := c.store.Get(k); ok && !c.expiredNoLock(k, now) {
+					chunk = append(chunk, Entry[K, V]{Key: k, Value: v})
+				}
+			}
+			c.lock.RUnlock()
+			keys = keys[n:]
+			for _, e := range chunk {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					if c.logger != nil {
+						c.logger.Debug("entries streaming cancelled", "error", ctx.Err())
+					}
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheStream(t *testing.T) {
+
+	cache := New[int, int]()
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, i*2)
+	}
+
+	keys := []int{}
+	for k := range cache.StreamKeys(context.Background()) {
+		keys = append(keys, k)
+	}
+	assert.ElementsMatch(t, keys, cache.Keys(), "The streamed key set is invalid.")
+
+	count := 0
+	for e := range cache.StreamEntries(context.Background()) {
+		assert.Equal(t, e.Value, e.Key*2, "The streamed value is invalid.")
+		count++
+	}
+	assert.Equal(t, count, 1000, "The number of streamed entries is invalid.")
+
+	// early cancellation stops production without leaking goroutines
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	entries := cache.StreamEntries(ctx)
+	keystream := cache.StreamKeys(ctx)
+	<-entries
+	<-keystream
+	cancel()
+	for range entries {
+	}
+	for range keystream {
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "The streaming goroutines should have exited.")
+}
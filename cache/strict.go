@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLoadFailed is returned when a Cache with strict load refuses to write
+// to persistent storage because the last Load failed.
+var ErrLoadFailed = errors.New("refusing to persist after a failed load")
+
+// ErrTooManyEntries is returned by Load when the data read back holds more
+// entries than allowed by WithMaxDecodedEntries.
+var ErrTooManyEntries = errors.New("too many entries")
+
+// WithMaxDecodedEntries applies the maximum decoded entries option to the
+// Cache, so that Load fails with ErrTooManyEntries, leaving the Cache
+// untouched, whenever the data read back holds more than n entries; this
+// hardens caches loading data from untrusted sources. With an
+// ItemPersistence the limit is checked before decoding the elements.
+func WithMaxDecodedEntries[K comparable, V any](n int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if n > 0 {
+			c.maxDecoded = n
+		}
+	}
+}
+
+// checkDecoded returns an error if the given number of entries exceeds the
+// maximum allowed.
+func (c *Cache[K, V]) checkDecoded(n int) error {
+	if c.maxDecoded > 0 && n > c.maxDecoded {
+		if c.logger != nil {
+			c.logger.Error("too many entries in cache data", "entries", n, "max", c.maxDecoded)
+		}
+		return fmt.Errorf("%w: %d, at most %d allowed", ErrTooManyEntries, n, c.maxDecoded)
+	}
+	return nil
+}
+
+// WithStrictLoad applies the strict load option to the Cache, which fails
+// closed whenever Load fails: the contents of the Cache are left untouched
+// (as they always are) and, until a Load succeeds, the policy no longer
+// triggers writes to persistent storage, so that data which could not be
+// decoded is not overwritten by an application that ignored the error.
+// Explicit calls to Store() are still honoured.
+func WithStrictLoad[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.strictLoad = true
+	}
+}
+
+// MustLoad is like Load but panics if the cache cannot be loaded.
+func (c *Cache[K, V]) MustLoad() {
+	if err := c.Load(); err != nil {
+		panic(fmt.Sprintf("cache: loading failed: %v", err))
+	}
+}
+
+// blockedNoLock returns whether strict load applies and the last Load
+// failed, so that the policy must not trigger any write.
+func (c *Cache[K, V]) blockedNoLock() bool {
+	return c.strictLoad && c.loadFailed.Load()
+}
+
+// autoWriteNoLock writes the cache to persistent storage on the Cache's own
+// initiative rather than on an explicit Store: scheduled saves, deferred
+// flushes, circuit breaker probes and the final flush on Close all go
+// through it, so that none of them overwrites the data after a failed
+// strict load. It must be called with the lock held.
+func (c *Cache[K, V]) autoWriteNoLock() error {
+	if c.blockedNoLock() {
+		if c.logger != nil {
+			c.logger.Debug("strict load, not writing after a failed load")
+		}
+		c.dirty.Store(true)
+		return ErrLoadFailed
+	}
+	return c.writeNoLock()
+}
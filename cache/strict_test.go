@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheStrictLoad(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithStrictLoad[string, string](),
+	)
+	cache.Put("a", "aaa")
+	cache.Put("b", "bbb")
+
+	corrupt := []byte(`{"c": "ccc", "d": `)
+	os.WriteFile(path, corrupt, 0644)
+	assert.Error(t, cache.Load(), "Loading a corrupt file should fail.")
+	assert.Equal(t, cache.Size(), 2, "The existing contents should be left intact.")
+	v, _ := cache.Get("a")
+	assert.Equal(t, v, "aaa", "The existing contents should be left intact.")
+	_, ok := cache.Get("c")
+	assert.False(t, ok, "No partially decoded data should be in the cache.")
+	assert.Panics(t, cache.MustLoad, "MustLoad should panic on a corrupt file.")
+
+	// the policy does not overwrite the file after a failed load
+	cache.Put("e", "eee")
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, data, corrupt, "The corrupt file should not have been overwritten.")
+
+	// an explicit store is honoured and a successful load lifts the block
+	assert.NoError(t, cache.Store(), "Explicit stores should be honoured.")
+	assert.NotPanics(t, cache.MustLoad, "MustLoad should not panic on a valid file.")
+	cache.Put("f", "fff")
+	restored := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	restored.Load()
+	assert.True(t, Equal(cache, restored, Eq[string]), "Writes should resume after a successful load.")
+}
+
+func TestCacheStrictLoadNoData(t *testing.T) {
+
+	persistence := &File{Path: filepath.Join(t.TempDir(), "test.json")}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithStrictLoad[string, string](),
+	)
+	assert.ErrorIs(t, cache.Load(), ErrNoData, "Loading a missing file should report no data.")
+	cache.Put("a", "aaa")
+	_, err := persistence.Read()
+	assert.NoError(t, err, "With no data to protect, writes should not be blocked.")
+}
+
+func TestCacheMaxDecodedEntries(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.json")
+	os.WriteFile(path, []byte(`{"a": "aaa", "b": "bbb", "c": "ccc"}`), 0644)
+
+	cache := New(
+		WithPersistence[string, string](&File{Path: path}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithMaxDecodedEntries[string, string](2),
+	)
+	cache.Put("z", "zzz")
+	assert.ErrorIs(t, cache.Load(), ErrTooManyEntries, "Loading too many entries should fail.")
+	assert.Equal(t, cache.Keys(), []string{"z"}, "The cache should not have been populated.")
+
+	os.WriteFile(path, []byte(`{"a": "aaa", "b": "bbb"}`), 0644)
+	assert.NoError(t, cache.Load(), "Loading up to the limit should succeed.")
+	assert.Equal(t, cache.Size(), 2, "The cache should have been populated.")
+
+	persistence := &items{data: map[string][]byte{"a": []byte(`{"a": "aaa"}`), "b": []byte(`not decoded`), "c": nil}}
+	itemised := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithDirtyKeyTracking[string, string](),
+		WithMaxDecodedEntries[string, string](2),
+	)
+	assert.ErrorIs(t, itemised.Load(), ErrTooManyEntries, "Too many elements should be rejected before decoding.")
+}
+
+func TestCacheStrictLoadUnattendedWrites(t *testing.T) {
+
+	corrupt := []byte(`{"c": "ccc", "d": `)
+
+	// scheduled saves
+	persistence := &memory{data: corrupt}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Never{}),
+		WithStrictLoad[string, string](),
+	)
+	assert.Error(t, cache.Load(), "Loading corrupt data should fail.")
+	stop := cache.SaveEvery(5 * time.Millisecond)
+	cache.Put("a", "aaa")
+	time.Sleep(30 * time.Millisecond)
+	stop()
+	assert.Equal(t, persistence.Writes(), 0, "Scheduled saves should not overwrite the data.")
+
+	// deferred flushes
+	persistence = &memory{data: corrupt}
+	cache = New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithDeadlineAwareFlush[string, string](20*time.Millisecond),
+		WithStrictLoad[string, string](),
+	)
+	cache.Put("a", "aaa")
+	assert.Error(t, cache.Load(), "Loading corrupt data should fail.")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 0, "Deferred flushes should not overwrite the data.")
+
+	// flushes on idle
+	persistence = &memory{data: corrupt}
+	cache = New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithDeadlineAwareFlush[string, string](time.Hour),
+		WithStrictLoad[string, string](),
+	)
+	cache.Put("a", "aaa")
+	assert.Error(t, cache.Load(), "Loading corrupt data should fail.")
+	assert.ErrorIs(t, cache.SignalIdle(), ErrLoadFailed, "Flushing on idle should report the failed load.")
+	assert.Equal(t, persistence.Writes(), 0, "Flushing on idle should not overwrite the data.")
+
+	// circuit breaker probes
+	persistence = &memory{err: errors.New("backend down")}
+	cache = New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&JSON[string, string]{}),
+		WithPolicy[string, string](&Always{}),
+		WithCircuitBreaker[string, string](1, 10*time.Millisecond),
+		WithStrictLoad[string, string](),
+	)
+	cache.Put("a", "aaa")
+	assert.Equal(t, cache.Breaker(), BreakerOpen, "The breaker should have opened.")
+	assert.Error(t, cache.Load(), "Loading from a failing backend should fail.")
+	persistence.lock.Lock()
+	persistence.err, persistence.data = nil, corrupt
+	persistence.lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, persistence.Writes(), 0, "Probes should not overwrite the data.")
+	assert.Equal(t, cache.Breaker(), BreakerOpen, "The breaker should stay open.")
+	cache.Close()
+}
+
+func TestCacheSaveEveryInvalidInterval(t *testing.T) {
+
+	cache := New[string, string]()
+	for _, interval := range []time.Duration{0, -time.Second} {
+		var stop func()
+		assert.NotPanics(t, func() { stop = cache.SaveEvery(interval) }, "A non-positive interval should not panic.")
+		assert.NotPanics(t, stop, "Stopping should be a no-op.")
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+// WithLoadTransform applies the load transform option to the Cache: every
+// element read back by Load is passed through fn, which returns the value to
+// store in its place or false to drop the element, e.g. to migrate values
+// whose meaning changed without touching the encoding.
+func WithLoadTransform[K comparable, V any](fn func(k K, v V) (V, bool)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.loadTransform = fn
+		}
+	}
+}
+
+// WithStoreTransform applies the store transform option to the Cache: every
+// element written to persistent storage is first passed through fn, which
+// returns the value to write in its place or false to leave the element out;
+// the elements in the Cache are not affected.
+func WithStoreTransform[K comparable, V any](fn func(k K, v V) (V, bool)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.storeTransform = fn
+		}
+	}
+}
+
+// transform passes all the elements through the given transform, if any,
+// returning a new map with the results.
+func transform[K comparable, V any](data map[K]V, fn func(k K, v V) (V, bool)) map[K]V {
+	if fn == nil {
+		return data
+	}
+	transformed := make(map[K]V, len(data))
+	for k, v := range data {
+		if v, ok := fn(k, v); ok {
+			transformed[k] = v
+		}
+	}
+	return transformed
+}
+
+// persistedNoLock returns the contents of the store as they must be
+// written to persistent storage, leaving out the expired elements; like
+// snapshotNoLock, the result must not be modified and must only be used
+// while holding the lock.
+func (c *Cache[K, V]) persistedNoLock() map[K]V {
+	return transform(c.snapshotNoLock(), c.storeTransform)
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTransforms(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		// persist seconds as milliseconds, leaving out negative values
+		WithStoreTransform(func(k string, v int) (int, bool) {
+			return v * 1000, v >= 0
+		}),
+	)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("c", -1)
+	assert.NoError(t, cache.Store(), "Storing the cache should not fail.")
+	assert.JSONEq(t, string(persistence.data), `{"a": 1000, "b": 2000}`, "The store transform should have been applied.")
+	v, _ := cache.Get("a")
+	assert.Equal(t, v, 1, "The cache contents should not be affected.")
+
+	restored := New(
+		WithPersistence[string, int](persistence),
+		WithEncoding[string, int](&JSON[string, int]{}),
+		// double the values, dropping the "b" entry
+		WithLoadTransform(func(k string, v int) (int, bool) {
+			return v * 2, k != "b"
+		}),
+	)
+	assert.NoError(t, restored.Load(), "Loading the cache should not fail.")
+	assert.Equal(t, restored.Keys(), []string{"a"}, "The dropped entry should not have been loaded.")
+	v, _ = restored.Get("a")
+	assert.Equal(t, v, 2000, "The load transform should have been applied.")
+}
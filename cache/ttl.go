@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"time"
+)
+
+// WithExpirationInterval applies the expiration sweeper option to the Cache,
+// which then starts a goroutine purging the expired elements every interval,
+// until the Cache is closed (see Close); without it, expired elements are
+// only purged as they are looked up.
+func WithExpirationInterval[K comparable, V any](interval time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if interval > 0 {
+			c.sweepInterval = interval
+		}
+	}
+}
+
+// WithTTLFunc applies the computed TTL option to the Cache: whenever an
+// element is written, by Put, Replace and their variants as well as by the
+// loader or a computation, it expires after the TTL returned by the given
+// function for its key and value (see PutWithTTL), unless a TTL is given
+// explicitly, as with PutWithTTL; a TTL that is not positive means no
+// expiry.
+func WithTTLFunc[K comparable, V any](fn func(k K, v V) time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if fn != nil {
+			c.ttlFunc = fn
+		}
+	}
+}
+
+// WithTTLResolution applies the TTL resolution option to the Cache, which
+// then rounds the expiry times of its elements up to a multiple of the given
+// resolution, so that elements put around the same time expire together,
+// e.g. to let the sweeper (see WithExpirationInterval) purge them in batches;
+// elements never expire before their TTL.
+func WithTTLResolution[K comparable, V any](resolution time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		if resolution > 0 {
+			c.ttlResolution = resolution
+		}
+	}
+}
+
+// PutWithTTL is like Put, but the element expires after the given TTL, after
+// which Get treats it as absent and purges it, and Put replaces it; expired
+// elements are not persisted either, but they are still counted by e.g. Size
+// and Keys until purged, either on lookup or by the sweeper (see
+// WithExpirationInterval). The expiry times are persisted inside the encoded
+// data by encodings implementing ExpiringEncoding, as all the built-in ones
+// do; with any other encoding, elements with an expiry are not persisted at
+// all. A TTL that is not positive means no
+// expiry; putting an element in any other way clears its expiry, or sets the
+// one computed by the function given with WithTTLFunc. Like Put, a
+// read-only Cache stores nothing and returns false.
+func (c *Cache[K, V]) PutWithTTL(k K, v V, ttl time.Duration) bool {
+	defer c.timed("put")()
+	if c.logger != nil {
+		c.logger.Debug("putting value into cache with TTL", "key", k, "value", v, "ttl", ttl)
+	}
+	stored := false
+	defer c.putted(k, v, &stored)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		return false
+	}
+	if _, ok := c.liveNoLock(k); ok {
+		return false
+	}
+	c.setNoLock(k, v)
+	c.expireNoLock(k, ttl)
+	stored = true
+	c.storeNoLock(false)
+	return true
+}
+
+// ReplaceWithTTL is like Replace, but the element expires after the given
+// TTL, after which it is treated as absent; an expired element is reported
+// as not present. A TTL that is not positive means no expiry. Like Replace,
+// a read-only Cache stores nothing and reports no previous element.
+func (c *Cache[K, V]) ReplaceWithTTL(k K, v V, ttl time.Duration) (V, bool) {
+	defer c.timed("replace")()
+	if c.logger != nil {
+		c.logger.Debug("putting value into cache with TTL", "key", k, "value", v, "ttl", ttl)
+	}
+	stored := false
+	defer c.putted(k, v, &stored)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rejected() {
+		var zero V
+		return zero, false
+	}
+	old, ok := c.liveNoLock(k)
+	c.setNoLock(k, v)
+	c.expireNoLock(k, ttl)
+	stored = true
+	c.storeNoLock(false)
+	return old, ok
+}
+
+// Expiry returns when the element under the given key expires, and whether
+// it has an expiry at all.
+func (c *Cache[K, V]) Expiry(k K) (time.Time, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	t, ok := c.expiries[k]
+	return t, ok
+}
+
+// expireNoLock sets the expiry of the element under the given key, which
+// has just been written, or clears it if the TTL is not positive; it must be
+// called with the write lock held.
+func (c *Cache[K, V]) expireNoLock(k K, ttl time.Duration) {
+	if ttl <= 0 {
+		delete(c.expiries, k)
+		return
+	}
+	t := c.clock().Add(ttl)
+	if c.ttlResolution > 0 {
+		if rounded := t.Truncate(c.ttlResolution); rounded.Before(t) {
+			t = rounded.Add(c.ttlResolution)
+		}
+	}
+	c.expireAtNoLock(k, t)
+}
+
+// expireAtNoLock sets the expiry time of the element under the given key; it
+// must be called with the write lock held.
+func (c *Cache[K, V]) expireAtNoLock(k K, t time.Time) {
+	if c.expiries == nil {
+		c.expiries = map[K]time.Time{}
+	}
+	c.expiries[k] = t
+}
+
+// liveNoLock returns the element under the given key and whether it is in
+// the Cache, like Get and Contains do: an expired element is removed first,
+// and reported as absent; it must be called with the write lock held.
+func (c *Cache[K, V]) liveNoLock(k K) (V, bool) {
+	v, ok := c.store.Get(k)
+	if ok && c.expiredNoLock(k, c.clock()) {
+		if c.logger != nil {
+			c.logger.Debug("purging expired value", "key", k)
+		}
+		c.deleteNoLock(k)
+		var zero V
+		return zero, false
+	}
+	return v, ok
+}
+
+// expiredNoLock returns whether the element under the given key has expired
+// at the given time; it must be called with at least the read lock held.
+func (c *Cache[K, V]) expiredNoLock(k K, now time.Time) bool {
+	t, ok := c.expiries[k]
+	return ok && !now.Before(t)
+}
+
+// purge removes the element under the given key if it has expired.
+func (c *Cache[K, V]) purge(k K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.store.Get(k); ok && c.expiredNoLock(k, c.clock()) {
+		if c.logger != nil {
+			c.logger.Debug("purging expired value", "key", k)
+		}
+		c.deleteNoLock(k)
+		c.storeNoLock(false)
+	}
+}
+
+// sweep purges all the expired elements.
+func (c *Cache[K, V]) sweep() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.clock()
+	expired := []K{}
+	for k := range c.expiries {
+		if c.expiredNoLock(k, now) {
+			expired = append(expired, k)
+		}
+	}
+	for _, k := range expired {
+		c.deleteNoLock(k)
+	}
+	if len(expired) > 0 {
+		if c.logger != nil {
+			c.logger.Debug("expired values purged", "count", len(expired))
+		}
+		c.storeNoLock(false)
+	}
+}
+
+// startSweeper starts the goroutine purging the expired elements, if the
+// expiration sweeper is enabled; it is stopped by Close.
+func (c *Cache[K, V]) startSweeper() {
+	if c.sweepInterval == 0 {
+		return
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(c.sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.sweep()
+			}
+		}
+	}()
+	c.onClose(func() {
+		close(done)
+		<-exited
+	})
+}
+
+// unexpiredNoLock returns the given data without the expired elements; it
+// must be called with at least the read lock held.
+func (c *Cache[K, V]) unexpiredNoLock(data map[K]V) map[K]V {
+	if len(c.expiries) == 0 {
+		return data
+	}
+	now := c.clock()
+	unexpired := make(map[K]V, len(data))
+	for k, v := range data {
+		if !c.expiredNoLock(k, now) {
+			unexpired[k] = v
+		}
+	}
+	return unexpired
+}
+
+// expiringNoLock returns the elements to write to persistent storage, and
+// the expiry times to write along with them; if the encoding cannot carry
+// expiry times (see ExpiringEncoding), the elements that have one are left
+// out instead, so that they do not come back with no expiry. Like
+// persistedNoLock, the elements must not be modified and must only be used
+// while holding the lock.
+func (c *Cache[K, V]) expiringNoLock() (map[K]V, map[K]time.Time) {
+	return c.expiringWithNoLock(c.encoding, c.persistedNoLock())
+}
+
+// expiringWithNoLock returns the given elements, and the expiry times to
+// encode along with them with the given encoding, like expiringNoLock does
+// for the Cache encoding; it must be called with at least the read lock
+// held.
+func (c *Cache[K, V]) expiringWithNoLock(e Encoding[K, V], data map[K]V) (map[K]V, map[K]time.Time) {
+	return c.expiringIfNoLock(canExpire(e), data)
+}
+
+// expiringIfNoLock returns the given elements, and their expiry times if
+// they are to be encoded along with them, or the elements that have none
+// otherwise; it must be called with at least the read lock held.
+func (c *Cache[K, V]) expiringIfNoLock(expiring bool, data map[K]V) (map[K]V, map[K]time.Time) {
+	if len(c.expiries) == 0 {
+		return data, nil
+	}
+	if expiring {
+		expiries := make(map[K]time.Time, len(c.expiries))
+		for k, t := range c.expiries {
+			if _, ok := data[k]; ok {
+				expiries[k] = t
+			}
+		}
+		return data, expiries
+	}
+	kept := make(map[K]V, len(data))
+	for k, v := range data {
+		if _, ok := c.expiries[k]; !ok {
+			kept[k] = v
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,348 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCacheTTL(t *testing.T) {
+
+	now := time.Now()
+	cache := New[string, string]()
+	cache.clock = func() time.Time { return now }
+
+	assert.True(t, cache.PutWithTTL("a", "aaa", time.Minute), "Putting with a TTL should succeed.")
+	assert.False(t, cache.PutWithTTL("a", "bbb", time.Minute), "Putting over an unexpired element should fail.")
+	cache.Put("b", "bbb")
+	expiry, ok := cache.Expiry("a")
+	assert.True(t, ok, "The element should have an expiry.")
+	assert.Equal(t, expiry, now.Add(time.Minute), "The expiry is invalid.")
+	_, ok = cache.Expiry("b")
+	assert.False(t, ok, "Elements put without a TTL should not expire.")
+
+	v, ok := cache.Get("a")
+	assert.True(t, ok, "Unexpired elements should be present.")
+	assert.Equal(t, v, "aaa", "The value is invalid.")
+
+	now = now.Add(2 * time.Minute)
+	_, ok, locked := cache.TryGet("a")
+	assert.True(t, locked, "The lock should have been acquired.")
+	assert.False(t, ok, "Expired elements should be absent when trying to get them.")
+	_, ok = cache.Get("a")
+	assert.False(t, ok, "Expired elements should be absent.")
+	assert.ElementsMatch(t, cache.Keys(), []string{"b"}, "Expired elements should be purged on lookup.")
+
+	assert.True(t, cache.PutWithTTL("c", "ccc", time.Minute), "Putting with a TTL should succeed.")
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.ReplaceWithTTL("c", "ddd", time.Minute)
+	assert.False(t, ok, "Replacing an expired element should report it as absent.")
+	cache.Replace("c", "eee")
+	_, ok = cache.Expiry("c")
+	assert.False(t, ok, "Replacing without a TTL should clear the expiry.")
+
+	assert.True(t, cache.PutWithTTL("d", "ddd", time.Minute), "Putting with a TTL should succeed.")
+	now = now.Add(2 * time.Minute)
+	assert.True(t, cache.Put("d", "fff"), "Putting over an expired element should succeed.")
+}
+
+func TestCacheTTLFunc(t *testing.T) {
+
+	now := time.Now()
+	cache := New(WithTTLFunc(func(k string, v int) time.Duration {
+		return time.Duration(v) * time.Minute
+	}))
+	cache.clock = func() time.Time { return now }
+
+	cache.Put("a", 1)
+	cache.Put("forever", 0)
+	cache.PutMany(map[string]int{"b": 2})
+	expiry, ok := cache.Expiry("a")
+	assert.True(t, ok, "Put elements should get the computed TTL.")
+	assert.Equal(t, expiry, now.Add(time.Minute), "The expiry is invalid.")
+	expiry, _ = cache.Expiry("b")
+	assert.Equal(t, expiry, now.Add(2*time.Minute), "The expiry is invalid.")
+	_, ok = cache.Expiry("forever")
+	assert.False(t, ok, "A TTL that is not positive should mean no expiry.")
+
+	cache.Replace("a", 3)
+	expiry, _ = cache.Expiry("a")
+	assert.Equal(t, expiry, now.Add(3*time.Minute), "Replaced elements should get the TTL computed for the new value.")
+	cache.Replace("forever", -1)
+	_, ok = cache.Expiry("forever")
+	assert.False(t, ok, "A TTL that is not positive should mean no expiry.")
+
+	cache.ReplaceWithTTL("a", 3, time.Hour)
+	expiry, _ = cache.Expiry("a")
+	assert.Equal(t, expiry, now.Add(time.Hour), "An explicit TTL should override the computed one.")
+	cache.ReplaceWithTTL("a", 3, 0)
+	_, ok = cache.Expiry("a")
+	assert.False(t, ok, "An explicit TTL that is not positive should mean no expiry.")
+
+	cache.Replace("b", 1)
+	now = now.Add(90 * time.Second)
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "Elements should expire after the computed TTL.")
+}
+
+func TestCacheTTLResolution(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	cache := New(WithTTLResolution[string, string](time.Minute))
+	cache.clock = func() time.Time { return now }
+
+	cache.PutWithTTL("a", "aaa", 30*time.Second)
+	cache.PutWithTTL("b", "bbb", 45*time.Second)
+	cache.PutWithTTL("c", "ccc", 50*time.Second)
+	for _, k := range []string{"a", "b"} {
+		expiry, _ := cache.Expiry(k)
+		assert.Equal(t, expiry, time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC), "The expiry should have been rounded up.")
+	}
+	expiry, _ := cache.Expiry("c")
+	assert.Equal(t, expiry, time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC), "Expiries on a multiple of the resolution should be kept.")
+
+	now = time.Date(2024, 1, 1, 12, 0, 59, 0, time.UTC)
+	_, ok := cache.Get("a")
+	assert.True(t, ok, "Elements should not expire before the rounded expiry.")
+	now = time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC)
+	_, ok = cache.Get("a")
+	assert.False(t, ok, "Elements should expire at the rounded expiry.")
+}
+
+func TestCacheTTLExpiredAbsent(t *testing.T) {
+
+	now := time.Now()
+	loads := []string{}
+	cache := New(WithLoader(func(k string) (string, bool, error) {
+		loads = append(loads, k)
+		return "loaded", true, nil
+	}))
+	cache.clock = func() time.Time { return now }
+	expire := func(keys ...string) {
+		for _, k := range keys {
+			cache.PutWithTTL(k, "old", time.Minute)
+		}
+		now = now.Add(2 * time.Minute)
+	}
+
+	expire("a", "b", "c", "d", "e")
+	old, replaced := cache.ReplaceIfPresent("a", "new")
+	assert.False(t, replaced, "Expired elements should not be replaced if present.")
+	assert.Equal(t, old, "", "Expired elements should have no previous value.")
+	assert.False(t, cache.Contains("a"), "Expired elements should not come back.")
+	_, present := cache.Replace("b", "new")
+	assert.False(t, present, "Expired elements should be reported as absent when replaced.")
+	_, ok := cache.Expiry("b")
+	assert.False(t, ok, "Replacing should clear the expiry.")
+	cache.ReplaceIf("c", "new", func(_ string, exists bool) bool {
+		assert.False(t, exists, "Expired elements should be reported as absent to the condition.")
+		return true
+	})
+	assert.False(t, cache.LockedUpdate("d", func(v *string) { *v = "new" }), "Expired elements should not be updated.")
+	_, deleted := cache.Delete("e")
+	assert.False(t, deleted, "Expired elements should be reported as absent when deleted.")
+
+	expire("f", "g")
+	v, ok := cache.Get("f")
+	assert.True(t, ok, "Expired elements should be loaded anew.")
+	assert.Equal(t, v, "loaded", "The loaded value is invalid.")
+	loaded, _, err := cache.Materialize([]string{"g"})
+	assert.NoError(t, err, "Materializing should not fail.")
+	assert.Equal(t, loaded, 1, "Expired elements should be materialized.")
+	assert.Equal(t, loads, []string{"f", "g"}, "The loader should be called for expired elements.")
+
+	expire("h")
+	assert.True(t, cache.PutLazy("h", func() (string, error) { return "lazy", nil }), "Lazy values should supersede expired elements.")
+	v, _ = cache.Get("h")
+	assert.Equal(t, v, "lazy", "The lazy value is invalid.")
+
+	mutable := New(WithMutableAccess[string, string]())
+	mutable.clock = func() time.Time { return now }
+	mutable.PutWithTTL("a", "old", time.Minute)
+	now = now.Add(2 * time.Minute)
+	assert.False(t, mutable.LockedUpdate("a", func(v *string) { *v = "new" }), "Expired elements should not be updated in place.")
+	assert.Equal(t, mutable.Size(), 0, "Expired elements should be dropped.")
+}
+
+func TestCacheTTLPersistence(t *testing.T) {
+
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "test.json")
+	open := func() *Cache[string, string] {
+		cache := New(
+			WithPersistence[string, string](&File{Path: path}),
+			WithEncoding[string, string](&JSON[string, string]{}),
+		)
+		cache.clock = func() time.Time { return now }
+		return cache
+	}
+
+	cache := open()
+	cache.PutWithTTL("hour", "hhh", time.Hour)
+	cache.PutWithTTL("minute", "mmm", time.Minute)
+	cache.PutWithTTL("expired", "eee", time.Second)
+	cache.Put("forever", "fff")
+	now = now.Add(2 * time.Second)
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	loaded := open()
+	assert.NoError(t, loaded.Load(), "Loading should succeed.")
+	assert.ElementsMatch(t, loaded.Keys(), []string{"hour", "minute", "forever"}, "Expired elements should not be persisted.")
+	expiry, ok := loaded.Expiry("hour")
+	assert.True(t, ok, "The expiry should have been persisted.")
+	assert.True(t, expiry.Equal(now.Add(time.Hour-2*time.Second)), "The expiry should round-trip.")
+	_, ok = loaded.Expiry("forever")
+	assert.False(t, ok, "Elements without a TTL should not expire after loading.")
+
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, loaded.Load(), "Loading should succeed.")
+	assert.ElementsMatch(t, loaded.Keys(), []string{"hour", "forever"}, "Elements expired since storing should not be loaded.")
+}
+
+func TestCacheExpirationInterval(t *testing.T) {
+
+	cache := New(WithExpirationInterval[string, string](time.Millisecond))
+	cache.PutWithTTL("a", "aaa", 5*time.Millisecond)
+	cache.Put("b", "bbb")
+	assert.Eventually(t, func() bool { return cache.Size() == 1 }, time.Second, time.Millisecond, "The sweeper should purge expired elements.")
+	assert.NoError(t, cache.Close(), "Closing should stop the sweeper.")
+}
+
+func TestCacheTTLEncodings(t *testing.T) {
+
+	now := time.Now()
+	compressed, _ := NewCompressed[string, string](&JSON[string, string]{}, gzip.DefaultCompression)
+	encrypted, _ := NewEncrypted[string, string](&YAML[string, string]{}, DeriveKey("passphrase"))
+	versioned := &Versioned[string, string]{Encoding: &GOB[string, string]{}, Version: 1}
+	for name, encoding := range map[string]Encoding[string, string]{
+		"json":         &JSON[string, string]{},
+		"pretty json":  &JSON[string, string]{Pretty: true},
+		"yaml":         &YAML[string, string]{},
+		"yaml entries": &YAML[string, string]{Entries: true},
+		"toml":         &TOML[string, string]{},
+		"toml entries": &TOML[string, string]{Entries: true},
+		"gob":          &GOB[string, string]{},
+		"compressed":   compressed,
+		"encrypted":    encrypted,
+		"versioned":    versioned,
+	} {
+		persistence := &memory{}
+		open := func() *Cache[string, string] {
+			cache := New(
+				WithPersistence[string, string](persistence),
+				WithEncoding[string, string](encoding),
+			)
+			cache.clock = func() time.Time { return now }
+			return cache
+		}
+
+		cache := open()
+		cache.Put("forever", "fff")
+		assert.NoError(t, cache.Store(), "Storing should succeed with %s.", name)
+		plain, _ := persistence.Read()
+		cache.PutWithTTL("secret-key", "sss", time.Hour)
+		assert.NoError(t, cache.Store(), "Storing should succeed with %s.", name)
+		data, _ := persistence.Read()
+
+		loaded := open()
+		assert.NoError(t, loaded.Load(), "Loading should succeed with %s.", name)
+		assert.Equal(t, loaded.Entries(), map[string]string{"forever": "fff", "secret-key": "sss"}, "The elements should round-trip with %s.", name)
+		expiry, ok := loaded.Expiry("secret-key")
+		assert.True(t, ok && expiry.Equal(now.Add(time.Hour)), "The expiry should round-trip with %s.", name)
+
+		switch name {
+		case "json", "pretty json":
+			assert.True(t, json.Valid(data), "The data should be valid JSON.")
+		case "yaml", "yaml entries":
+			var document any
+			assert.NoError(t, yaml.Unmarshal(data, &document), "The data should be valid YAML.")
+		case "compressed":
+			assert.True(t, bytes.HasPrefix(data, []byte{0x1f, 0x8b}), "The expiry times should be compressed too.")
+		case "encrypted":
+			assert.False(t, bytes.Contains(data, []byte("secret-key")), "Keys should not leak past the encryption.")
+		}
+
+		// with no expiry times, the data is encoded as usual
+		encoded, _ := encoding.Encode(map[string]string{"forever": "fff"})
+		if name != "encrypted" {
+			assert.Equal(t, plain, encoded, "Data with no expiry times should be plain with %s.", name)
+		}
+		decoded, expiries, err := decodeExpiring(encoding, plain)
+		assert.NoError(t, err, "Decoding plain data should succeed with %s.", name)
+		assert.Equal(t, decoded, map[string]string{"forever": "fff"}, "Plain data should decode with %s.", name)
+		assert.Empty(t, expiries, "Plain data should have no expiry times with %s.", name)
+	}
+}
+
+// opaque is an encoding that cannot carry expiry times.
+type opaque struct {
+	encoding JSON[string, string]
+}
+
+func (o *opaque) Encode(data map[string]string) ([]byte, error) { return o.encoding.Encode(data) }
+func (o *opaque) Decode(data []byte) (map[string]string, error) { return o.encoding.Decode(data) }
+
+func TestCacheTTLUnsupportedEncoding(t *testing.T) {
+
+	persistence := &memory{}
+	cache := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&opaque{}),
+	)
+	cache.Put("forever", "fff")
+	cache.PutWithTTL("hour", "hhh", time.Hour)
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	loaded := New(
+		WithPersistence[string, string](persistence),
+		WithEncoding[string, string](&opaque{}),
+	)
+	assert.NoError(t, loaded.Load(), "Loading should succeed.")
+	assert.Equal(t, loaded.Keys(), []string{"forever"}, "Elements whose expiry cannot be persisted should be left out.")
+}
+
+func TestCacheTTLCopyAndMigrate(t *testing.T) {
+
+	now := time.Now()
+	dir := t.TempDir()
+	cache := New(
+		WithPersistence[string, string](&File{Path: filepath.Join(dir, "test.json")}),
+		WithEncoding[string, string](&JSON[string, string]{}),
+	)
+	cache.clock = func() time.Time { return now }
+	cache.Put("a", "aaa")
+	cache.PutWithTTL("b", "bbb", time.Hour)
+	assert.NoError(t, cache.Store(), "Storing should succeed.")
+
+	copied := &File{Path: filepath.Join(dir, "copy.yaml")}
+	assert.NoError(t, cache.CopyTo(copied, &YAML[string, string]{}), "Copying should succeed.")
+	restored := New(
+		WithPersistence[string, string](copied),
+		WithEncoding[string, string](&YAML[string, string]{}),
+	)
+	restored.clock = cache.clock
+	assert.NoError(t, restored.Load(), "Loading the copy should succeed.")
+	expiry, ok := restored.Expiry("b")
+	assert.True(t, ok, "The expiry should have been copied.")
+	assert.True(t, expiry.Equal(now.Add(time.Hour)), "The copied expiry is invalid.")
+
+	migrated := &File{Path: filepath.Join(dir, "test.gob")}
+	assert.NoError(t, cache.MigrateEncoding(&GOB[string, string]{}, migrated), "Migrating should succeed.")
+	restored = New(
+		WithPersistence[string, string](migrated),
+		WithEncoding[string, string](&GOB[string, string]{}),
+	)
+	restored.clock = cache.clock
+	assert.NoError(t, restored.Load(), "Loading the migrated data should succeed.")
+	expiry, ok = restored.Expiry("b")
+	assert.True(t, ok, "The expiry should have been migrated.")
+	assert.True(t, expiry.Equal(now.Add(time.Hour)), "The migrated expiry is invalid.")
+	_, ok = restored.Expiry("a")
+	assert.False(t, ok, "Elements with no expiry should still have none.")
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// typeTag is the name of the field holding the type of a tagged value.
+const typeTag = "__type"
+
+var (
+	typesLock   sync.RWMutex
+	typesByName = map[string]reflect.Type{}
+	namesByType = map[reflect.Type]string{}
+)
+
+// RegisterValueType registers the concrete type of the sample value under
+// the given name, so that values of that type stored in a Cache whose value
+// type V is an interface round-trip through the JSON and YAML encodings,
+// which wrap them as {"__type": name, "value": ...}; the type is registered
+// with encoding/gob too. Values of unregistered types are encoded as is.
+func RegisterValueType[V any](name string, sample V) {
+	t := reflect.TypeOf(sample)
+	if t == nil {
+		panic("cache: cannot register the type of a nil value")
+	}
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	if other, ok := typesByName[name]; ok && other != t {
+		panic(fmt.Sprintf("cache: type name %q already registered for %v", name, other))
+	}
+	typesByName[name] = t
+	namesByType[t] = name
+	gob.RegisterName(name, sample)
+}
+
+// isInterface returns whether V is an interface type.
+func isInterface[V any]() bool {
+	return reflect.TypeOf((*V)(nil)).Elem().Kind() == reflect.Interface
+}
+
+// typeName returns the name the concrete type of v was registered with.
+func typeName(v any) (string, bool) {
+	typesLock.RLock()
+	defer typesLock.RUnlock()
+	name, ok := namesByType[reflect.TypeOf(v)]
+	return name, ok
+}
+
+// typeByName returns the concrete type registered with the given name.
+func typeByName(name string) (reflect.Type, bool) {
+	typesLock.RLock()
+	defer typesLock.RUnlock()
+	t, ok := typesByName[name]
+	return t, ok
+}
+
+// typed wraps an interface value, encoding it along with the name of its
+// concrete type when registered.
+type typed[V any] struct {
+	value V
+}
+
+// tagged is the encoded form of a value of a registered type.
+type tagged[R any] struct {
+	Type  string `json:"__type" yaml:"__type"`
+	Value R      `json:"value" yaml:"value"`
+}
+
+// MarshalJSON encodes the value, tagging it with its type name if registered.
+func (t typed[V]) MarshalJSON() ([]byte, error) {
+	if name, ok := typeName(t.value); ok {
+		return json.Marshal(tagged[any]{Type: name, Value: t.value})
+	}
+	return json.Marshal(t.value)
+}
+
+// UnmarshalJSON decodes the value into its registered concrete type, if
+// tagged with one.
+func (t *typed[V]) UnmarshalJSON(data []byte) error {
+	var probe tagged[json.RawMessage]
+	if json.Unmarshal(data, &probe) == nil && probe.Type != "" {
+		if concrete, ok := typeByName(probe.Type); ok {
+			p := reflect.New(concrete)
+			if err := json.Unmarshal(probe.Value, p.Interface()); err != nil {
+				return err
+			}
+			return t.assign(p.Elem())
+		}
+	}
+	return json.Unmarshal(data, &t.value)
+}
+
+// MarshalYAML encodes the value, tagging it with its type name if registered.
+func (t typed[V]) MarshalYAML() (any, error) {
+	if name, ok := typeName(t.value); ok {
+		return tagged[any]{Type: name, Value: t.value}, nil
+	}
+	return t.value, nil
+}
+
+// UnmarshalYAML decodes the value into its registered concrete type, if
+// tagged with one.
+func (t *typed[V]) UnmarshalYAML(node *yaml.Node) error {
+	var probe tagged[yaml.Node]
+	if node.Kind == yaml.MappingNode && node.Decode(&probe) == nil && probe.Type != "" {
+		if concrete, ok := typeByName(probe.Type); ok {
+			p := reflect.New(concrete)
+			if err := probe.Value.Decode(p.Interface()); err != nil {
+				return err
+			}
+			return t.assign(p.Elem())
+		}
+	}
+	return node.Decode(&t.value)
+}
+
+// assign stores the decoded value, provided it implements V.
+func (t *typed[V]) assign(v reflect.Value) error {
+	value, ok := v.Interface().(V)
+	if !ok {
+		return fmt.Errorf("cache: type %v does not implement %v", v.Type(), reflect.TypeOf((*V)(nil)).Elem())
+	}
+	t.value = value
+	return nil
+}
+
+// wrapTyped wraps all the values of the map.
+func wrapTyped[K comparable, V any](data map[K]V) map[K]typed[V] {
+	wrapped := make(map[K]typed[V], len(data))
+	for k, v := range data {
+		wrapped[k] = typed[V]{value: v}
+	}
+	return wrapped
+}
+
+// unwrapTyped unwraps all the values of the map.
+func unwrapTyped[K comparable, V any](wrapped map[K]typed[V]) map[K]V {
+	data := make(map[K]V, len(wrapped))
+	for k, v := range wrapped {
+		data[k] = v.value
+	}
+	return data
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type square struct {
+	Side float64 `json:"side" yaml:"side"`
+}
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+type rectangle struct {
+	Width  float64 `json:"width" yaml:"width"`
+	Height float64 `json:"height" yaml:"height"`
+}
+
+func (r *rectangle) Area() float64 { return r.Width * r.Height }
+
+func init() {
+	RegisterValueType("square", square{})
+	RegisterValueType("rectangle", &rectangle{})
+}
+
+func TestRegisterValueType(t *testing.T) {
+	data := map[string]shape{
+		"s": square{Side: 2},
+		"r": &rectangle{Width: 2, Height: 3},
+	}
+
+	for _, encoding := range []Encoding[string, shape]{
+		&JSON[string, shape]{},
+		&JSON[string, shape]{Pretty: true, OmitEmpty: true},
+		&YAML[string, shape]{},
+		&YAML[string, shape]{Entries: true},
+		&GOB[string, shape]{},
+	} {
+		encoded, err := encoding.Encode(data)
+		assert.NoError(t, err, "Encoding interface values should not fail.")
+		decoded, err := encoding.Decode(encoded)
+		assert.NoError(t, err, "Decoding interface values should not fail.")
+		assert.Equal(t, decoded, data, "Interface values should decode to their concrete types.")
+	}
+
+	json := &JSON[string, shape]{}
+	encoded, _ := json.Encode(map[string]shape{"s": square{Side: 1}})
+	assert.JSONEq(t, string(encoded), `{"s": {"__type": "square", "value": {"side": 1}}}`, "Values should be tagged with their type name.")
+	var buffer bytes.Buffer
+	assert.NoError(t, json.EncodeTo(&buffer, data), "Streaming interface values should not fail.")
+	decoded, err := json.Decode(buffer.Bytes())
+	assert.NoError(t, err, "Decoding streamed interface values should not fail.")
+	assert.Equal(t, decoded, data, "Streamed interface values should decode to their concrete types.")
+
+	_, err = (&JSON[string, shape]{}).Decode([]byte(`{"s": {"__type": "circle", "value": {"radius": 1}}}`))
+	assert.Error(t, err, "Decoding an unregistered type into an interface should fail.")
+
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	cache := New(
+		WithPersistence[string, shape](&File{Path: path}),
+		WithEncoding[string, shape](&YAML[string, shape]{}),
+	)
+	cache.PutMany(data)
+	assert.NoError(t, cache.Store(), "Storing interface values should succeed.")
+	cache2 := New(
+		WithPersistence[string, shape](&File{Path: path}),
+		WithEncoding[string, shape](&YAML[string, shape]{}),
+	)
+	assert.NoError(t, cache2.Load(), "Loading interface values should succeed.")
+	r, _ := cache2.Get("r")
+	assert.Equal(t, r.Area(), 6.0, "The loaded value should have its concrete type.")
+}
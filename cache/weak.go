@@ -0,0 +1,75 @@
+//go:build go1.24
+
+package cache
+
+import (
+	"weak"
+)
+
+// WithWeakValues applies the weak values option to a Cache of pointers,
+// which then only holds weak references to its values: once the rest of the
+// program no longer references a value, the garbage collector is free to
+// reclaim it, and a Get for its key becomes a miss (triggering the loader,
+// if any). Reclaimed entries are dropped when the Cache is shrunk.
+func WithWeakValues[K comparable, T any]() Option[K, *T] {
+	return func(c *Cache[K, *T]) {
+		c.store = &weakStore[K, T]{data: map[K]weak.Pointer[T]{}}
+	}
+}
+
+// weakStore is a Store holding weak pointers to its values.
+type weakStore[K comparable, T any] struct {
+	data map[K]weak.Pointer[T]
+}
+
+// Get returns the value associated with the key, if it is still live.
+func (w *weakStore[K, T]) Get(k K) (*T, bool) {
+	v := w.data[k].Value()
+	return v, v != nil
+}
+
+// Set associates a weak pointer to the value with the key.
+func (w *weakStore[K, T]) Set(k K, v *T) {
+	w.data[k] = weak.Make(v)
+}
+
+// Delete removes the key and its value.
+func (w *weakStore[K, T]) Delete(k K) {
+	delete(w.data, k)
+}
+
+// Range calls fn for each live element, stopping when it returns false.
+func (w *weakStore[K, T]) Range(fn func(k K, v *T) bool) {
+	for k, p := range w.data {
+		if v := p.Value(); v != nil && !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Len returns the number of live elements.
+func (w *weakStore[K, T]) Len() int {
+	n := 0
+	for _, p := range w.data {
+		if p.Value() != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Clear drops all the elements.
+func (w *weakStore[K, T]) Clear() {
+	w.data = map[K]weak.Pointer[T]{}
+}
+
+// Shrink drops the reclaimed elements and rebuilds the underlying map.
+func (w *weakStore[K, T]) Shrink() {
+	data := make(map[K]weak.Pointer[T], len(w.data))
+	for k, p := range w.data {
+		if p.Value() != nil {
+			data[k] = p
+		}
+	}
+	w.data = data
+}
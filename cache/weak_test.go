@@ -0,0 +1,58 @@
+//go:build go1.24
+
+package cache
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type blob struct {
+	ID   int
+	Data [256]byte
+}
+
+func TestCacheWeakValues(t *testing.T) {
+
+	cache := New(WithWeakValues[string, blob]())
+	kept := &blob{ID: 1}
+	cache.Put("kept", kept)
+	cache.Put("dropped", &blob{ID: 2})
+	assert.Equal(t, cache.Size(), 2, "Both values should be live.")
+
+	runtime.GC()
+	runtime.GC()
+	_, ok := cache.Get("dropped")
+	assert.False(t, ok, "A reclaimed value should be a miss.")
+	v, ok := cache.Get("kept")
+	assert.True(t, ok, "A referenced value should still be live.")
+	assert.Equal(t, v.ID, 1, "The live value should be returned.")
+	assert.Equal(t, cache.Size(), 1, "Only live values should be counted.")
+	cache.Shrink()
+	assert.Equal(t, cache.Keys(), []string{"kept"}, "Shrinking should drop the reclaimed entries.")
+	runtime.KeepAlive(kept)
+}
+
+func TestCacheWeakValuesLoader(t *testing.T) {
+
+	loads := 0
+	cache := New(
+		WithWeakValues[string, blob](),
+		WithLoader(func(k string) (*blob, bool, error) {
+			loads++
+			return &blob{ID: loads}, true, nil
+		}),
+	)
+
+	v, _ := cache.Get("a")
+	assert.Equal(t, v.ID, 1, "The value should have been loaded.")
+	v = nil
+	runtime.GC()
+	runtime.GC()
+	v, ok := cache.Get("a")
+	assert.True(t, ok, "The reclaimed value should have been loaded again.")
+	assert.Equal(t, loads, 2, "The loader should have been invoked again.")
+	runtime.KeepAlive(v)
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+// ZonedTime is a time.Time that preserves its location across all the
+// encodings. Plain time.Time values survive a round trip through any of the
+// encodings as the same instant (t.Equal holds), but only with a fixed
+// offset in place of the original location, so e.g. "America/New_York"
+// comes back as "-0400" and DST-aware arithmetic breaks; ZonedTime encodes
+// the location name alongside the RFC 3339 timestamp and restores it on
+// decoding. As with time.Time, the monotonic clock reading is never encoded.
+type ZonedTime struct {
+	time.Time
+}
+
+// MarshalText encodes the time as an RFC 3339 timestamp with nanoseconds,
+// followed by the location name if it has one.
+func (z ZonedTime) MarshalText() ([]byte, error) {
+	text, err := z.Time.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	if name := z.Location().String(); name != "" {
+		text = append(append(text, ' '), name...)
+	}
+	return text, nil
+}
+
+// UnmarshalText decodes the time from an RFC 3339 timestamp optionally
+// followed by a location name; if the location is unknown on this system,
+// the time keeps the fixed offset in the timestamp.
+func (z *ZonedTime) UnmarshalText(text []byte) error {
+	timestamp, name, _ := strings.Cut(string(text), " ")
+	if err := z.Time.UnmarshalText([]byte(timestamp)); err != nil {
+		return err
+	}
+	if name != "" {
+		if location, err := time.LoadLocation(name); err == nil {
+			z.Time = z.Time.In(location)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the time as a JSON string; see MarshalText.
+func (z ZonedTime) MarshalJSON() ([]byte, error) {
+	text, err := z.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{'"'}, text...), '"'), nil
+}
+
+// UnmarshalJSON decodes the time from a JSON string; see UnmarshalText.
+func (z *ZonedTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	return z.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
+}
+
+// GobEncode encodes the time for the GOB encoding; see MarshalText.
+func (z ZonedTime) GobEncode() ([]byte, error) {
+	return z.MarshalText()
+}
+
+// GobDecode decodes the time for the GOB encoding; see UnmarshalText.
+func (z *ZonedTime) GobDecode(data []byte) error {
+	return z.UnmarshalText(data)
+}
+
+// MarshalBinary encodes the time in binary form; see MarshalText.
+func (z ZonedTime) MarshalBinary() ([]byte, error) {
+	return z.MarshalText()
+}
+
+// UnmarshalBinary decodes the time from binary form; see UnmarshalText.
+func (z *ZonedTime) UnmarshalBinary(data []byte) error {
+	return z.UnmarshalText(data)
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTimeValues(t *testing.T) {
+
+	times := map[string]time.Time{"utc": time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)}
+	for _, name := range []string{"America/New_York", "Europe/Rome", "Asia/Kolkata"} {
+		location, err := time.LoadLocation(name)
+		assert.NoError(t, err, "The location should be available.")
+		times[name] = time.Date(2023, 7, 1, 12, 30, 0, 123456789, location)
+	}
+	times["fixed"] = time.Date(2023, 7, 1, 12, 30, 0, 0, time.FixedZone("", -90*60))
+	times["now"] = time.Now()
+
+	for _, format := range []string{"json", "yaml", "toml", "gob"} {
+		path := filepath.Join(t.TempDir(), "times."+format)
+
+		// plain time.Time values keep the instant but not the location
+		encoding, _ := NewEncoding[string, time.Time](format)
+		cache := New(WithPersistence[string, time.Time](&File{Path: path}), WithEncoding(encoding))
+		zencoding, _ := NewEncoding[string, ZonedTime](format)
+		zcache := New(WithPersistence[string, ZonedTime](&File{Path: path + ".zoned"}), WithEncoding(zencoding))
+		for k, v := range times {
+			cache.Put(k, v)
+			zcache.Put(k, ZonedTime{v})
+		}
+		assert.NoError(t, cache.Store(), "Storing %s should succeed.", format)
+		assert.NoError(t, zcache.Store(), "Storing %s should succeed.", format)
+
+		cache = New(WithPersistence[string, time.Time](&File{Path: path}), WithEncoding(encoding))
+		zcache = New(WithPersistence[string, ZonedTime](&File{Path: path + ".zoned"}), WithEncoding(zencoding))
+		assert.NoError(t, cache.Load(), "Loading %s should succeed.", format)
+		assert.NoError(t, zcache.Load(), "Loading %s should succeed.", format)
+		for k, v := range times {
+			loaded, _ := cache.Get(k)
+			assert.True(t, v.Equal(loaded), "The %s time %q should be the same instant.", format, k)
+			zoned, _ := zcache.Get(k)
+			assert.True(t, v.Equal(zoned.Time), "The %s zoned time %q should be the same instant.", format, k)
+			if k != "now" {
+				assert.Equal(t, zoned.Location().String(), v.Location().String(), "The %s zoned time %q should keep its location.", format, k)
+				assert.Equal(t, zoned.Time, v, "The %s zoned time %q should be identical.", format, k)
+			}
+			assert.Equal(t, fmt.Sprint(zoned.Time), fmt.Sprint(v.Round(0)), "The %s zoned time %q should print the same.", format, k)
+		}
+	}
+}
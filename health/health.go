@@ -0,0 +1,91 @@
+// Package health exposes the health of a cache over HTTP, e.g. for
+// Kubernetes liveness and readiness probes.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dihedron/yagc/cache"
+)
+
+// Status is the JSON document served by the handler.
+type Status struct {
+	// Status is "ok" or "degraded".
+	Status string `json:"status"`
+	// Size is the number of entries in the cache.
+	Size int `json:"size"`
+	// LastFlush is the time of the latest successful write to persistence.
+	LastFlush *time.Time `json:"last_flush,omitempty"`
+	// LastFlushError is the error of the latest write, if it failed.
+	LastFlushError string `json:"last_flush_error,omitempty"`
+	// ConsecutiveFailures is the number of writes that failed in a row.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// Ping is "ok" or the error returned when pinging the persistence.
+	Ping string `json:"ping"`
+}
+
+// Option is the type for functional options.
+type Option func(*handler)
+
+// WithMaxFailures sets how many consecutive failed writes to persistence
+// make the cache degraded; the default is 3.
+func WithMaxFailures(n int) Option {
+	return func(h *handler) {
+		if n > 0 {
+			h.maxFailures = n
+		}
+	}
+}
+
+// Handler returns an http.Handler reporting the health of the given cache
+// as a JSON Status; it responds with 503 Service Unavailable when the cache
+// is degraded, that is when its persistence cannot be pinged or the latest
+// writes to it all failed.
+func Handler[K comparable, V any](c *cache.Cache[K, V], options ...Option) http.Handler {
+	h := &handler{maxFailures: 3}
+	for _, option := range options {
+		option(h)
+	}
+	h.status = func() Status {
+		flush := c.FlushStatus()
+		status := Status{
+			Status:              "ok",
+			Size:                c.Size(),
+			ConsecutiveFailures: flush.ConsecutiveFailures,
+			Ping:                "ok",
+		}
+		if !flush.LastFlush.IsZero() {
+			status.LastFlush = &flush.LastFlush
+		}
+		if flush.LastError != nil {
+			status.LastFlushError = flush.LastError.Error()
+		}
+		if err := c.Ping(); err != nil {
+			status.Ping = err.Error()
+			status.Status = "degraded"
+		}
+		if flush.ConsecutiveFailures >= h.maxFailures {
+			status.Status = "degraded"
+		}
+		return status
+	}
+	return h
+}
+
+// handler serves the cache status.
+type handler struct {
+	maxFailures int
+	status      func() Status
+}
+
+// ServeHTTP writes the cache status as JSON.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := h.status()
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
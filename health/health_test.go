@@ -0,0 +1,79 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dihedron/yagc/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// remote is a persistence whose reachability can be controlled.
+type remote struct {
+	err error
+}
+
+func (r *remote) Write([]byte) error    { return r.err }
+func (r *remote) Read() ([]byte, error) { return nil, r.err }
+func (r *remote) Ping() error           { return r.err }
+
+func get(t *testing.T, h http.Handler) (int, Status) {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var status Status
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status), "The status should be valid JSON.")
+	return recorder.Code, status
+}
+
+func TestHandler(t *testing.T) {
+
+	persistence := &remote{}
+	c := cache.New(
+		cache.WithPersistence[string, string](persistence),
+		cache.WithPolicy[string, string](&cache.Always{}),
+	)
+	h := Handler(c, WithMaxFailures(2))
+
+	c.Put("a", "aaa")
+	code, status := get(t, h)
+	assert.Equal(t, code, http.StatusOK, "A healthy cache should be reported as such.")
+	assert.Equal(t, status.Status, "ok", "A healthy cache should be reported as such.")
+	assert.Equal(t, status.Size, 1, "The size should be reported.")
+	assert.NotNil(t, status.LastFlush, "The last flush should be reported.")
+
+	persistence.err = errors.New("unreachable")
+	code, status = get(t, h)
+	assert.Equal(t, code, http.StatusServiceUnavailable, "A failed ping should degrade the cache.")
+	assert.Equal(t, status.Status, "degraded", "A failed ping should degrade the cache.")
+	assert.Equal(t, status.Ping, "unreachable", "The ping error should be reported.")
+}
+
+func TestHandlerFlushFailures(t *testing.T) {
+
+	persistence := &remote{}
+	c := cache.New(
+		cache.WithPersistence[string, string](&cache.Fallback{Primary: persistence}),
+		cache.WithPolicy[string, string](&cache.Always{}),
+	)
+	h := Handler(c, WithMaxFailures(2))
+
+	persistence.err = errors.New("disk full")
+	c.Put("a", "aaa")
+	code, status := get(t, h)
+	assert.Equal(t, code, http.StatusOK, "A single failure should be tolerated.")
+	assert.Equal(t, status.LastFlushError, "disk full", "The flush error should be reported.")
+	assert.Equal(t, status.ConsecutiveFailures, 1, "The failures should be counted.")
+
+	c.Put("b", "bbb")
+	code, status = get(t, h)
+	assert.Equal(t, code, http.StatusServiceUnavailable, "Repeated failures should degrade the cache.")
+	assert.Equal(t, status.Ping, "ok", "Fallback cannot be pinged, so it is never reported as unreachable.")
+
+	persistence.err = nil
+	c.Put("c", "ccc")
+	code, _ = get(t, h)
+	assert.Equal(t, code, http.StatusOK, "A successful flush should make the cache healthy again.")
+}
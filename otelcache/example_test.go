@@ -0,0 +1,33 @@
+package otelcache_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dihedron/yagc/cache"
+	"github.com/dihedron/yagc/otelcache"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func ExampleWithOTelTracing() {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c := otelcache.WithOTelTracing(provider, &cache.Discard{},
+		cache.WithPolicy[string, int](&cache.Always{}),
+	)
+	ctx := context.Background()
+	c.Put(ctx, "answer", 42)
+	v, _ := c.Get(ctx, "answer")
+	fmt.Println(v)
+
+	for _, span := range recorder.Ended() {
+		fmt.Println(span.Name())
+	}
+	// Output:
+	// 42
+	// yagc.persistence.Write
+	// yagc.Put
+	// yagc.Get
+}
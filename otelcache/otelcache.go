@@ -0,0 +1,320 @@
+// Package otelcache traces the operations of a cache with OpenTelemetry;
+// it lives in its own package so that the core cache package does not
+// depend on OpenTelemetry.
+package otelcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/dihedron/yagc/cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation is the name of the instrumentation library.
+const instrumentation = "github.com/dihedron/yagc/otelcache"
+
+// Cache is a cache.Cache whose Get, Put, Delete, Store and Load operations
+// are traced as spans; reads and writes to persistent storage happening
+// within these operations are traced as child spans. All the other methods
+// of the underlying cache are available untraced.
+type Cache[K comparable, V any] struct {
+	*cache.Cache[K, V]
+	tracer trace.Tracer
+}
+
+// WithOTelTracing creates a traced Cache using the given tracer provider,
+// which persists its contents to the given Persistence and applies all the
+// provided options to the underlying cache.Cache; the Persistence must be
+// given here rather than as an option, so that its reads and writes can be
+// traced.
+func WithOTelTracing[K comparable, V any](tp trace.TracerProvider, p cache.Persistence, options ...cache.Option[K, V]) *Cache[K, V] {
+	if p == nil {
+		p = &cache.Discard{}
+	}
+	tracer := tp.Tracer(instrumentation)
+	options = append(options, cache.WithPersistence[K, V](wrap[K](context.Background(), p, tracer)))
+	return &Cache[K, V]{
+		Cache:  cache.New(options...),
+		tracer: tracer,
+	}
+}
+
+// Get retrieves an element from the cache, recording whether it was a hit.
+func (c *Cache[K, V]) Get(ctx context.Context, k K) (V, bool) {
+	_, span := c.tracer.Start(ctx, "yagc.Get")
+	defer span.End()
+	v, ok := c.Cache.Get(k)
+	span.SetAttributes(attribute.Bool("yagc.hit", ok))
+	return v, ok
+}
+
+// Put stores an element in the cache unless one already exists, recording
+// whether it was added.
+func (c *Cache[K, V]) Put(ctx context.Context, k K, v V) bool {
+	var ok bool
+	c.trace(ctx, "yagc.Put", func(view *cache.Cache[K, V], span trace.Span) error {
+		ok = view.Put(k, v)
+		span.SetAttributes(attribute.Bool("yagc.added", ok))
+		return nil
+	})
+	return ok
+}
+
+// Delete removes an element from the cache, recording whether it existed.
+func (c *Cache[K, V]) Delete(ctx context.Context, k K) (V, bool) {
+	var (
+		v  V
+		ok bool
+	)
+	c.trace(ctx, "yagc.Delete", func(view *cache.Cache[K, V], span trace.Span) error {
+		v, ok = view.Delete(k)
+		span.SetAttributes(attribute.Bool("yagc.hit", ok))
+		return nil
+	})
+	return v, ok
+}
+
+// Store persists the cache, recording any error.
+func (c *Cache[K, V]) Store(ctx context.Context) error {
+	return c.trace(ctx, "yagc.Store", func(view *cache.Cache[K, V], span trace.Span) error {
+		return view.Store()
+	})
+}
+
+// Load reads back the cache, recording any error.
+func (c *Cache[K, V]) Load(ctx context.Context) error {
+	return c.trace(ctx, "yagc.Load", func(view *cache.Cache[K, V], span trace.Span) error {
+		return view.Load()
+	})
+}
+
+// trace runs fn within a new span, handing it a view of the cache bound to
+// the span context, so that the span becomes the parent of the spans of any
+// persistence operation fn triggers through the view; the number of entries
+// and any error are recorded on the span.
+func (c *Cache[K, V]) trace(ctx context.Context, name string, fn func(view *cache.Cache[K, V], span trace.Span) error) error {
+	ctx, span := c.tracer.Start(ctx, name)
+	defer span.End()
+
+	err := fn(c.Cache.WithContext(ctx), span)
+
+	span.SetAttributes(attribute.Int("yagc.entries", c.Cache.Size()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// persistence wraps a cache.Persistence, tracing its reads and writes as
+// children of the span in its context; the cache binds it to the context of
+// the traced operation triggering them (see cache.ContextPersistence), while
+// the ones happening in the background (e.g. deferred writes) are traced as
+// root spans. The optional interfaces of the wrapped Persistence are
+// forwarded: Ping and Version fall back to no error and no version, reads of
+// valid data to plain reads, while writers fall back to buffering the data
+// and writing it at once on Close; ItemPersistence is only implemented, by
+// itemPersistence, when the wrapped Persistence implements it.
+type persistence[K comparable] struct {
+	cache.Persistence
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+// wrap wraps the given Persistence, so that its operations are traced within
+// the given context.
+func wrap[K comparable](ctx context.Context, p cache.Persistence, tracer trace.Tracer) cache.Persistence {
+	wrapped := &persistence[K]{Persistence: p, tracer: tracer, ctx: ctx}
+	if _, ok := p.(cache.ItemPersistence[K]); ok {
+		return &itemPersistence[K]{persistence: wrapped}
+	}
+	return wrapped
+}
+
+// WithContext returns a copy of the wrapper tracing its operations within
+// the given context.
+func (p *persistence[K]) WithContext(ctx context.Context) cache.Persistence {
+	return wrap[K](ctx, p.Persistence, p.tracer)
+}
+
+// start starts a persistence span, as a child of the span in the wrapper
+// context, if any.
+func (p *persistence[K]) start(name string) trace.Span {
+	_, span := p.tracer.Start(p.ctx, name)
+	return span
+}
+
+// end ends a persistence span, recording the given error, if any.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Write writes data to the wrapped Persistence, recording its size.
+func (p *persistence[K]) Write(data []byte) error {
+	span := p.start("yagc.persistence.Write")
+	span.SetAttributes(attribute.Int("yagc.bytes", len(data)))
+	err := p.Persistence.Write(data)
+	end(span, err)
+	return err
+}
+
+// Read reads data back from the wrapped Persistence, recording its size.
+func (p *persistence[K]) Read() ([]byte, error) {
+	span := p.start("yagc.persistence.Read")
+	data, err := p.Persistence.Read()
+	span.SetAttributes(attribute.Int("yagc.bytes", len(data)))
+	end(span, err)
+	return data, err
+}
+
+// ReadValid reads valid data back from the wrapped Persistence, if it can
+// validate the data (see cache.ValidatingPersistence), or like Read
+// otherwise, recording its size.
+func (p *persistence[K]) ReadValid(valid func(data []byte) error) ([]byte, error) {
+	validating, ok := p.Persistence.(cache.ValidatingPersistence)
+	if !ok {
+		return p.Read()
+	}
+	span := p.start("yagc.persistence.Read")
+	data, err := validating.ReadValid(valid)
+	span.SetAttributes(attribute.Int("yagc.bytes", len(data)))
+	end(span, err)
+	return data, err
+}
+
+// Writer opens a writer on the wrapped Persistence, if it streams, tracing
+// the whole write up to Close or Abort and recording its size; otherwise the
+// data is buffered and written at once on Close.
+func (p *persistence[K]) Writer() (io.WriteCloser, error) {
+	streaming, ok := p.Persistence.(cache.StreamingPersistence)
+	if !ok {
+		return &buffered[K]{p: p}, nil
+	}
+	span := p.start("yagc.persistence.Write")
+	w, err := streaming.Writer()
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &tracedWriter{w: w, span: span}, nil
+}
+
+// Ping checks whether the wrapped Persistence is reachable, if it supports
+// it.
+func (p *persistence[K]) Ping() error {
+	if pinger, ok := p.Persistence.(cache.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Version returns the version of the data in the wrapped Persistence, if it
+// supports it, or no version otherwise.
+func (p *persistence[K]) Version() (string, error) {
+	if versioned, ok := p.Persistence.(cache.VersionedPersistence); ok {
+		return versioned.Version()
+	}
+	return "", nil
+}
+
+// itemPersistence wraps a cache.ItemPersistence, tracing the writes, deletes
+// and reads of individual elements too.
+type itemPersistence[K comparable] struct {
+	*persistence[K]
+}
+
+// WriteItem writes an element to the wrapped ItemPersistence, recording its
+// size.
+func (p *itemPersistence[K]) WriteItem(k K, data []byte) error {
+	span := p.start("yagc.persistence.WriteItem")
+	span.SetAttributes(attribute.Int("yagc.bytes", len(data)))
+	err := p.Persistence.(cache.ItemPersistence[K]).WriteItem(k, data)
+	end(span, err)
+	return err
+}
+
+// DeleteItem removes an element from the wrapped ItemPersistence.
+func (p *itemPersistence[K]) DeleteItem(k K) error {
+	span := p.start("yagc.persistence.DeleteItem")
+	err := p.Persistence.(cache.ItemPersistence[K]).DeleteItem(k)
+	end(span, err)
+	return err
+}
+
+// ReadItems reads back all the elements from the wrapped ItemPersistence,
+// recording their number.
+func (p *itemPersistence[K]) ReadItems() (map[K][]byte, error) {
+	span := p.start("yagc.persistence.ReadItems")
+	items, err := p.Persistence.(cache.ItemPersistence[K]).ReadItems()
+	span.SetAttributes(attribute.Int("yagc.items", len(items)))
+	end(span, err)
+	return items, err
+}
+
+// tracedWriter traces a streamed write to the wrapped Persistence.
+type tracedWriter struct {
+	w     io.WriteCloser
+	span  trace.Span
+	bytes int
+}
+
+// Write writes data to the wrapped writer.
+func (w *tracedWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.bytes += n
+	return n, err
+}
+
+// Close commits the data written to the wrapped writer, ending the span.
+func (w *tracedWriter) Close() error {
+	err := w.w.Close()
+	w.span.SetAttributes(attribute.Int("yagc.bytes", w.bytes))
+	end(w.span, err)
+	return err
+}
+
+// Abort discards the data written to the wrapped writer, if it supports
+// that, ending the span.
+func (w *tracedWriter) Abort() error {
+	var err error
+	if a, ok := w.w.(interface{ Abort() error }); ok {
+		err = a.Abort()
+	} else {
+		err = w.w.Close()
+	}
+	w.span.SetAttributes(attribute.Int("yagc.bytes", w.bytes))
+	end(w.span, errors.New("write aborted"))
+	return err
+}
+
+// buffered collects the data written to a Persistence that does not stream,
+// writing it at once on Close.
+type buffered[K comparable] struct {
+	p      *persistence[K]
+	buffer bytes.Buffer
+}
+
+// Write appends data to the buffer.
+func (b *buffered[K]) Write(p []byte) (int, error) {
+	return b.buffer.Write(p)
+}
+
+// Close writes the buffered data to the Persistence.
+func (b *buffered[K]) Close() error {
+	return b.p.Write(b.buffer.Bytes())
+}
+
+// Abort discards the buffered data.
+func (b *buffered[K]) Abort() error {
+	b.buffer.Reset()
+	return nil
+}
@@ -0,0 +1,228 @@
+package otelcache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dihedron/yagc/cache"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type failing struct{}
+
+func (failing) Write([]byte) error    { return errors.New("disk full") }
+func (failing) Read() ([]byte, error) { return nil, errors.New("disk full") }
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestTracing(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	path := filepath.Join(t.TempDir(), "test.json")
+	c := WithOTelTracing(provider, &cache.File{Path: path},
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+		cache.WithPolicy[string, string](&cache.Always{}),
+	)
+	ctx := context.Background()
+
+	c.Put(ctx, "a", "aaa")
+	c.Get(ctx, "a")
+	c.Get(ctx, "b")
+	c.Delete(ctx, "a")
+	assert.NoError(t, c.Store(ctx), "Storing should not fail.")
+	assert.NoError(t, c.Load(ctx), "Loading should not fail.")
+
+	spans := recorder.Ended()
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, names, []string{
+		"yagc.persistence.Write", "yagc.Put",
+		"yagc.Get",
+		"yagc.Get",
+		"yagc.persistence.Write", "yagc.Delete",
+		"yagc.persistence.Write", "yagc.Store",
+		"yagc.persistence.Read", "yagc.Load",
+	}, "All operations should have been traced.")
+
+	assert.Equal(t, spans[0].Parent().SpanID(), spans[1].SpanContext().SpanID(), "The write should be a child of the put.")
+	assert.Equal(t, attributes(spans[0])["yagc.bytes"].AsInt64(), int64(len(`{"a":"aaa"}`)), "The bytes persisted should be recorded.")
+	assert.Equal(t, attributes(spans[1])["yagc.entries"].AsInt64(), int64(1), "The number of entries should be recorded.")
+	assert.True(t, attributes(spans[2])["yagc.hit"].AsBool(), "The hit should be recorded.")
+	assert.False(t, attributes(spans[3])["yagc.hit"].AsBool(), "The miss should be recorded.")
+}
+
+func TestTracingErrors(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	c := WithOTelTracing[string, string](provider, failing{})
+
+	assert.Error(t, c.Store(context.Background()), "Storing should fail.")
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2, "Both the store and the write should have been traced.")
+	for _, span := range spans {
+		assert.Equal(t, span.Status().Code, codes.Error, "The error should be recorded on %q.", span.Name())
+		assert.Len(t, span.Events(), 1, "The error should be recorded on %q.", span.Name())
+	}
+}
+
+func TestTracingConcurrent(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	c := WithOTelTracing(provider, &cache.File{Path: filepath.Join(t.TempDir(), "test.json")},
+		cache.WithEncoding[int, int](&cache.JSON[int, int]{}),
+		cache.WithPolicy[int, int](&cache.Always{}),
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Put(context.Background(), i, i)
+		}(i)
+	}
+	wg.Wait()
+
+	puts := map[trace.SpanID]int{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "yagc.Put" {
+			puts[span.SpanContext().SpanID()] = 0
+		}
+	}
+	assert.Len(t, puts, 20, "All puts should have been traced.")
+	for _, span := range recorder.Ended() {
+		if span.Name() == "yagc.persistence.Write" {
+			_, ok := puts[span.Parent().SpanID()]
+			assert.True(t, ok, "Each write should be a child of a put.")
+			puts[span.Parent().SpanID()]++
+		}
+	}
+	for _, writes := range puts {
+		assert.Equal(t, writes, 1, "Each put should have a write of its own.")
+	}
+}
+
+// items is an ItemPersistence keeping the encoded elements in memory.
+type items struct {
+	failing
+	data map[string][]byte
+}
+
+func (i *items) WriteItem(k string, data []byte) error {
+	i.data[k] = data
+	return nil
+}
+
+func (i *items) DeleteItem(k string) error {
+	delete(i.data, k)
+	return nil
+}
+
+func (i *items) ReadItems() (map[string][]byte, error) {
+	return i.data, nil
+}
+
+func TestTracingForwarding(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+	file := &cache.File{Path: path}
+	c := WithOTelTracing(provider, file,
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+		cache.WithReloadOnStoreConflict[string, string](cache.FailOnConflict),
+	)
+	ctx := context.Background()
+
+	assert.NoError(t, c.Ping(), "Pinging an existing directory should succeed.")
+	missing := WithOTelTracing[string, string](provider, &cache.File{Path: filepath.Join(dir, "missing", "test.json")})
+	assert.Error(t, missing.Ping(), "Pinging a missing directory should fail.")
+
+	c.Put(ctx, "a", "aaa")
+	assert.NoError(t, c.Store(ctx), "Storing should not fail.")
+	spans := recorder.Ended()
+	write := spans[len(spans)-2]
+	assert.Equal(t, write.Name(), "yagc.persistence.Write", "The streamed write should have been traced.")
+	assert.Equal(t, attributes(write)["yagc.bytes"].AsInt64(), int64(len(`{"a":"aaa"}`)), "The bytes streamed should be recorded.")
+	assert.Equal(t, write.Parent().SpanID(), spans[len(spans)-1].SpanContext().SpanID(), "The streamed write should be a child of the store.")
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, file.Write([]byte(`{"b":"bbb"}`)), "Writing behind the cache should not fail.")
+	assert.ErrorIs(t, c.Store(ctx), cache.ErrStoreConflict, "The version of the persisted data should be checked.")
+
+	persistence := &items{data: map[string][]byte{}}
+	c2 := WithOTelTracing(provider, persistence,
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+		cache.WithPolicy[string, string](&cache.Always{}),
+		cache.WithDirtyKeyTracking[string, string](),
+	)
+	c2.Put(ctx, "a", "aaa")
+	assert.Contains(t, persistence.data, "a", "The element should have been written on its own.")
+	spans = recorder.Ended()
+	write = spans[len(spans)-2]
+	assert.Equal(t, write.Name(), "yagc.persistence.WriteItem", "The element write should have been traced.")
+	assert.Equal(t, write.Parent().SpanID(), spans[len(spans)-1].SpanContext().SpanID(), "The element write should be a child of the put.")
+	c2.Delete(ctx, "a")
+	assert.Empty(t, persistence.data, "The element should have been deleted on its own.")
+
+	corrupt := &cache.File{Path: filepath.Join(dir, "corrupt.json")}
+	assert.NoError(t, corrupt.Write([]byte("{not json")), "Writing the corrupt data should not fail.")
+	c3 := WithOTelTracing(provider, &cache.Fallback{Primary: corrupt, Replicas: []cache.Persistence{file}},
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+	)
+	assert.NoError(t, c3.Load(ctx), "Loading should fall back to the replica through the tracing.")
+	assert.Equal(t, c3.Keys(), []string{"b"}, "The replica data should have been loaded.")
+}
+
+func TestTracingAsync(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	done := make(chan struct{})
+	c := WithOTelTracing(provider, &cache.File{Path: filepath.Join(t.TempDir(), "test.json")},
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+		cache.WithOnPut(func(c *cache.Cache[string, string], k string, v string) {
+			go func() {
+				defer close(done)
+				c.Store()
+			}()
+		}),
+	)
+	c.Put(context.Background(), "a", "aaa")
+	<-done
+
+	var put trace.SpanID
+	for _, span := range recorder.Ended() {
+		if span.Name() == "yagc.Put" {
+			put = span.SpanContext().SpanID()
+		}
+	}
+	writes := 0
+	for _, span := range recorder.Ended() {
+		if span.Name() == "yagc.persistence.Write" {
+			assert.Equal(t, span.Parent().SpanID(), put, "The write in another goroutine should be a child of the put.")
+			writes++
+		}
+	}
+	assert.Equal(t, writes, 1, "The hook should have stored the cache.")
+}
@@ -0,0 +1,43 @@
+// Package rediscache persists a cache to Redis, so that several replicas can
+// share the same backing store; it lives in its own package so that the core
+// cache package does not depend on the Redis client.
+package rediscache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis persists the encoded data, and reads it back from a given key in
+// Redis.
+type Redis struct {
+	Client *redis.Client
+	Key    string
+}
+
+// New creates a new Redis persistence storing the data under the given key.
+func New(client *redis.Client, key string) *Redis {
+	return &Redis{Client: client, Key: key}
+}
+
+// Write sets the given key to the data.
+func (r *Redis) Write(data []byte) error {
+	return r.Client.Set(context.Background(), r.Key, data, 0).Err()
+}
+
+// Read gets the data back from the given key; a missing key holds empty
+// data, so that loading a fresh cache does not fail.
+func (r *Redis) Read() ([]byte, error) {
+	data, err := r.Client.Get(context.Background(), r.Key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return []byte{}, nil
+	}
+	return data, err
+}
+
+// Ping checks that the Redis server is reachable.
+func (r *Redis) Ping() error {
+	return r.Client.Ping(context.Background()).Err()
+}
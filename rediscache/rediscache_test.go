@@ -0,0 +1,55 @@
+package rediscache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dihedron/yagc/cache"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// client returns a client to the Redis server at REDIS_ADDR, skipping the
+// test if it is not set.
+func client(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set, skipping Redis integration test")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedis(t *testing.T) {
+
+	client := client(t)
+	key := fmt.Sprintf("yagc-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { client.Del(context.Background(), key) })
+	persistence := New(client, key)
+	assert.NoError(t, persistence.Ping(), "The server should be reachable.")
+
+	fresh := cache.New(
+		cache.WithPersistence[string, string](persistence),
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+	)
+	data, err := persistence.Read()
+	assert.NoError(t, err, "Reading a missing key should not fail.")
+	assert.Equal(t, data, []byte{}, "A missing key should hold empty data.")
+	assert.NoError(t, fresh.Load(), "Loading a missing key should not fail.")
+	assert.Equal(t, fresh.Size(), 0, "A missing key should hold no elements.")
+
+	fresh.Put("a", "aaa")
+	fresh.Put("b", "bbb")
+	assert.NoError(t, fresh.Store(), "Storing should succeed.")
+
+	replica := cache.New(
+		cache.WithPersistence[string, string](persistence),
+		cache.WithEncoding[string, string](&cache.JSON[string, string]{}),
+	)
+	assert.NoError(t, replica.Load(), "Loading should succeed.")
+	assert.ElementsMatch(t, replica.Keys(), []string{"a", "b"}, "The key set is invalid.")
+}